@@ -2,10 +2,10 @@ package blob
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
 	"github.com/pritamdas99/solr-dump/model"
 	"io"
-	"os"
 	"path"
 	"strings"
 
@@ -13,11 +13,16 @@ import (
 	_ "gocloud.dev/blob/azureblob"
 	_ "gocloud.dev/blob/gcsblob"
 	_ "gocloud.dev/blob/s3blob"
+	"gocloud.dev/gcerrors"
 )
 
 type Blob struct {
 	prefix     string
 	storageURL string
+	// shared is used instead of opening storageURL, it is never closed
+	shared *blob.Bucket
+	// open opens the bucket instead of storageURL, for buckets that need explicit credentials
+	open func(ctx context.Context) (*blob.Bucket, error)
 }
 
 func NewBlob(bs *model.BackupStorage) (*Blob, error) {
@@ -28,23 +33,21 @@ func NewBlob(bs *model.BackupStorage) (*Blob, error) {
 		return gcsBlob(bs)
 	case model.ProviderAZURE:
 		return azureBlob(bs)
+	case model.ProviderLocal:
+		return localBlob(bs)
+	case model.ProviderMemory:
+		return memoryBlob(bs)
 	default:
 		return nil, fmt.Errorf("unknown provider: %s", bs.Storage.Provider)
 	}
 }
 
 func (b *Blob) Get(ctx context.Context, filepath string) ([]byte, error) {
-	dir, filename := path.Split(filepath)
-	bucket, err := b.openBucket(ctx, dir)
+	r, err := b.NewReader(ctx, filepath)
 	if err != nil {
 		return nil, err
 	}
-	defer closeBucket(bucket)
-	r, err := bucket.NewReader(ctx, filename, nil)
-	if err != nil {
-		return nil, err
-	}
-	defer func(r *blob.Reader) {
+	defer func(r io.ReadCloser) {
 		closeErr := r.Close()
 		if closeErr != nil {
 			err := fmt.Errorf("failed to close reader: %s", closeErr)
@@ -54,44 +57,157 @@ func (b *Blob) Get(ctx context.Context, filepath string) ([]byte, error) {
 	return io.ReadAll(r)
 }
 
+func (b *Blob) Put(ctx context.Context, filepath string, r io.Reader) error {
+	// the writer is aborted by cancelling its context if the copy fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w, err := b.NewWriter(ctx, filepath)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		cancel()
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (b *Blob) Delete(ctx context.Context, filepath string) error {
+	bucket, key, err := b.openBucket(ctx, filepath)
+	if err != nil {
+		return err
+	}
+	defer b.closeBucket(bucket)
+	return bucket.Delete(ctx, key)
+}
+
+func (b *Blob) Stat(ctx context.Context, filepath string) (*model.ObjectInfo, error) {
+	bucket, key, err := b.openBucket(ctx, filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer b.closeBucket(bucket)
+	attrs, err := bucket.Attributes(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &model.ObjectInfo{
+		Path:    filepath,
+		Size:    attrs.Size,
+		ModTime: attrs.ModTime,
+		ETag:    attrs.ETag,
+		MD5:     hex.EncodeToString(attrs.MD5),
+	}, nil
+}
+
+// NewReader opens filepath for reading. The bucket stays open until the reader is closed.
+func (b *Blob) NewReader(ctx context.Context, filepath string) (io.ReadCloser, error) {
+	bucket, key, err := b.openBucket(ctx, filepath)
+	if err != nil {
+		return nil, err
+	}
+	r, err := bucket.NewReader(ctx, key, nil)
+	if err != nil {
+		b.closeBucket(bucket)
+		return nil, err
+	}
+	return &bucketReader{Reader: r, close: func() { b.closeBucket(bucket) }}, nil
+}
+
+// NewWriter opens filepath for writing. The object is only committed when the writer is closed
+// without error; cancel ctx to abort the write.
+func (b *Blob) NewWriter(ctx context.Context, filepath string) (io.WriteCloser, error) {
+	bucket, key, err := b.openBucket(ctx, filepath)
+	if err != nil {
+		return nil, err
+	}
+	w, err := bucket.NewWriter(ctx, key, nil)
+	if err != nil {
+		b.closeBucket(bucket)
+		return nil, err
+	}
+	return &bucketWriter{Writer: w, close: func() { b.closeBucket(bucket) }}, nil
+}
+
 func (b *Blob) List(ctx context.Context, dir string) ([]string, error) {
-	bucket, err := b.openBucket(ctx, dir)
+	infos, err := b.ListInfo(ctx, dir)
 	if err != nil {
 		return nil, err
 	}
-	defer closeBucket(bucket)
 	var objects []string
-	iter := bucket.List(nil)
+	for _, info := range infos {
+		objects = append(objects, info.Path)
+	}
+	return objects, nil
+}
+
+func (b *Blob) ListInfo(ctx context.Context, dir string) ([]model.ObjectInfo, error) {
+	var objects []model.ObjectInfo
+	err := b.Walk(ctx, dir, func(info model.ObjectInfo) error {
+		objects = append(objects, info)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+func (b *Blob) Walk(ctx context.Context, dir string, fn func(model.ObjectInfo) error) error {
+	bucket, prefix, err := b.openBucket(ctx, dir+"/")
+	if err != nil {
+		return err
+	}
+	defer b.closeBucket(bucket)
+	iter := bucket.List(&blob.ListOptions{Prefix: prefix})
 	for {
 		obj, err := iter.Next(ctx)
 		if err == io.EOF {
-			break
+			return nil
 		}
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if !ifFileObject(obj) {
+			continue
 		}
-		if ifFileObject(obj) {
-			fName := path.Join(dir, obj.Key)
-			//file, err := b.Get(ctx, fName)
-			//if err != nil {
-			//	return nil, err
-			//}
-			objects = append(objects, fName)
+		err = fn(model.ObjectInfo{
+			Path:    path.Join(dir, strings.TrimPrefix(obj.Key, prefix)),
+			Size:    obj.Size,
+			ModTime: obj.ModTime,
+			MD5:     hex.EncodeToString(obj.MD5),
+		})
+		if err != nil {
+			return err
 		}
 	}
-	return objects, nil
 }
 
-func (b *Blob) openBucket(ctx context.Context, dir string) (*blob.Bucket, error) {
-	bucket, err := blob.OpenBucket(ctx, b.storageURL)
-	if err != nil {
-		return nil, err
+// openBucket opens the bucket and returns the key of filepath inside it. A filepath ending
+// in a slash is a directory, its key is the listing prefix of the directory.
+func (b *Blob) openBucket(ctx context.Context, filepath string) (*blob.Bucket, string, error) {
+	key := strings.TrimLeft(path.Join(b.prefix, filepath), "/")
+	if key == "." {
+		key = ""
+	}
+	if strings.HasSuffix(filepath, "/") && key != "" {
+		key += "/"
 	}
-	suffix := strings.Trim(path.Join(b.prefix, dir), "/") + "/"
-	if suffix == string(os.PathSeparator) {
-		return bucket, nil
+	if b.shared != nil {
+		return b.shared, key, nil
 	}
-	return blob.PrefixedBucket(bucket, suffix), nil
+	var bucket *blob.Bucket
+	var err error
+	if b.open != nil {
+		bucket, err = b.open(ctx)
+	} else {
+		bucket, err = blob.OpenBucket(ctx, b.storageURL)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return bucket, key, nil
 }
 
 func ifFileObject(obj *blob.ListObject) bool {
@@ -101,10 +217,39 @@ func ifFileObject(obj *blob.ListObject) bool {
 	return false
 }
 
-func closeBucket(bucket *blob.Bucket) {
+func (b *Blob) closeBucket(bucket *blob.Bucket) {
+	if bucket == b.shared {
+		return
+	}
 	closeErr := bucket.Close()
 	if closeErr != nil {
 		err := fmt.Errorf("failed to close bucket: %s", closeErr)
 		fmt.Print(err)
 	}
 }
+
+// IsNotFound reports whether err means that the object doesn't exist.
+func IsNotFound(err error) bool {
+	return gcerrors.Code(err) == gcerrors.NotFound
+}
+
+// bucketReader and bucketWriter close their bucket once they are closed.
+type bucketReader struct {
+	*blob.Reader
+	close func()
+}
+
+func (r *bucketReader) Close() error {
+	defer r.close()
+	return r.Reader.Close()
+}
+
+type bucketWriter struct {
+	*blob.Writer
+	close func()
+}
+
+func (w *bucketWriter) Close() error {
+	defer w.close()
+	return w.Writer.Close()
+}
@@ -0,0 +1,172 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pritamdas99/solr-dump/model"
+)
+
+func newLocal(t *testing.T, dir string, prefix string) *Blob {
+	t.Helper()
+	bl, err := NewBlob(&model.BackupStorage{Storage: model.Storage{
+		Provider: model.ProviderLocal,
+		Local:    &model.Local{Path: dir, Prefix: prefix},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bl
+}
+
+func newMemory(t *testing.T, name string, prefix string) *Blob {
+	t.Helper()
+	bl, err := NewBlob(&model.BackupStorage{Storage: model.Storage{
+		Provider: model.ProviderMemory,
+		Memory:   &model.Memory{Name: name, Prefix: prefix},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bl
+}
+
+func TestProviders(t *testing.T) {
+	providers := map[string]func(t *testing.T) *Blob{
+		"local": func(t *testing.T) *Blob {
+			return newLocal(t, t.TempDir(), "backups")
+		},
+		"memory": func(t *testing.T) *Blob {
+			return newMemory(t, t.Name(), "backups")
+		},
+	}
+	for name, newBlob := range providers {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			bl := newBlob(t)
+			objects := map[string]string{
+				"a/b.txt":   "b",
+				"a/c/d.txt": "dd",
+				"e.txt":     "eee",
+			}
+			for p, data := range objects {
+				if err := bl.Put(ctx, p, strings.NewReader(data)); err != nil {
+					t.Fatalf("put %s: %v", p, err)
+				}
+			}
+
+			for p, data := range objects {
+				got, err := bl.Get(ctx, p)
+				if err != nil || string(got) != data {
+					t.Errorf("get %s = %q, %v, want %q", p, got, err, data)
+				}
+				info, err := bl.Stat(ctx, p)
+				if err != nil || info.Size != int64(len(data)) {
+					t.Errorf("stat %s = %+v, %v, want size %d", p, info, err, len(data))
+				}
+			}
+
+			list, err := bl.List(ctx, "a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(list)
+			if want := []string{"a/b.txt", "a/c/d.txt"}; !reflect.DeepEqual(list, want) {
+				t.Errorf("list a = %v, want %v", list, want)
+			}
+			all, err := bl.List(ctx, "/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(all) != len(objects) {
+				t.Errorf("list / = %v, want %d objects", all, len(objects))
+			}
+
+			stop := errors.New("stop")
+			walked := 0
+			err = bl.Walk(ctx, "/", func(model.ObjectInfo) error {
+				walked++
+				return stop
+			})
+			if err != stop || walked != 1 {
+				t.Errorf("walk returned %v after %d objects, want it to stop at the first error", err, walked)
+			}
+
+			if err := bl.Delete(ctx, "a/b.txt"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := bl.Get(ctx, "a/b.txt"); !IsNotFound(err) {
+				t.Errorf("get of a deleted object returned %v, want not found", err)
+			}
+			if _, err := bl.Stat(ctx, "missing"); !IsNotFound(err) {
+				t.Errorf("stat of a missing object returned %v, want not found", err)
+			}
+		})
+	}
+}
+
+func TestNewWriterAbort(t *testing.T) {
+	bl := newMemory(t, t.Name(), "")
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err := bl.NewWriter(ctx, "obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("partial")); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := w.Close(); err == nil {
+		t.Error("close succeeded after the context was cancelled")
+	}
+	if _, err := bl.Stat(context.Background(), "obj"); !IsNotFound(err) {
+		t.Errorf("stat of an aborted object returned %v, want not found", err)
+	}
+}
+
+func TestLocalLayout(t *testing.T) {
+	dir := t.TempDir()
+	bl := newLocal(t, dir, "backups")
+	if err := bl.Put(context.Background(), "c1-backup/c1/backup_0.properties", strings.NewReader("x")); err != nil {
+		t.Fatal(err)
+	}
+
+	// objects are plain files below the prefix, without sidecar files or leftover temp files
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(dir, p)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"backups/c1-backup/c1/backup_0.properties"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("files = %v, want %v", files, want)
+	}
+
+	if _, err := NewBlob(&model.BackupStorage{Storage: model.Storage{Provider: model.ProviderLocal, Local: &model.Local{}}}); err == nil {
+		t.Error("local storage without a path was accepted")
+	}
+}
+
+func TestMemoryBucketsAreShared(t *testing.T) {
+	ctx := context.Background()
+	if err := newMemory(t, t.Name(), "").Put(ctx, "obj", strings.NewReader("x")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newMemory(t, t.Name(), "").Get(ctx, "obj"); err != nil {
+		t.Errorf("bucket of the same name doesn't hold the object: %v", err)
+	}
+	if _, err := newMemory(t, t.Name()+"-other", "").Get(ctx, "obj"); !IsNotFound(err) {
+		t.Errorf("bucket of another name returned %v, want not found", err)
+	}
+}
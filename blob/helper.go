@@ -1,45 +1,241 @@
 package blob
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"github.com/pritamdas99/solr-dump/model"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 
-	_ "gocloud.dev/blob/azureblob"
-	_ "gocloud.dev/blob/gcsblob"
-	_ "gocloud.dev/blob/s3blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/azureblob"
+	_ "gocloud.dev/blob/fileblob"
+	"gocloud.dev/blob/gcsblob"
+	"gocloud.dev/blob/memblob"
+	"gocloud.dev/blob/s3blob"
+	"gocloud.dev/gcp"
+	"golang.org/x/oauth2/google"
 )
 
 const (
 	gcsPrefix   = "gs://"
-	s3Prefix    = "s3://"
 	azurePrefix = "azblob://"
+	filePrefix  = "file://"
 )
 
+var (
+	memoryBucketsMu sync.Mutex
+	memoryBuckets   = map[string]*blob.Bucket{}
+)
+
+// gcsScope is the scope gocloud requests for the application default credentials.
+const gcsScope = "https://www.googleapis.com/auth/cloud-platform"
+
 func gcsBlob(bs *model.BackupStorage) (*Blob, error) {
+	gcs := bs.Storage.Gcs
+	if gcs == nil {
+		return nil, fmt.Errorf("gcs storage is not configured")
+	}
+	key := []byte(gcs.ServiceAccountKey)
+	if len(key) == 0 && gcs.CredentialsFile != "" {
+		var err error
+		if key, err = os.ReadFile(gcs.CredentialsFile); err != nil {
+			return nil, fmt.Errorf("failed to read gcs credentials file: %v", err)
+		}
+	}
+	if len(key) == 0 {
+		return &Blob{
+			storageURL: strings.Join([]string{gcsPrefix, gcs.Bucket}, ""),
+			prefix:     gcs.Prefix,
+		}, nil
+	}
+
+	creds, err := google.CredentialsFromJSON(context.TODO(), key, gcsScope)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gcs service account key: %v", err)
+	}
+	client, err := gcp.NewHTTPClient(gcp.DefaultTransport(), gcp.CredentialsTokenSource(creds))
+	if err != nil {
+		return nil, err
+	}
 	return &Blob{
-		storageURL: strings.Join([]string{gcsPrefix, bs.Storage.Gcs.Bucket}, ""),
-		prefix:     bs.Storage.Gcs.Prefix,
+		open: func(ctx context.Context) (*blob.Bucket, error) {
+			return gcsblob.OpenBucket(ctx, client, gcs.Bucket, nil)
+		},
+		prefix: gcs.Prefix,
 	}, nil
 }
 
 func azureBlob(bs *model.BackupStorage) (*Blob, error) {
+	az := bs.Storage.Azure
+	if az == nil {
+		return nil, fmt.Errorf("azure storage is not configured")
+	}
+	if az.AccountKey != "" && az.SASToken != "" {
+		return nil, fmt.Errorf("azure account key and sas token are mutually exclusive")
+	}
+	if az.AccountKey == "" && az.SASToken == "" {
+		storageURL := strings.Join([]string{azurePrefix, az.Container}, "")
+		if az.Account != "" {
+			storageURL += "?storage_account=" + url.QueryEscape(az.Account)
+		}
+		return &Blob{
+			storageURL: storageURL,
+			prefix:     az.Prefix,
+		}, nil
+	}
+
+	// the domain and protocol are still taken from the AZURE_STORAGE_* env vars
+	opts := azureblob.NewDefaultServiceURLOptions()
+	if az.Account != "" {
+		opts.AccountName = az.Account
+	}
+	opts.SASToken = strings.TrimPrefix(az.SASToken, "?")
+	serviceURL, err := azureblob.NewServiceURL(opts)
+	if err != nil {
+		return nil, err
+	}
+	containerURL, err := url.JoinPath(string(serviceURL), az.Container)
+	if err != nil {
+		return nil, err
+	}
+	var client *container.Client
+	if az.AccountKey != "" {
+		cred, err := container.NewSharedKeyCredential(opts.AccountName, az.AccountKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid azure account key: %v", err)
+		}
+		client, err = container.NewClientWithSharedKeyCredential(containerURL, cred, nil)
+		if err != nil {
+			return nil, err
+		}
+	} else if client, err = container.NewClientWithNoCredential(containerURL, nil); err != nil {
+		return nil, err
+	}
 	return &Blob{
-		storageURL: strings.Join([]string{azurePrefix, bs.Storage.Azure.Container}, ""),
-		prefix:     bs.Storage.Azure.Prefix,
+		open: func(ctx context.Context) (*blob.Bucket, error) {
+			return azureblob.OpenBucket(ctx, client, nil)
+		},
+		prefix: az.Prefix,
 	}, nil
 }
 
 func s3Blob(bs *model.BackupStorage) (*Blob, error) {
-	var storageUrl string
-	storageUrl = s3Prefix + bs.Storage.S3.Bucket + "?s3ForcePathStyle=true"
-	if bs.Storage.S3.Region != "" {
-		storageUrl += "&region=" + bs.Storage.S3.Region
+	s3 := bs.Storage.S3
+	if s3 == nil {
+		return nil, fmt.Errorf("s3 storage is not configured")
+	}
+	if (s3.AccessKeyId == "") != (s3.SecretAccessKey == "") {
+		return nil, fmt.Errorf("s3 access key id and secret access key must be set together")
+	}
+	config := aws.NewConfig().WithS3ForcePathStyle(!s3.VirtualHostStyle)
+	if s3.Region != "" {
+		config.WithRegion(s3.Region)
+	}
+	if s3.Endpoint != "" {
+		config.WithEndpoint(s3.Endpoint)
+	}
+	switch {
+	case s3.AccessKeyId != "":
+		config.WithCredentials(credentials.NewStaticCredentials(s3.AccessKeyId, s3.SecretAccessKey, s3.SessionToken))
+	case s3.CredentialsFile != "":
+		config.WithCredentials(credentials.NewSharedCredentials(s3.CredentialsFile, s3.Profile))
+	}
+	var transport *http.Transport
+	var tlsConfig *tls.Config
+	if s3.InsecureSkipVerify || s3.CABundle != "" {
+		var err error
+		if tlsConfig, err = newTLSConfig(s3.CABundle, s3.InsecureSkipVerify); err != nil {
+			return nil, err
+		}
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+		config.WithHTTPClient(&http.Client{Transport: transport})
+	}
+	// the shared config is read like it is for s3:// urls
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *config,
+		Profile:           s3.Profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 session: %v", err)
+	}
+	if transport != nil {
+		// set after the session is created, which replaces the root CAs with those of AWS_CA_BUNDLE
+		transport.TLSClientConfig = tlsConfig
+	}
+	opts := &s3blob.Options{}
+	if s3.SSEKMSKeyId != "" {
+		opts.EncryptionType = types.ServerSideEncryptionAwsKms
+		opts.KMSEncryptionID = s3.SSEKMSKeyId
+	}
+	return &Blob{
+		open: func(ctx context.Context) (*blob.Bucket, error) {
+			return s3blob.OpenBucket(ctx, sess, s3.Bucket, opts)
+		},
+		prefix: s3.Prefix,
+	}, nil
+}
+
+// newTLSConfig trusts the system CAs and those of the PEM file caBundle.
+func newTLSConfig(caBundle string, insecureSkipVerify bool) (*tls.Config, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if caBundle != "" {
+		data, err := os.ReadFile(caBundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca bundle: %v", err)
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in ca bundle %s", caBundle)
+		}
+	}
+	return &tls.Config{RootCAs: pool, InsecureSkipVerify: insecureSkipVerify}, nil
+}
+
+func localBlob(bs *model.BackupStorage) (*Blob, error) {
+	if bs.Storage.Local == nil || bs.Storage.Local.Path == "" {
+		return nil, fmt.Errorf("local storage path is not configured")
+	}
+	dir, err := filepath.Abs(bs.Storage.Local.Path)
+	if err != nil {
+		return nil, err
+	}
+	// Temp files are written next to the target so that the final rename doesn't cross mount points,
+	// no .attrs sidecar files are written beside the backups.
+	return &Blob{
+		storageURL: filePrefix + filepath.ToSlash(dir) + "?create_dir=true&no_tmp_dir=true&metadata=skip",
+		prefix:     bs.Storage.Local.Prefix,
+	}, nil
+}
+
+func memoryBlob(bs *model.BackupStorage) (*Blob, error) {
+	mem := bs.Storage.Memory
+	if mem == nil {
+		mem = &model.Memory{}
 	}
-	if bs.Storage.S3.Endpoint != "" {
-		storageUrl += "&endpoint=" + bs.Storage.S3.Endpoint
+	memoryBucketsMu.Lock()
+	defer memoryBucketsMu.Unlock()
+	bucket, ok := memoryBuckets[mem.Name]
+	if !ok {
+		bucket = memblob.OpenBucket(nil)
+		memoryBuckets[mem.Name] = bucket
 	}
 	return &Blob{
-		storageURL: storageUrl,
-		prefix:     bs.Storage.S3.Prefix,
+		shared: bucket,
+		prefix: mem.Prefix,
 	}, nil
 }
@@ -4,6 +4,8 @@ Copyright © 2024 NAME HERE <EMAIL ADDRESS>
 package main
 
 import (
+	"os"
+
 	cmds "github.com/pritamdas99/solr-dump/pkg/cmd"
 	_ "gocloud.dev/blob/fileblob"
 	_ "gocloud.dev/blob/memblob"
@@ -14,7 +16,9 @@ func main() {
 	rootCmd := cmds.NewRootCmd()
 
 	if err := rootCmd.Execute(); err != nil {
-		klog.Warning(err)
+		klog.Error(err)
+		klog.Flush()
+		os.Exit(cmds.ExitCode(err))
 	}
 
 }
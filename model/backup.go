@@ -0,0 +1,50 @@
+package model
+
+import "time"
+
+// BackupPoint is a single incremental backup point, read from backup_N.properties.
+type BackupPoint struct {
+	ID             int        `json:"id"`
+	StartTime      *time.Time `json:"startTime,omitempty"`
+	EndTime        *time.Time `json:"endTime,omitempty"`
+	IndexFileCount int        `json:"indexFileCount,omitempty"`
+	IndexSizeMB    float64    `json:"indexSizeMB,omitempty"`
+	SolrVersion    string     `json:"solrVersion,omitempty"`
+	// RunId and NumDocs are taken from the manifest of the run that created the backup point.
+	RunId   string `json:"runId,omitempty"`
+	NumDocs *int64 `json:"numDocs,omitempty"`
+}
+
+type CollectionBackup struct {
+	Name         string        `json:"name"`
+	Points       []BackupPoint `json:"points,omitempty"`
+	Size         int64         `json:"size"`
+	LastModified time.Time     `json:"lastModified"`
+}
+
+// BackupInfo describes everything stored under <backupName>/ in the backup storage.
+type BackupInfo struct {
+	Name         string             `json:"name"`
+	Collections  []CollectionBackup `json:"collections"`
+	Size         int64              `json:"size"`
+	LastModified time.Time          `json:"lastModified"`
+}
+
+// PrunedPoint is a backup point removed by the retention policy, or selected for removal in a dry run.
+type PrunedPoint struct {
+	Backup     string     `json:"backup"`
+	Collection string     `json:"collection"`
+	ID         int        `json:"id"`
+	Taken      *time.Time `json:"taken,omitempty"`
+	RunId      string     `json:"runId,omitempty"`
+	Reason     string     `json:"reason"`
+	Deleted    bool       `json:"deleted"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// PruneReport lists the backup points and the backup runs whose metadata was pruned.
+type PruneReport struct {
+	DryRun bool          `json:"dryRun"`
+	Points []PrunedPoint `json:"points"`
+	Runs   []string      `json:"runs"`
+}
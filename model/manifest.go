@@ -0,0 +1,156 @@
+package model
+
+import "time"
+
+type ReplicaManifest struct {
+	Name string `json:"name"`
+	Core string `json:"core,omitempty"`
+	Node string `json:"node,omitempty"`
+	Type string `json:"type,omitempty"`
+}
+
+type ShardManifest struct {
+	Name     string            `json:"name"`
+	Range    string            `json:"range,omitempty"`
+	Replicas []ReplicaManifest `json:"replicas,omitempty"`
+}
+
+// CollectionManifest records the backup of a single collection.
+type CollectionManifest struct {
+	Name              string           `json:"name"`
+	BackupName        string           `json:"backupName"`
+	BackupId          *int             `json:"backupId,omitempty"`
+	AsyncId           string           `json:"asyncId,omitempty"`
+	Status            CollectionStatus `json:"status"`
+	ConfigName        string           `json:"configName,omitempty"`
+	Router            string           `json:"router,omitempty"`
+	ReplicationFactor int              `json:"replicationFactor,omitempty"`
+	Shards            []ShardManifest  `json:"shards,omitempty"`
+	NumDocs           *int64           `json:"numDocs,omitempty"`
+	// CreateParams are the collection creation parameters reported by CLUSTERSTATUS.
+	CreateParams map[string]string `json:"createParams,omitempty"`
+	// UniqueKey and Sample identify a few documents taken right before the backup, they are
+	// compared with the restored documents by verify --restore-test.
+	UniqueKey string      `json:"uniqueKey,omitempty"`
+	Sample    []DocSample `json:"sample,omitempty"`
+	// Dump is set instead of BackupId for a logical dump.
+	Dump      *DumpManifest `json:"dump,omitempty"`
+	StartTime *time.Time    `json:"startTime,omitempty"`
+	EndTime   *time.Time    `json:"endTime,omitempty"`
+}
+
+// DumpManifest records the chunk files of the logical dump of a collection.
+type DumpManifest struct {
+	// Path is the directory of the chunks, <collection>-dump/<collection>/<runId>.
+	Path string `json:"path"`
+	// Format is jsonl, csv or parquet. The columns of csv and parquet chunks are described by
+	// the schema file in Path.
+	Format       string `json:"format"`
+	Schema       string `json:"schema,omitempty"`
+	SchemaSHA256 string `json:"schemaSha256,omitempty"`
+	// Compression is the codec of the chunks, or of the pages of parquet chunks, which aren't
+	// compressed as a whole.
+	Compression      string `json:"compression,omitempty"`
+	CompressionLevel int    `json:"compressionLevel,omitempty"`
+	// Method is how the documents were read, cursor or export.
+	Method    string `json:"method"`
+	UniqueKey string `json:"uniqueKey"`
+	NumDocs   int64  `json:"numDocs"`
+	// Filter selected the dumped documents and fields. Partial is set if the filter has a query or
+	// selects fields, or if the dump stopped at MaxDocs with documents left. Importing it doesn't
+	// reproduce the collection.
+	Filter  *DumpFilter `json:"filter,omitempty"`
+	Partial bool        `json:"partial,omitempty"`
+	// Encryption is set if the chunks are encrypted.
+	Encryption *Encryption     `json:"encryption,omitempty"`
+	Chunks     []ChunkManifest `json:"chunks"`
+}
+
+// Encryption describes the envelope encryption of the objects solr-dump wrote. Every object holds
+// its own data key, wrapped by the key encryption key KeyId of KeyProvider.
+type Encryption struct {
+	Algorithm   string `json:"algorithm"`
+	KeyProvider string `json:"keyProvider"`
+	KeyId       string `json:"keyId"`
+}
+
+// DumpSchema describes the columns of the csv and parquet chunks of a logical dump.
+type DumpSchema struct {
+	Collection string      `json:"collection"`
+	UniqueKey  string      `json:"uniqueKey"`
+	Fields     []DumpField `json:"fields"`
+}
+
+type DumpField struct {
+	Name string `json:"name"`
+	// Type is the column type: string, int32, int64, float, double, boolean or timestamp.
+	// Values of multiValued fields are written as json arrays.
+	Type        string `json:"type"`
+	SolrType    string `json:"solrType"`
+	MultiValued bool   `json:"multiValued,omitempty"`
+}
+
+// DumpFilter selects part of a collection for a logical dump.
+type DumpFilter struct {
+	Query         string   `json:"query,omitempty"`
+	FilterQueries []string `json:"filterQueries,omitempty"`
+	Fields        []string `json:"fields,omitempty"`
+	// MaxDocs limits the number of dumped documents, zero means no limit.
+	MaxDocs int64 `json:"maxDocs,omitempty"`
+}
+
+// IsZero reports whether the filter selects every document with every field.
+func (f DumpFilter) IsZero() bool {
+	return (f.Query == "" || f.Query == "*:*") && len(f.FilterQueries) == 0 && len(f.Fields) == 0 && f.MaxDocs <= 0
+}
+
+type ChunkManifest struct {
+	Name string `json:"name"`
+	Docs int64  `json:"docs"`
+	// Compression is the codec the chunk file is compressed with, empty if it isn't.
+	Compression string `json:"compression,omitempty"`
+	// Size and SHA256 are the size and hex encoded sha256 of the chunk file, before it is encrypted.
+	// Dumps written by older versions have no SHA256.
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// DocSample is the sha256 of the stored fields of a document, without _version_.
+type DocSample struct {
+	ID   string `json:"id"`
+	Hash string `json:"hash"`
+}
+
+type ClusterManifest struct {
+	Name        string           `json:"name,omitempty"`
+	Namespace   string           `json:"namespace,omitempty"`
+	SolrVersion string           `json:"solrVersion,omitempty"`
+	Metadata    *ClusterMetadata `json:"metadata,omitempty"`
+}
+
+// ClusterMetadata is the cluster wide state exported along with the collection backups.
+type ClusterMetadata struct {
+	// ConfigSets are stored as zip files in .solrdump/runs/<runId>/configsets/<name>.zip.
+	ConfigSets []string `json:"configSets,omitempty"`
+	// ConfigSetSHA256 maps a config set to the hex encoded sha256 of its zip file.
+	ConfigSetSHA256 map[string]string            `json:"configSetSha256,omitempty"`
+	Aliases         map[string]string            `json:"aliases,omitempty"`
+	AliasProperties map[string]map[string]string `json:"aliasProperties,omitempty"`
+	// Properties is the content of clusterprops.json.
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+// Manifest describes what a backup run wrote to the backup storage. It is stored in
+// .solrdump/runs/<runId>/manifest.json, its sha256 in manifest.json.sha256.
+type Manifest struct {
+	RunId       string     `json:"runId"`
+	ToolVersion string     `json:"toolVersion,omitempty"`
+	Mode        BackupMode `json:"mode,omitempty"`
+	// Encryption is set if the manifest, the logical dumps and the config sets of the run are
+	// encrypted. The index files of physical backups are written by solr and never encrypted.
+	Encryption  *Encryption          `json:"encryption,omitempty"`
+	Cluster     ClusterManifest      `json:"cluster"`
+	StartTime   time.Time            `json:"startTime"`
+	EndTime     time.Time            `json:"endTime"`
+	Collections []CollectionManifest `json:"collections"`
+}
@@ -1,40 +1,119 @@
 package model
 
-import "context"
+import (
+	"context"
+	"io"
+	"time"
+)
 
 type Provider string
 
 type Blob interface {
 	Get(ctx context.Context, filepath string) ([]byte, error)
+	Put(ctx context.Context, filepath string, r io.Reader) error
+	Delete(ctx context.Context, filepath string) error
+	Stat(ctx context.Context, filepath string) (*ObjectInfo, error)
+	// NewReader and NewWriter stream an object, the caller must close them.
+	NewReader(ctx context.Context, filepath string) (io.ReadCloser, error)
+	NewWriter(ctx context.Context, filepath string) (io.WriteCloser, error)
 	List(ctx context.Context, dir string) ([]string, error)
+	ListInfo(ctx context.Context, dir string) ([]ObjectInfo, error)
+	// Walk calls fn for every object under dir, recursively. It stops at the first error returned by fn.
+	Walk(ctx context.Context, dir string, fn func(ObjectInfo) error) error
+}
+
+type ObjectInfo struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	// ETag and MD5 (hex encoded) are only set when the provider reports them.
+	ETag string `json:"etag,omitempty"`
+	MD5  string `json:"md5,omitempty"`
 }
 
+// MetadataDir is the directory in the backup storage where solr-dump keeps its own files.
+// It never holds a solr backup.
+const MetadataDir = ".solrdump"
+
 const (
 	ProviderS3    Provider = "S3"
 	ProviderGCS   Provider = "GCS"
 	ProviderAZURE Provider = "AZURE"
+	// ProviderLocal stores the backups in a local directory, e.g. a mounted PVC or NFS share.
+	ProviderLocal Provider = "LOCAL"
+	// ProviderMemory keeps the backups in memory for the lifetime of the process. It is meant for tests.
+	ProviderMemory Provider = "MEMORY"
 )
 
+// S3 credentials are taken from AccessKeyId and SecretAccessKey, from Profile, or else from the
+// environment: env vars, the shared files, IRSA or the instance role.
 type S3 struct {
-	Bucket   string
-	Region   string
-	Endpoint string
-	Prefix   string
+	Bucket          string `json:"bucket,omitempty"`
+	Region          string `json:"region,omitempty"`
+	Endpoint        string `json:"endpoint,omitempty"`
+	Prefix          string `json:"prefix,omitempty"`
+	AccessKeyId     string `json:"accessKeyId,omitempty"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty"`
+	SessionToken    string `json:"sessionToken,omitempty"`
+	// Profile selects a profile of the shared config and credentials files, CredentialsFile replaces
+	// ~/.aws/credentials.
+	Profile         string `json:"profile,omitempty"`
+	CredentialsFile string `json:"credentialsFile,omitempty"`
+	// VirtualHostStyle addresses the bucket as <bucket>.<endpoint> instead of <endpoint>/<bucket>. Path
+	// style is the default, most S3 compatible stores require it.
+	VirtualHostStyle   bool `json:"virtualHostStyle,omitempty"`
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+	// CABundle is a PEM file of the CAs trusted for the endpoint, in addition to the system CAs.
+	CABundle string `json:"caBundle,omitempty"`
+	// SSEKMSKeyId encrypts the written objects server side with this KMS key (aws:kms).
+	SSEKMSKeyId string `json:"sseKmsKeyId,omitempty"`
 }
+
+// GCS credentials are taken from the service account key ServiceAccountKey or CredentialsFile, or else
+// from the application default credentials.
 type GCS struct {
-	Bucket string
-	Prefix string
+	Bucket            string `json:"bucket,omitempty"`
+	Prefix            string `json:"prefix,omitempty"`
+	CredentialsFile   string `json:"credentialsFile,omitempty"`
+	ServiceAccountKey string `json:"serviceAccountKey,omitempty"`
 }
+
+// AZURE authenticates with AccountKey or SASToken if one is set, otherwise with the AZURE_STORAGE_*
+// env vars or the default azure credential.
 type AZURE struct {
-	Container string
-	Prefix    string
+	Container  string `json:"container,omitempty"`
+	Prefix     string `json:"prefix,omitempty"`
+	Account    string `json:"account,omitempty"`
+	AccountKey string `json:"accountKey,omitempty"`
+	SASToken   string `json:"sasToken,omitempty"`
 }
+type Local struct {
+	Path   string `json:"path,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// Memory storages with the same Name share their objects within a process.
+type Memory struct {
+	Name   string `json:"name,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// SecretRef names a kubernetes secret.
+type SecretRef struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
 type Storage struct {
-	Provider Provider
-	S3       *S3
-	Gcs      *GCS
-	Azure    *AZURE
+	Provider Provider `json:"provider,omitempty"`
+	S3       *S3      `json:"s3,omitempty"`
+	Gcs      *GCS     `json:"gcs,omitempty"`
+	Azure    *AZURE   `json:"azure,omitempty"`
+	Local    *Local   `json:"local,omitempty"`
+	Memory   *Memory  `json:"memory,omitempty"`
+	// Secret holds credentials of the provider, they fill the credentials that aren't set explicitly.
+	Secret *SecretRef `json:"secret,omitempty"`
 }
 type BackupStorage struct {
-	Storage Storage
+	Storage Storage `json:"storage"`
 }
@@ -0,0 +1,66 @@
+package model
+
+import "time"
+
+type CollectionStatus string
+
+const (
+	CollectionPending   CollectionStatus = "Pending"
+	CollectionSubmitted CollectionStatus = "Submitted"
+	CollectionCompleted CollectionStatus = "Completed"
+	CollectionFailed    CollectionStatus = "Failed"
+	CollectionNotFound  CollectionStatus = "NotFound"
+	CollectionTimedOut  CollectionStatus = "TimedOut"
+)
+
+// BackupMode selects how collections are backed up. A physical backup copies the index files
+// through the solr backup api, a logical dump reads the documents and writes them to the backup storage.
+type BackupMode string
+
+const (
+	ModePhysical BackupMode = "physical"
+	ModeLogical  BackupMode = "logical"
+)
+
+type RunStatus string
+
+const (
+	RunSucceeded       RunStatus = "Succeeded"
+	RunPartiallyFailed RunStatus = "PartiallyFailed"
+	RunFailed          RunStatus = "Failed"
+)
+
+// CollectionReport is the outcome of the backup or restore of a single collection.
+type CollectionReport struct {
+	Collection string           `json:"collection"`
+	Source     string           `json:"source,omitempty"`
+	BackupName string           `json:"backupName,omitempty"`
+	BackupId   *int             `json:"backupId,omitempty"`
+	AsyncId    string           `json:"asyncId,omitempty"`
+	Status     CollectionStatus `json:"status"`
+	StartTime  *time.Time       `json:"startTime,omitempty"`
+	EndTime    *time.Time       `json:"endTime,omitempty"`
+	Error      string           `json:"error,omitempty"`
+	// Dump lists the chunks written by a logical dump.
+	Dump *DumpManifest `json:"dump,omitempty"`
+	// Description is the layout and document count of the collection taken when its backup was
+	// submitted. It is persisted with the state, so that the manifest of a resumed run describes the
+	// collection as it was backed up.
+	Description *CollectionManifest `json:"description,omitempty"`
+	// PriorBackupIds are the backup points in <BackupName>/<Collection>/ before the backup was
+	// submitted. The backup point created is the new one, if solr doesn't report its id.
+	PriorBackupIds []int `json:"priorBackupIds,omitempty"`
+}
+
+// Report is the machine-readable summary of a solr-dump run. While the run is in progress
+// it is also persisted as the state of the run, so that the run can be resumed.
+type Report struct {
+	RunId       string              `json:"runId"`
+	Action      string              `json:"action"`
+	Mode        BackupMode          `json:"mode,omitempty"`
+	Status      RunStatus           `json:"status,omitempty"`
+	StartTime   time.Time           `json:"startTime"`
+	EndTime     time.Time           `json:"endTime"`
+	Error       string              `json:"error,omitempty"`
+	Collections []*CollectionReport `json:"collections"`
+}
@@ -0,0 +1,85 @@
+package model
+
+type VerifyStatus string
+
+const (
+	// VerifyValid means every index file referenced by the backup point was found intact.
+	VerifyValid VerifyStatus = "Valid"
+	// VerifyInvalid means index files or shard metadata are missing or corrupted.
+	VerifyInvalid VerifyStatus = "Invalid"
+	// VerifyError means the backup point couldn't be verified, e.g. its properties are unreadable.
+	VerifyError VerifyStatus = "Error"
+)
+
+type FileProblem string
+
+const (
+	FileMissing          FileProblem = "Missing"
+	FileSizeMismatch     FileProblem = "SizeMismatch"
+	FileChecksumMismatch FileProblem = "ChecksumMismatch"
+	FileUnreadable       FileProblem = "Unreadable"
+)
+
+// FileVerification records a problem with an index file of a shard, or with a file of a logical dump.
+// Intact files are only counted.
+type FileVerification struct {
+	// File is the lucene file name, IndexFile the name it is stored under in index/.
+	File      string      `json:"file"`
+	IndexFile string      `json:"indexFile,omitempty"`
+	Problem   FileProblem `json:"problem"`
+	Detail    string      `json:"detail,omitempty"`
+}
+
+type ShardVerification struct {
+	Shard        string             `json:"shard"`
+	MetadataFile string             `json:"metadataFile"`
+	Status       VerifyStatus       `json:"status"`
+	Files        int                `json:"files"`
+	Size         int64              `json:"size"`
+	Problems     []FileVerification `json:"problems,omitempty"`
+	Error        string             `json:"error,omitempty"`
+}
+
+// CollectionVerification is the result of verifying one backup point of a collection.
+type CollectionVerification struct {
+	Backup     string              `json:"backup"`
+	Collection string              `json:"collection"`
+	BackupId   int                 `json:"backupId"`
+	RunId      string              `json:"runId,omitempty"`
+	Status     VerifyStatus        `json:"status"`
+	Shards     []ShardVerification `json:"shards,omitempty"`
+	// Dump is set instead of Shards for a logical dump, which has no backup id.
+	Dump *DumpVerification `json:"dump,omitempty"`
+	// SolrCheck is the result of asking solr to list the backup point, if requested.
+	SolrCheck   string             `json:"solrCheck,omitempty"`
+	RestoreTest *RestoreTestResult `json:"restoreTest,omitempty"`
+	Error       string             `json:"error,omitempty"`
+}
+
+// DumpVerification is the result of comparing the chunks of a logical dump with the sizes and sha256
+// recorded in its manifest.
+type DumpVerification struct {
+	Path     string             `json:"path"`
+	Status   VerifyStatus       `json:"status"`
+	Files    int                `json:"files"`
+	Size     int64              `json:"size"`
+	Problems []FileVerification `json:"problems,omitempty"`
+}
+
+// RestoreTestResult compares a backup point restored into a scratch collection with
+// the document count and sample recorded in the manifest at backup time.
+type RestoreTestResult struct {
+	ScratchCollection string `json:"scratchCollection"`
+	Passed            bool   `json:"passed"`
+	ExpectedDocs      *int64 `json:"expectedDocs,omitempty"`
+	RestoredDocs      *int64 `json:"restoredDocs,omitempty"`
+	SampleSize        int    `json:"sampleSize"`
+	// SampleMismatches lists the sampled documents that are missing or differ after the restore.
+	SampleMismatches []string `json:"sampleMismatches,omitempty"`
+	Error            string   `json:"error,omitempty"`
+}
+
+type VerifyReport struct {
+	Status      VerifyStatus              `json:"status"`
+	Collections []*CollectionVerification `json:"collections"`
+}
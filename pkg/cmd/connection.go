@@ -0,0 +1,21 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	solr_dump "github.com/pritamdas99/solr-dump/pkg/solr-dump"
+	"github.com/spf13/pflag"
+)
+
+func addConnectionFlags(fs *pflag.FlagSet, opts *solr_dump.ConnectionOptions) {
+	fs.StringVar(&opts.Kubeconfig, "kubeconfig", "", "Path to the kubeconfig file. The in-cluster config is used by default")
+	fs.StringVar(&opts.KubeContext, "context", "", "Name of the kubeconfig context to use")
+	fs.StringVar(&opts.SolrURL, "solr-url", "", "Url of solr, e.g. https://solr.example.com:8983. If set, the KubeDB Solr object is not looked up")
+	fs.StringVar(&opts.Username, "username", "", "Username for basic auth with --solr-url, requires --password-file")
+	fs.StringVar(&opts.PasswordFile, "password-file", "", "File holding the password for basic auth with --solr-url")
+	fs.StringVar(&opts.CACertFile, "ca-cert-file", "", "CA certificate to verify the solr server certificate with --solr-url")
+	fs.StringVar(&opts.ClientCertFile, "client-cert-file", "", "Client certificate for mutual TLS with --solr-url")
+	fs.StringVar(&opts.ClientKeyFile, "client-key-file", "", "Client key for mutual TLS with --solr-url")
+	fs.BoolVar(&opts.InsecureSkipVerify, "insecure-skip-tls-verify", false, "Skip verification of the solr server certificate with --solr-url")
+}
@@ -0,0 +1,64 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	solr_dump "github.com/pritamdas99/solr-dump/pkg/solr-dump"
+	"github.com/spf13/pflag"
+)
+
+// encryptionOptions selects the key encryption key of the objects solr-dump writes to the backup storage.
+// At most one source may be set.
+type encryptionOptions struct {
+	keyFile   string
+	secret    string
+	secretKey string
+	kmsDir    string
+	kmsKeyId  string
+}
+
+var encryptionOpts encryptionOptions
+
+func addEncryptionFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&encryptionOpts.keyFile, "encryption-key-file", "", "File holding the 32 byte key encryption key, raw, base64 or hex encoded. Manifests, logical dumps and config sets are encrypted with it and decrypted when they are read")
+	fs.StringVar(&encryptionOpts.secret, "encryption-key-secret", "", "Kubernetes secret <namespace>/<name> holding the key encryption key, instead of --encryption-key-file")
+	fs.StringVar(&encryptionOpts.secretKey, "encryption-key-secret-key", "key", "Data key of the secret of --encryption-key-secret")
+	fs.StringVar(&encryptionOpts.kmsDir, "encryption-kms-dir", "", "Directory of the file based KMS stand-in, holding a key file per key id. Used with --encryption-kms-key-id instead of --encryption-key-file")
+	fs.StringVar(&encryptionOpts.kmsKeyId, "encryption-kms-key-id", "", "Id of the KMS key that wraps the data keys")
+}
+
+// getKeyWrapper returns the key wrapper of the configured key source, nil if there is none. conn selects
+// the cluster of --encryption-key-secret.
+func getKeyWrapper(conn solr_dump.ConnectionOptions) (solr_dump.KeyWrapper, error) {
+	sources := 0
+	for _, set := range []bool{encryptionOpts.keyFile != "", encryptionOpts.secret != "", encryptionOpts.kmsDir != "" || encryptionOpts.kmsKeyId != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return nil, fmt.Errorf("--encryption-key-file, --encryption-key-secret and --encryption-kms-dir are mutually exclusive")
+	}
+
+	switch {
+	case encryptionOpts.keyFile != "":
+		return solr_dump.NewFileKeyWrapper(encryptionOpts.keyFile)
+	case encryptionOpts.secret != "":
+		namespace, name, ok := strings.Cut(encryptionOpts.secret, "/")
+		if !ok || namespace == "" || name == "" {
+			return nil, fmt.Errorf("invalid --encryption-key-secret %q, expected <namespace>/<name>", encryptionOpts.secret)
+		}
+		return solr_dump.NewSecretKeyWrapper(context.TODO(), conn, namespace, name, encryptionOpts.secretKey)
+	case encryptionOpts.kmsDir != "" || encryptionOpts.kmsKeyId != "":
+		if encryptionOpts.kmsDir == "" || encryptionOpts.kmsKeyId == "" {
+			return nil, fmt.Errorf("--encryption-kms-dir and --encryption-kms-key-id must be set together")
+		}
+		return solr_dump.NewKMSKeyWrapper(solr_dump.FileKMS{Dir: encryptionOpts.kmsDir}, encryptionOpts.kmsKeyId), nil
+	}
+	return nil, nil
+}
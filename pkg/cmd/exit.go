@@ -0,0 +1,53 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+
+	"github.com/pritamdas99/solr-dump/model"
+)
+
+// Exit codes of solrdump.
+const (
+	ExitSuccess        = 0
+	ExitFailure        = 1
+	ExitPartialFailure = 2
+)
+
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// ExitCode returns the process exit code for an error returned by a command.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitSuccess
+	}
+	var ee *exitError
+	if errors.As(err, &ee) {
+		return ee.code
+	}
+	return ExitFailure
+}
+
+// runError wraps the error of a run with the exit code matching the run status.
+func runError(report *model.Report, err error) error {
+	if err == nil {
+		return nil
+	}
+	if report != nil && report.Status == model.RunPartiallyFailed {
+		return &exitError{code: ExitPartialFailure, err: err}
+	}
+	return &exitError{code: ExitFailure, err: err}
+}
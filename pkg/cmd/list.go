@@ -0,0 +1,113 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pritamdas99/solr-dump/blob"
+	"github.com/pritamdas99/solr-dump/model"
+	solr_dump "github.com/pritamdas99/solr-dump/pkg/solr-dump"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	output         string
+	outputFormats  = []string{"table", "json", "yaml"}
+	listConnection solr_dump.ConnectionOptions
+	listCmd        = &cobra.Command{
+		Use:   "list",
+		Short: "List the backups stored in the backup storage",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			storage, err := getBackupStorage(cmd.Flags(), listConnection)
+			if err != nil {
+				return err
+			}
+			bl, err := blob.NewBlob(storage)
+			if err != nil {
+				return err
+			}
+			keys, err := getKeyWrapper(listConnection)
+			if err != nil {
+				return err
+			}
+			backups, err := solr_dump.ListBackups(context.TODO(), solr_dump.NewEncryptedBlob(bl, keys))
+			if err != nil {
+				return err
+			}
+			return printBackups(os.Stdout, backups, output)
+		},
+	}
+)
+
+func NewListCmd() *cobra.Command {
+	return listCmd
+}
+
+func init() {
+	listCmd.Flags().StringVarP(&output, "output", "o", "table", fmt.Sprintf("Output format.\n\tSupported values are %v", outputFormats))
+	addConnectionFlags(listCmd.Flags(), &listConnection)
+	addStorageFlags(listCmd.Flags())
+	addEncryptionFlags(listCmd.Flags())
+}
+
+func printBackups(w io.Writer, backups []model.BackupInfo, format string) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(backups, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "yaml":
+		data, err := yaml.Marshal(backups)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 4, 3, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "BACKUP\tCOLLECTION\tBACKUP IDS\tLAST RUN\tSIZE\tLAST MODIFIED")
+		for _, bi := range backups {
+			for _, cb := range bi.Collections {
+				var ids []string
+				lastRun := "-"
+				for _, point := range cb.Points {
+					ids = append(ids, strconv.Itoa(point.ID))
+					if point.RunId != "" {
+						lastRun = point.RunId
+					}
+				}
+				_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", bi.Name, cb.Name, strings.Join(ids, ","), lastRun, humanSize(cb.Size), cb.LastModified.Format(time.RFC3339))
+			}
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format %s, supported values are %v", format, outputFormats)
+	}
+}
+
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,162 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pritamdas99/solr-dump/blob"
+	"github.com/pritamdas99/solr-dump/model"
+	solr_dump "github.com/pritamdas99/solr-dump/pkg/solr-dump"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	pruneConnection  solr_dump.ConnectionOptions
+	pruneCollections []string
+	pruneExclude     []string
+	dryRun           bool
+	pruneCmd         = &cobra.Command{
+		Use:   "prune",
+		Short: "Delete the backup points that are expired by the retention policy",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			storage, err := getBackupStorage(cmd.Flags(), pruneConnection)
+			if err != nil {
+				return err
+			}
+			policy, err := getRetentionPolicy()
+			if err != nil {
+				return err
+			}
+			if policy.IsZero() {
+				return fmt.Errorf("no retention rule is set, use --keep-last, --keep-daily, --keep-weekly, --keep-monthly or --max-age")
+			}
+			filter, err := solr_dump.NewCollectionFilter(pruneCollections, pruneExclude, "", "")
+			if err != nil {
+				return err
+			}
+			keys, err := getKeyWrapper(pruneConnection)
+			if err != nil {
+				return err
+			}
+			var pr *model.PruneReport
+			if dryRun {
+				// a dry run only reads the backup storage, solr is needed to delete backup points
+				bl, err := blob.NewBlob(storage)
+				if err != nil {
+					return err
+				}
+				pr, err = solr_dump.PlanPrune(context.TODO(), solr_dump.NewEncryptedBlob(bl, keys), filter, policy)
+				if err != nil {
+					return err
+				}
+			} else {
+				dumper, err := solr_dump.NewSolrDump(solr_dump.Options{
+					Action:     "prune",
+					DB:         db,
+					Namespace:  namespace,
+					Connection: pruneConnection,
+					Location:   location,
+					Repository: repository,
+					Storage:    storage,
+					Filter:     filter,
+					Retention:  policy,
+					Encryption: keys,
+				})
+				if err != nil {
+					return err
+				}
+				if pr, err = dumper.Prune(context.TODO()); err != nil {
+					return err
+				}
+			}
+			if err := printPruneReport(os.Stdout, pr, output); err != nil {
+				return err
+			}
+			for _, pp := range pr.Points {
+				if pp.Error != "" {
+					return fmt.Errorf("failed to delete backup point %d of %s/%s: %s", pp.ID, pp.Backup, pp.Collection, pp.Error)
+				}
+			}
+			return nil
+		},
+	}
+)
+
+func NewPruneCmd() *cobra.Command {
+	return pruneCmd
+}
+
+func init() {
+	pruneCmd.Flags().StringVarP(&db, "db", "d", "", "db instance whose backups are pruned")
+	pruneCmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Namespace of db instance")
+	pruneCmd.Flags().StringVarP(&location, "location", "l", "", "Location of the backups in the backup repository")
+	pruneCmd.Flags().StringVarP(&repository, "repository", "r", "", "Name of the solr backup repository")
+	pruneCmd.Flags().StringSliceVar(&pruneCollections, "collections", nil, "Collections to prune, by name or glob. All collections are pruned by default")
+	pruneCmd.Flags().StringSliceVar(&pruneExclude, "exclude-collections", nil, "Collections not to prune, by name or glob")
+	pruneCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only print the backup points that would be deleted")
+	pruneCmd.Flags().StringVarP(&output, "output", "o", "table", fmt.Sprintf("Output format.\n\tSupported values are %v", outputFormats))
+	addRetentionFlags(pruneCmd.Flags())
+	addConnectionFlags(pruneCmd.Flags(), &pruneConnection)
+	addStorageFlags(pruneCmd.Flags())
+	addEncryptionFlags(pruneCmd.Flags())
+}
+
+func printPruneReport(w io.Writer, pr *model.PruneReport, format string) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(pr, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "yaml":
+		data, err := yaml.Marshal(pr)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case "table":
+		state := "DELETED"
+		if pr.DryRun {
+			state = "WOULD DELETE"
+		}
+		tw := tabwriter.NewWriter(w, 0, 4, 3, ' ', 0)
+		_, _ = fmt.Fprintf(tw, "BACKUP\tCOLLECTION\tBACKUP ID\tTAKEN\tREASON\t%s\n", state)
+		for _, pp := range pr.Points {
+			taken := "-"
+			if pp.Taken != nil {
+				taken = pp.Taken.Format(time.RFC3339)
+			}
+			deleted := strconv.FormatBool(pp.Deleted || pr.DryRun)
+			if pp.Error != "" {
+				deleted = "error: " + pp.Error
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\n", pp.Backup, pp.Collection, pp.ID, taken, pp.Reason, deleted)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		for _, runId := range pr.Runs {
+			if pr.DryRun {
+				_, _ = fmt.Fprintf(w, "metadata of run %s would be deleted\n", runId)
+			} else {
+				_, _ = fmt.Fprintf(w, "deleted metadata of run %s\n", runId)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %s, supported values are %v", format, outputFormats)
+	}
+}
@@ -0,0 +1,67 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	solr_dump "github.com/pritamdas99/solr-dump/pkg/solr-dump"
+	"github.com/spf13/pflag"
+)
+
+// retentionOptions holds the retention flags, shared by the run and prune commands.
+type retentionOptions struct {
+	policy solr_dump.RetentionPolicy
+	maxAge string
+}
+
+var retentionOpts retentionOptions
+
+func addRetentionFlags(fs *pflag.FlagSet) {
+	fs.IntVar(&retentionOpts.policy.KeepLast, "keep-last", 0, "Keep the newest N backup points of every collection")
+	fs.IntVar(&retentionOpts.policy.KeepDaily, "keep-daily", 0, "Keep the newest backup point of each of the last N days with a backup")
+	fs.IntVar(&retentionOpts.policy.KeepWeekly, "keep-weekly", 0, "Keep the newest backup point of each of the last N weeks with a backup")
+	fs.IntVar(&retentionOpts.policy.KeepMonthly, "keep-monthly", 0, "Keep the newest backup point of each of the last N months with a backup")
+	fs.StringVar(&retentionOpts.maxAge, "max-age", "", "Remove backup points older than this, e.g. 30d, 2w or 12h. The latest backup point of a collection is always kept")
+}
+
+// getRetentionPolicy returns the retention policy set by the flags.
+func getRetentionPolicy() (solr_dump.RetentionPolicy, error) {
+	policy := retentionOpts.policy
+	if policy.KeepLast < 0 || policy.KeepDaily < 0 || policy.KeepWeekly < 0 || policy.KeepMonthly < 0 {
+		return policy, fmt.Errorf("--keep-* flags must not be negative")
+	}
+	if retentionOpts.maxAge != "" {
+		age, err := parseAge(retentionOpts.maxAge)
+		if err != nil {
+			return policy, err
+		}
+		policy.MaxAge = age
+	}
+	return policy, nil
+}
+
+// parseAge parses a go duration, or a number of days (30d) or weeks (2w).
+func parseAge(value string) (time.Duration, error) {
+	units := map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	}
+	for suffix, unit := range units {
+		if n, err := strconv.Atoi(strings.TrimSuffix(value, suffix)); err == nil && strings.HasSuffix(value, suffix) {
+			if n <= 0 {
+				return 0, fmt.Errorf("invalid age %q, it must be positive", value)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age <= 0 {
+		return 0, fmt.Errorf("invalid age %q, expected e.g. 30d, 2w or 12h", value)
+	}
+	return age, nil
+}
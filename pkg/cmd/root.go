@@ -16,11 +16,17 @@ func NewRootCmd() *cobra.Command {
 		Use:   "solrdump",
 		Short: "Backup restore solr",
 		Long:  `Command line tool to perform backup restore for solr`,
+		// errors are logged by main, which also sets the exit code
+		SilenceErrors: true,
+		SilenceUsage:  true,
 		PersistentPreRun: func(c *cobra.Command, args []string) {
 			flags.LoggerOptions = flags.GetOptions(c.Flags())
 		},
 	}
 	rootCmd.AddCommand(v.NewCmdVersion())
 	rootCmd.AddCommand(NewRunCmd())
+	rootCmd.AddCommand(NewListCmd())
+	rootCmd.AddCommand(NewPruneCmd())
+	rootCmd.AddCommand(NewVerifyCmd())
 	return rootCmd
 }
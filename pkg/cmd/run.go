@@ -4,30 +4,178 @@ Copyright © 2024 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"github.com/pritamdas99/solr-dump/model"
 	solr_dump "github.com/pritamdas99/solr-dump/pkg/solr-dump"
 	"k8s.io/klog/v2"
+	"os"
+	"slices"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
 // runCmd represents the run command
 var (
-	action     string
-	actions    = []string{"backup", "restore"}
-	db         string
-	namespace  string
-	location   string
-	repository string
-	runCmd     = &cobra.Command{
+	action             string
+	actions            = []string{"backup", "restore"}
+	mode               string
+	modes              = []model.BackupMode{model.ModePhysical, model.ModeLogical}
+	logicalOpts        = solr_dump.DefaultLogicalOptions()
+	db                 string
+	namespace          string
+	location           string
+	repository         string
+	collections        []string
+	excludeCollections []string
+	collectionsRegex   string
+	excludeRegex       string
+	rename             map[string]string
+	targetSuffix       string
+	fromRun            string
+	backup             string
+	backupId           int
+	asOf               string
+	connection         solr_dump.ConnectionOptions
+	reportFile         string
+	resume             string
+	stateDir           string
+	timeout            time.Duration
+	trackerOpts        = solr_dump.DefaultTrackerOptions()
+	parallelism        int
+	failFast           bool
+	maxOverseerQueue   int
+	sampleSize         int
+	clusterMetadata    bool
+	compressionOpts    = solr_dump.CompressionOptions{Codec: solr_dump.CompressionGzip}
+	runCmd             = &cobra.Command{
 		Use:   "run",
 		Short: "Launch solr-dump",
-		Run: func(cmd *cobra.Command, args []string) {
-			dumper, err := solr_dump.NewSolrDump(action, db, namespace, location, repository)
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// prune and verify have their own commands
+			if !slices.Contains(actions, action) {
+				return fmt.Errorf("unknown action %s, supported values are %v", action, actions)
+			}
+			var storage *model.BackupStorage
+			if action == "restore" || storageConfigured(cmd.Flags()) {
+				var err error
+				storage, err = getBackupStorage(cmd.Flags(), connection)
+				if err != nil {
+					return err
+				}
+			}
+			filter, err := solr_dump.NewCollectionFilter(collections, excludeCollections, collectionsRegex, excludeRegex)
+			if err != nil {
+				return err
+			}
+			keys, err := getKeyWrapper(connection)
+			if err != nil {
+				return err
+			}
+			opts := solr_dump.Options{
+				Action:       action,
+				Mode:         model.BackupMode(mode),
+				Logical:      logicalOpts,
+				Compression:  compressionOpts,
+				DB:           db,
+				Namespace:    namespace,
+				Connection:   connection,
+				Location:     location,
+				Repository:   repository,
+				Storage:      storage,
+				Filter:       filter,
+				Rename:       rename,
+				TargetSuffix: targetSuffix,
+				FromRun:      fromRun,
+				Backup:       backup,
+				Resume:       resume,
+				StateDir:     stateDir,
+				Timeout:      timeout,
+				Tracker:      trackerOpts,
+				Parallelism:  parallelism,
+				FailFast:     failFast,
+
+				MaxOverseerQueue: maxOverseerQueue,
+				SampleSize:       sampleSize,
+				ClusterMetadata:  clusterMetadata,
+				Encryption:       keys,
+			}
+			if cmd.Flags().Changed("backup-id") {
+				opts.BackupId = &backupId
+			}
+			if asOf != "" {
+				t, err := parseTime(asOf)
+				if err != nil {
+					return err
+				}
+				opts.AsOf = &t
+			}
+			if opts.BackupId != nil && opts.AsOf != nil {
+				return fmt.Errorf("--backup-id and --as-of are mutually exclusive")
+			}
+			if fromRun != "" && (opts.BackupId != nil || opts.AsOf != nil) {
+				return fmt.Errorf("--from-run can't be combined with --backup-id or --as-of")
+			}
+			if backup != "" && (action != "restore" || opts.Mode == model.ModeLogical) {
+				return fmt.Errorf("--backup only applies to the restore of physical backups")
+			}
+			if backup != "" && fromRun != "" {
+				return fmt.Errorf("--backup and --from-run are mutually exclusive")
+			}
+			opts.Retention, err = getRetentionPolicy()
+			if err != nil {
+				return err
+			}
+			if opts.Mode == model.ModeLogical && storage == nil {
+				return fmt.Errorf("a logical dump requires a backup storage")
+			}
+			if !logicalOpts.Filter.IsZero() && (opts.Mode != model.ModeLogical || action == "restore") {
+				return fmt.Errorf("--query, --filter-query, --fields and --max-docs only apply to logical dumps")
+			}
+			if logicalOpts.Method != solr_dump.ExportCursor && logicalOpts.Method != solr_dump.ExportHandler {
+				return fmt.Errorf("unknown export method %s, supported values are [%s %s]", logicalOpts.Method, solr_dump.ExportCursor, solr_dump.ExportHandler)
+			}
+			if !slices.Contains(solr_dump.Formats, logicalOpts.Format) {
+				return fmt.Errorf("unknown format %s, supported values are %v", logicalOpts.Format, solr_dump.Formats)
+			}
+			if logicalOpts.Format != solr_dump.FormatJSONL && (opts.Mode != model.ModeLogical || action == "restore") {
+				return fmt.Errorf("--format only applies to logical dumps, the format of an import is read from the dump")
+			}
+			if err := solr_dump.ValidateCompression(compressionOpts.Codec, compressionOpts.Level); err != nil {
+				return err
+			}
+			if (cmd.Flags().Changed("compression") || cmd.Flags().Changed("compression-level")) && opts.Mode != model.ModeLogical && !compressionOpts.Metadata {
+				return fmt.Errorf("--compression and --compression-level apply to logical dumps, or to the metadata with --compress-metadata")
+			}
+			if !opts.Retention.IsZero() && (action == "restore" || storage == nil || opts.Mode == model.ModeLogical) {
+				return fmt.Errorf("retention flags apply to physical backups and require a backup storage")
+			}
+			startTime := time.Now().UTC()
+			dumper, err := solr_dump.NewSolrDump(opts)
 			if err != nil {
-				klog.Error(err)
+				if reportFile != "" {
+					report := &model.Report{
+						Action:      action,
+						Status:      model.RunFailed,
+						StartTime:   startTime,
+						EndTime:     time.Now().UTC(),
+						Error:       err.Error(),
+						Collections: []*model.CollectionReport{},
+					}
+					if werr := writeReport(reportFile, report); werr != nil {
+						klog.Errorf("failed to write report file %s: %v", reportFile, werr)
+					}
+				}
+				return err
 			}
-			dumper.Execute()
+			report, err := dumper.Execute()
+			if reportFile != "" {
+				if werr := writeReport(reportFile, report); werr != nil {
+					klog.Errorf("failed to write report file %s: %v", reportFile, werr)
+				}
+			}
+			return runError(report, err)
 		},
 	}
 )
@@ -38,8 +186,74 @@ func NewRunCmd() *cobra.Command {
 
 func init() {
 	runCmd.PersistentFlags().StringVarP(&action, "action", "a", "backup", fmt.Sprintf("The operation to carry out.\n\tSupported values are %v", actions))
+	runCmd.PersistentFlags().StringVar(&mode, "mode", string(model.ModePhysical), fmt.Sprintf("How collections are backed up and restored, through the solr backup api or as a dump of their documents that is imported through the update handler.\n\tSupported values are %v", modes))
+	runCmd.PersistentFlags().StringVar(&logicalOpts.Method, "export-method", logicalOpts.Method, "How a logical dump reads the documents, cursor pages through the select handler with cursorMark, export streams them through the /export handler and requires docValues on every field")
+	runCmd.PersistentFlags().StringVar(&logicalOpts.Format, "format", logicalOpts.Format, fmt.Sprintf("Format of the chunks of a logical dump, csv and parquet have a column per field of the schema and can't be imported.\n\tSupported values are %v", solr_dump.Formats))
+	runCmd.PersistentFlags().StringVar(&compressionOpts.Codec, "compression", compressionOpts.Codec, fmt.Sprintf("Compression of the chunks of a logical dump, parquet chunks compress their pages with it. Compressed files are recognized when they are read.\n\tSupported values are %v", solr_dump.Compressions))
+	runCmd.PersistentFlags().IntVar(&compressionOpts.Level, "compression-level", 0, "Compression level, higher levels trade cpu for smaller files. gzip supports 1-9, zstd 1-22 and lz4 1-9, 0 selects the default of the compression")
+	runCmd.PersistentFlags().BoolVar(&compressionOpts.Metadata, "compress-metadata", false, "Also compress the manifest and the state of the run with --compression. Older versions of solr-dump can't read compressed metadata")
+	runCmd.PersistentFlags().IntVar(&logicalOpts.BatchSize, "batch-size", logicalOpts.BatchSize, "Number of documents read per request by a logical dump")
+	runCmd.PersistentFlags().IntVar(&logicalOpts.ChunkSize, "chunk-size", logicalOpts.ChunkSize, "Number of documents per chunk file of a logical dump")
+	runCmd.PersistentFlags().StringVar(&logicalOpts.Filter.Query, "query", "", "Query selecting the documents of a logical dump, all documents are dumped by default")
+	runCmd.PersistentFlags().StringArrayVar(&logicalOpts.Filter.FilterQueries, "filter-query", nil, "Filter query selecting the documents of a logical dump, may be repeated")
+	runCmd.PersistentFlags().StringSliceVar(&logicalOpts.Filter.Fields, "fields", nil, "Fields of the documents written to a logical dump, the unique key is always included. All stored fields are dumped by default")
+	runCmd.PersistentFlags().Int64Var(&logicalOpts.Filter.MaxDocs, "max-docs", 0, "Maximum number of documents per collection written to a logical dump, 0 means no limit")
+	runCmd.PersistentFlags().IntVar(&logicalOpts.Concurrency, "import-concurrency", logicalOpts.Concurrency, "Number of update requests sent to a collection at the same time while importing a logical dump")
+	runCmd.PersistentFlags().DurationVar(&logicalOpts.CommitWithin, "commit-within", 0, "commitWithin passed with every update request while importing a logical dump, 0 leaves it to the autoCommit settings. The documents are committed once the import finished")
+	runCmd.PersistentFlags().IntVar(&logicalOpts.MaxRetries, "max-retries", logicalOpts.MaxRetries, "Number of times an update request is retried while solr answers with 429 or a 5xx status code")
+	runCmd.PersistentFlags().StringSliceVar(&logicalOpts.DropFields, "drop-fields", nil, "Fields removed from the documents of a logical dump before they are imported")
+	runCmd.PersistentFlags().StringToStringVar(&logicalOpts.RenameFields, "rename-fields", nil, "Rename fields of the documents of a logical dump before they are imported, e.g. --rename-fields old=new")
 	runCmd.PersistentFlags().StringVarP(&db, "db", "d", "", fmt.Sprintf("db instance to take backup"))
 	runCmd.PersistentFlags().StringVarP(&namespace, "namespace", "n", "", fmt.Sprintf("Namespace of db instance"))
 	runCmd.PersistentFlags().StringVarP(&location, "location", "l", "", fmt.Sprintf("location of cloud backend where backups will be stored"))
 	runCmd.PersistentFlags().StringVarP(&repository, "repository", "r", "", fmt.Sprintf("repository of the backend"))
+	runCmd.PersistentFlags().StringSliceVar(&collections, "collections", nil, "Collections to backup or restore. Accepts names and glob patterns, all collections are selected if empty")
+	runCmd.PersistentFlags().StringSliceVar(&excludeCollections, "exclude-collections", nil, "Collections to skip. Accepts names and glob patterns")
+	runCmd.PersistentFlags().StringVar(&collectionsRegex, "collections-regex", "", "Regular expression selecting the collections to backup or restore")
+	runCmd.PersistentFlags().StringVar(&excludeRegex, "exclude-collections-regex", "", "Regular expression selecting the collections to skip")
+	runCmd.PersistentFlags().StringToStringVar(&rename, "rename", nil, "Restore a collection under a different name, e.g. --rename old=new,old2=new2")
+	runCmd.PersistentFlags().StringVar(&targetSuffix, "target-suffix", "", "Suffix appended to the name of every restored collection that has no --rename entry")
+	runCmd.PersistentFlags().StringVar(&fromRun, "from-run", "", "Id of a backup run whose manifest selects the collections and backup points to restore")
+	runCmd.PersistentFlags().StringVar(&backup, "backup", "", "Name of the backup to restore the collections from, required when a collection is stored in several backups")
+	runCmd.PersistentFlags().IntVar(&backupId, "backup-id", 0, "Id of the incremental backup point to restore. The latest backup point is restored by default")
+	runCmd.PersistentFlags().StringVar(&asOf, "as-of", "", "Restore the newest backup point taken at or before this time (RFC3339, e.g. 2024-05-01T10:00:00Z, or a date 2024-05-01 meaning the end of that day in UTC)")
+	runCmd.PersistentFlags().StringVar(&reportFile, "report-file", "", "Write a json report with the status of every collection to this file")
+	runCmd.PersistentFlags().StringVar(&resume, "resume", "", "Id of an interrupted run to resume. Collections already submitted to solr are tracked instead of being submitted again")
+	runCmd.PersistentFlags().StringVar(&stateDir, "state-dir", "", "Local directory for the state of the runs. The state is kept in the backup storage if empty")
+	runCmd.PersistentFlags().DurationVar(&timeout, "timeout", 24*time.Hour, "Maximum duration of the whole run, 0 means no limit")
+	runCmd.PersistentFlags().DurationVar(&trackerOpts.CollectionTimeout, "collection-timeout", 0, "Maximum duration of the backup or restore of a single collection, 0 means no limit")
+	runCmd.PersistentFlags().DurationVar(&trackerOpts.PollInterval, "poll-interval", trackerOpts.PollInterval, "Initial interval between status checks of a collection")
+	runCmd.PersistentFlags().DurationVar(&trackerOpts.MaxPollInterval, "max-poll-interval", trackerOpts.MaxPollInterval, "Maximum interval between status checks of a collection")
+	runCmd.PersistentFlags().Float64Var(&trackerOpts.BackoffFactor, "poll-backoff-factor", trackerOpts.BackoffFactor, "Factor the poll interval grows by after every status check")
+	runCmd.PersistentFlags().IntVar(&parallelism, "parallelism", 4, "Number of collections backed up or restored at the same time")
+	runCmd.PersistentFlags().BoolVar(&failFast, "fail-fast", false, "Stop submitting new collections after the first failed collection")
+	runCmd.PersistentFlags().IntVar(&maxOverseerQueue, "max-overseer-queue", 20, "Wait before submitting a collection while the overseer collection queue holds at least this many tasks, 0 disables the check")
+	runCmd.PersistentFlags().IntVar(&sampleSize, "sample-size", 10, "Number of documents per collection whose hashes are recorded in the backup manifest for verify --restore-test")
+	runCmd.PersistentFlags().BoolVar(&clusterMetadata, "cluster-metadata", true, "Export config sets, aliases and cluster properties along with a backup and recreate the missing ones during a restore")
+	addConnectionFlags(runCmd.PersistentFlags(), &connection)
+	addStorageFlags(runCmd.PersistentFlags())
+	addEncryptionFlags(runCmd.PersistentFlags())
+	addRetentionFlags(runCmd.PersistentFlags())
+}
+
+func writeReport(filename string, report *model.Report) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0o644)
+}
+
+// parseTime parses the time of --as-of. Times without a zone are UTC, a date is the end of that day
+// in UTC, so that the backup points taken during the day are included.
+func parseTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected RFC3339 (2006-01-02T15:04:05Z07:00) or a date (2006-01-02)", value)
 }
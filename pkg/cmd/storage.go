@@ -0,0 +1,213 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pritamdas99/solr-dump/model"
+	solr_dump "github.com/pritamdas99/solr-dump/pkg/solr-dump"
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+)
+
+const storageEnvPrefix = "SOLRDUMP_STORAGE_"
+
+// storageOptions holds the backend settings of the blob store. Values are read from
+// the config file first, then overridden by SOLRDUMP_STORAGE_* env vars and finally by flags.
+type storageOptions struct {
+	configFile string
+	provider   string
+	bucket     string
+	region     string
+	endpoint   string
+	prefix     string
+	path       string
+	secret     string
+
+	s3AccessKeyId        string
+	s3SecretAccessKey    string
+	s3SessionToken       string
+	s3Profile            string
+	s3CredentialsFile    string
+	s3VirtualHostStyle   bool
+	s3InsecureSkipVerify bool
+	s3CABundle           string
+	s3SSEKMSKeyId        string
+	gcsCredentialsFile   string
+	azureAccount         string
+	azureAccountKey      string
+	azureSASToken        string
+}
+
+var storageOpts storageOptions
+
+func addStorageFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&storageOpts.configFile, "storage-config", "", "Path to a yaml/json file holding the backup storage (model.BackupStorage)")
+	fs.StringVar(&storageOpts.provider, "provider", "", fmt.Sprintf("Storage provider.\n\tSupported values are %v", []model.Provider{model.ProviderS3, model.ProviderGCS, model.ProviderAZURE, model.ProviderLocal, model.ProviderMemory}))
+	fs.StringVar(&storageOpts.bucket, "bucket", "", "Name of the bucket (S3/GCS), container (AZURE) or in-memory store (MEMORY) that holds the backups")
+	fs.StringVar(&storageOpts.path, "path", "", "Directory that holds the backups for provider LOCAL, e.g. the mount path of a PVC or NFS share")
+	fs.StringVar(&storageOpts.region, "region", "", "Region of the S3 bucket")
+	fs.StringVar(&storageOpts.endpoint, "endpoint", "", "Endpoint of the S3 compatible storage")
+	fs.StringVar(&storageOpts.prefix, "prefix", "", "Prefix inside the bucket where the backups are stored")
+	fs.StringVar(&storageOpts.secret, "storage-secret", "", fmt.Sprintf("Kubernetes secret <namespace>/<name> holding the credentials of the storage: %s, %s and %s for S3, %s for GCS, %s and %s or %s for AZURE. Explicitly set credentials take precedence",
+		solr_dump.SecretAWSAccessKeyId, solr_dump.SecretAWSSecretAccessKey, solr_dump.SecretAWSSessionToken, solr_dump.SecretGoogleServiceAccount,
+		solr_dump.SecretAzureAccountName, solr_dump.SecretAzureAccountKey, solr_dump.SecretAzureSASToken))
+	fs.StringVar(&storageOpts.s3AccessKeyId, "s3-access-key-id", "", "Access key id of the S3 storage. Without static keys the credentials are taken from --s3-profile or the environment")
+	fs.StringVar(&storageOpts.s3SecretAccessKey, "s3-secret-access-key", "", "Secret access key of the S3 storage, prefer SOLRDUMP_STORAGE_S3_SECRET_ACCESS_KEY or --storage-secret over the flag")
+	fs.StringVar(&storageOpts.s3SessionToken, "s3-session-token", "", "Session token of temporary S3 credentials")
+	fs.StringVar(&storageOpts.s3Profile, "s3-profile", "", "Profile of the shared AWS config and credentials files")
+	fs.StringVar(&storageOpts.s3CredentialsFile, "s3-credentials-file", "", "Shared AWS credentials file used instead of ~/.aws/credentials")
+	fs.BoolVar(&storageOpts.s3VirtualHostStyle, "s3-virtual-host-style", false, "Address the bucket as <bucket>.<endpoint> instead of the path style <endpoint>/<bucket>")
+	fs.BoolVar(&storageOpts.s3InsecureSkipVerify, "s3-insecure-skip-verify", false, "Skip verifying the certificate of the S3 endpoint")
+	fs.StringVar(&storageOpts.s3CABundle, "s3-ca-bundle", "", "PEM file of the CAs trusted for the S3 endpoint, in addition to the system CAs")
+	fs.StringVar(&storageOpts.s3SSEKMSKeyId, "s3-sse-kms-key-id", "", "Encrypt the objects written to S3 server side with this KMS key (SSE-KMS)")
+	fs.StringVar(&storageOpts.gcsCredentialsFile, "gcs-credentials-file", "", "Service account JSON key file for GCS. The application default credentials are used by default")
+	fs.StringVar(&storageOpts.azureAccount, "azure-account", "", "Azure storage account, AZURE_STORAGE_ACCOUNT by default")
+	fs.StringVar(&storageOpts.azureAccountKey, "azure-account-key", "", "Shared key of the azure storage account, prefer SOLRDUMP_STORAGE_AZURE_ACCOUNT_KEY or --storage-secret over the flag")
+	fs.StringVar(&storageOpts.azureSASToken, "azure-sas-token", "", "SAS token of the azure container, instead of an account key")
+}
+
+// getBackupStorage merges the config file, env vars and flags into a model.BackupStorage. The
+// credentials of --storage-secret are read from the cluster selected by conn.
+func getBackupStorage(fs *pflag.FlagSet, conn solr_dump.ConnectionOptions) (*model.BackupStorage, error) {
+	bs := &model.BackupStorage{}
+	if storageOpts.configFile != "" {
+		data, err := os.ReadFile(storageOpts.configFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read storage config %s: %v", storageOpts.configFile, err)
+		}
+		if err := yaml.Unmarshal(data, bs); err != nil {
+			return nil, fmt.Errorf("failed to parse storage config %s: %v", storageOpts.configFile, err)
+		}
+	}
+
+	provider := lookupStorageValue(fs, "provider", storageOpts.provider, string(bs.Storage.Provider))
+	bs.Storage.Provider = model.Provider(strings.ToUpper(provider))
+	var secret string
+	if bs.Storage.Secret != nil {
+		secret = bs.Storage.Secret.Namespace + "/" + bs.Storage.Secret.Name
+	}
+	if secret = lookupStorageValue(fs, "storage-secret", storageOpts.secret, secret); secret != "" {
+		namespace, name, ok := strings.Cut(secret, "/")
+		if !ok || namespace == "" || name == "" {
+			return nil, fmt.Errorf("invalid storage secret %q, expected <namespace>/<name>", secret)
+		}
+		bs.Storage.Secret = &model.SecretRef{Namespace: namespace, Name: name}
+	}
+
+	switch bs.Storage.Provider {
+	case model.ProviderS3:
+		if bs.Storage.S3 == nil {
+			bs.Storage.S3 = &model.S3{}
+		}
+		s3 := bs.Storage.S3
+		s3.Bucket = lookupStorageValue(fs, "bucket", storageOpts.bucket, s3.Bucket)
+		s3.Region = lookupStorageValue(fs, "region", storageOpts.region, s3.Region)
+		s3.Endpoint = lookupStorageValue(fs, "endpoint", storageOpts.endpoint, s3.Endpoint)
+		s3.Prefix = lookupStorageValue(fs, "prefix", storageOpts.prefix, s3.Prefix)
+		s3.AccessKeyId = lookupStorageValue(fs, "s3-access-key-id", storageOpts.s3AccessKeyId, s3.AccessKeyId)
+		s3.SecretAccessKey = lookupStorageValue(fs, "s3-secret-access-key", storageOpts.s3SecretAccessKey, s3.SecretAccessKey)
+		s3.SessionToken = lookupStorageValue(fs, "s3-session-token", storageOpts.s3SessionToken, s3.SessionToken)
+		s3.Profile = lookupStorageValue(fs, "s3-profile", storageOpts.s3Profile, s3.Profile)
+		s3.CredentialsFile = lookupStorageValue(fs, "s3-credentials-file", storageOpts.s3CredentialsFile, s3.CredentialsFile)
+		s3.CABundle = lookupStorageValue(fs, "s3-ca-bundle", storageOpts.s3CABundle, s3.CABundle)
+		s3.SSEKMSKeyId = lookupStorageValue(fs, "s3-sse-kms-key-id", storageOpts.s3SSEKMSKeyId, s3.SSEKMSKeyId)
+		var err error
+		if s3.VirtualHostStyle, err = lookupStorageBool(fs, "s3-virtual-host-style", storageOpts.s3VirtualHostStyle, s3.VirtualHostStyle); err != nil {
+			return nil, err
+		}
+		if s3.InsecureSkipVerify, err = lookupStorageBool(fs, "s3-insecure-skip-verify", storageOpts.s3InsecureSkipVerify, s3.InsecureSkipVerify); err != nil {
+			return nil, err
+		}
+		if s3.Bucket == "" {
+			return nil, fmt.Errorf("bucket is required for provider %s", bs.Storage.Provider)
+		}
+	case model.ProviderGCS:
+		if bs.Storage.Gcs == nil {
+			bs.Storage.Gcs = &model.GCS{}
+		}
+		gcs := bs.Storage.Gcs
+		gcs.Bucket = lookupStorageValue(fs, "bucket", storageOpts.bucket, gcs.Bucket)
+		gcs.Prefix = lookupStorageValue(fs, "prefix", storageOpts.prefix, gcs.Prefix)
+		gcs.CredentialsFile = lookupStorageValue(fs, "gcs-credentials-file", storageOpts.gcsCredentialsFile, gcs.CredentialsFile)
+		if gcs.Bucket == "" {
+			return nil, fmt.Errorf("bucket is required for provider %s", bs.Storage.Provider)
+		}
+	case model.ProviderAZURE:
+		if bs.Storage.Azure == nil {
+			bs.Storage.Azure = &model.AZURE{}
+		}
+		azure := bs.Storage.Azure
+		azure.Container = lookupStorageValue(fs, "bucket", storageOpts.bucket, azure.Container)
+		azure.Prefix = lookupStorageValue(fs, "prefix", storageOpts.prefix, azure.Prefix)
+		azure.Account = lookupStorageValue(fs, "azure-account", storageOpts.azureAccount, azure.Account)
+		azure.AccountKey = lookupStorageValue(fs, "azure-account-key", storageOpts.azureAccountKey, azure.AccountKey)
+		azure.SASToken = lookupStorageValue(fs, "azure-sas-token", storageOpts.azureSASToken, azure.SASToken)
+		if azure.Container == "" {
+			return nil, fmt.Errorf("container is required for provider %s", bs.Storage.Provider)
+		}
+	case model.ProviderLocal:
+		if bs.Storage.Local == nil {
+			bs.Storage.Local = &model.Local{}
+		}
+		local := bs.Storage.Local
+		local.Path = lookupStorageValue(fs, "path", storageOpts.path, local.Path)
+		local.Prefix = lookupStorageValue(fs, "prefix", storageOpts.prefix, local.Prefix)
+		if local.Path == "" {
+			return nil, fmt.Errorf("path is required for provider %s", bs.Storage.Provider)
+		}
+	case model.ProviderMemory:
+		if bs.Storage.Memory == nil {
+			bs.Storage.Memory = &model.Memory{}
+		}
+		memory := bs.Storage.Memory
+		memory.Name = lookupStorageValue(fs, "bucket", storageOpts.bucket, memory.Name)
+		memory.Prefix = lookupStorageValue(fs, "prefix", storageOpts.prefix, memory.Prefix)
+	case "":
+		return nil, fmt.Errorf("storage provider is not set, use --provider, --storage-config or %sPROVIDER", storageEnvPrefix)
+	default:
+		return nil, fmt.Errorf("unknown provider: %s", bs.Storage.Provider)
+	}
+	if err := solr_dump.ResolveStorageSecret(context.TODO(), conn, bs); err != nil {
+		return nil, err
+	}
+	return bs, nil
+}
+
+// lookupStorageValue returns the flag value if it was set explicitly, otherwise the
+// matching env var, otherwise the value loaded from the config file.
+func lookupStorageValue(fs *pflag.FlagSet, name string, flagValue string, fileValue string) string {
+	if fs.Changed(name) {
+		return flagValue
+	}
+	env := storageEnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	if v, ok := os.LookupEnv(env); ok && v != "" {
+		return v
+	}
+	return fileValue
+}
+
+// lookupStorageBool is lookupStorageValue for boolean settings.
+func lookupStorageBool(fs *pflag.FlagSet, name string, flagValue bool, fileValue bool) (bool, error) {
+	value := lookupStorageValue(fs, name, strconv.FormatBool(flagValue), strconv.FormatBool(fileValue))
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid value %q of %s: %v", value, name, err)
+	}
+	return b, nil
+}
+
+// storageConfigured reports whether any backup storage setting was given.
+func storageConfigured(fs *pflag.FlagSet) bool {
+	if storageOpts.configFile != "" || fs.Changed("provider") {
+		return true
+	}
+	v, ok := os.LookupEnv(storageEnvPrefix + "PROVIDER")
+	return ok && v != ""
+}
@@ -0,0 +1,206 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/pritamdas99/solr-dump/blob"
+	"github.com/pritamdas99/solr-dump/model"
+	solr_dump "github.com/pritamdas99/solr-dump/pkg/solr-dump"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	verifyConnection  solr_dump.ConnectionOptions
+	verifyCollections []string
+	verifyExclude     []string
+	verifyBackupId    int
+	verifyAllPoints   bool
+	verifyFromRun     string
+	sizeOnly          bool
+	solrCheck         bool
+	restoreTest       bool
+	verifyCmd         = &cobra.Command{
+		Use:   "verify",
+		Short: "Check that the index files of the backups and the chunks of the logical dumps are complete and intact",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			storage, err := getBackupStorage(cmd.Flags(), verifyConnection)
+			if err != nil {
+				return err
+			}
+			bl, err := blob.NewBlob(storage)
+			if err != nil {
+				return err
+			}
+			keys, err := getKeyWrapper(verifyConnection)
+			if err != nil {
+				return err
+			}
+			filter, err := solr_dump.NewCollectionFilter(verifyCollections, verifyExclude, "", "")
+			if err != nil {
+				return err
+			}
+			opts := solr_dump.VerifyOptions{
+				Filter:    filter,
+				FromRun:   verifyFromRun,
+				AllPoints: verifyAllPoints,
+				SizeOnly:  sizeOnly,
+			}
+			if cmd.Flags().Changed("backup-id") {
+				opts.BackupId = &verifyBackupId
+			}
+			if opts.FromRun != "" && (opts.BackupId != nil || opts.AllPoints) {
+				return fmt.Errorf("--from-run can't be combined with --backup-id or --all")
+			}
+			if opts.BackupId != nil && opts.AllPoints {
+				return fmt.Errorf("--backup-id and --all are mutually exclusive")
+			}
+
+			vr, err := solr_dump.VerifyBackups(context.TODO(), solr_dump.NewEncryptedBlob(bl, keys), opts)
+			if err != nil {
+				return err
+			}
+			if solrCheck || restoreTest {
+				dumper, err := solr_dump.NewSolrDump(solr_dump.Options{
+					Action:     "verify",
+					DB:         db,
+					Namespace:  namespace,
+					Connection: verifyConnection,
+					Location:   location,
+					Repository: repository,
+					Storage:    storage,
+					Tracker:    solr_dump.DefaultTrackerOptions(),
+					Encryption: keys,
+				})
+				if err != nil {
+					return err
+				}
+				if solrCheck {
+					dumper.CheckBackups(context.TODO(), vr)
+				}
+				if restoreTest {
+					if err := dumper.RestoreTest(context.TODO(), vr); err != nil {
+						return err
+					}
+				}
+			}
+			if err := printVerifyReport(os.Stdout, vr, output); err != nil {
+				return err
+			}
+			if vr.Status != model.VerifyValid {
+				return fmt.Errorf("verification of the backups finished with status %s", vr.Status)
+			}
+			return nil
+		},
+	}
+)
+
+func NewVerifyCmd() *cobra.Command {
+	return verifyCmd
+}
+
+func init() {
+	verifyCmd.Flags().StringSliceVar(&verifyCollections, "collections", nil, "Collections to verify, by name or glob. All collections are verified by default")
+	verifyCmd.Flags().StringSliceVar(&verifyExclude, "exclude-collections", nil, "Collections not to verify, by name or glob")
+	verifyCmd.Flags().IntVar(&verifyBackupId, "backup-id", 0, "Id of the backup point to verify. The latest backup point is verified by default")
+	verifyCmd.Flags().BoolVar(&verifyAllPoints, "all", false, "Verify every backup point")
+	verifyCmd.Flags().StringVar(&verifyFromRun, "from-run", "", "Verify the backup points and logical dumps recorded in the manifest of this backup run")
+	verifyCmd.Flags().BoolVar(&sizeOnly, "size-only", false, "Only compare the sizes of the index files, without reading them to compare checksums")
+	verifyCmd.Flags().BoolVar(&solrCheck, "solr-check", false, "Also check that solr lists the verified backup points. Requires a connection to solr")
+	verifyCmd.Flags().BoolVar(&restoreTest, "restore-test", false, "Restore every verified backup point into a scratch collection, compare it with the document count and sample recorded at backup time and delete it again. Requires a connection to solr")
+	verifyCmd.Flags().StringVarP(&db, "db", "d", "", "db instance used for --solr-check and --restore-test")
+	verifyCmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Namespace of db instance")
+	verifyCmd.Flags().StringVarP(&location, "location", "l", "", "Location of the backups in the backup repository, used for --solr-check and --restore-test")
+	verifyCmd.Flags().StringVarP(&repository, "repository", "r", "", "Name of the solr backup repository, used for --solr-check and --restore-test")
+	verifyCmd.Flags().StringVarP(&output, "output", "o", "table", fmt.Sprintf("Output format.\n\tSupported values are %v", outputFormats))
+	addConnectionFlags(verifyCmd.Flags(), &verifyConnection)
+	addStorageFlags(verifyCmd.Flags())
+	addEncryptionFlags(verifyCmd.Flags())
+}
+
+func printVerifyReport(w io.Writer, vr *model.VerifyReport, format string) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(vr, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "yaml":
+		data, err := yaml.Marshal(vr)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 4, 3, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "BACKUP\tCOLLECTION\tBACKUP ID\tSHARD\tFILES\tSIZE\tSTATUS")
+		for _, cv := range vr.Collections {
+			status := string(cv.Status)
+			if cv.SolrCheck != "" {
+				status += " (solr: " + cv.SolrCheck + ")"
+			}
+			if rt := cv.RestoreTest; rt != nil {
+				if rt.Passed {
+					status += " (restore test: passed)"
+				} else if rt.Error != "" {
+					status += " (restore test: " + rt.Error + ")"
+				} else {
+					status += fmt.Sprintf(" (restore test: failed, %v of %v documents restored, %d of %d sampled documents differ)",
+						valueOrDash(rt.RestoredDocs), valueOrDash(rt.ExpectedDocs), len(rt.SampleMismatches), rt.SampleSize)
+				}
+			}
+			if cv.Error != "" {
+				status += ": " + cv.Error
+			}
+			if dv := cv.Dump; dv != nil {
+				_, _ = fmt.Fprintf(tw, "%s\t%s\t-\t-\t-\t-\t%s\n", cv.Backup, cv.Collection, status)
+				_, _ = fmt.Fprintf(tw, "\t\t\tdump %s\t%d\t%s\t%s\n", cv.RunId, dv.Files, humanSize(dv.Size), dv.Status)
+				for _, fv := range dv.Problems {
+					problem := fmt.Sprintf("%s %s", fv.File, fv.Problem)
+					if fv.Detail != "" {
+						problem += ": " + fv.Detail
+					}
+					_, _ = fmt.Fprintf(tw, "\t\t\t\t\t\t%s\n", problem)
+				}
+				continue
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%d\t-\t-\t-\t%s\n", cv.Backup, cv.Collection, cv.BackupId, status)
+			for _, sv := range cv.Shards {
+				status := string(sv.Status)
+				if sv.Error != "" {
+					status += ": " + sv.Error
+				}
+				_, _ = fmt.Fprintf(tw, "\t\t\t%s\t%d\t%s\t%s\n", sv.Shard, sv.Files, humanSize(sv.Size), status)
+				for _, fv := range sv.Problems {
+					problem := fmt.Sprintf("%s (%s) %s", fv.File, fv.IndexFile, fv.Problem)
+					if fv.Detail != "" {
+						problem += ": " + fv.Detail
+					}
+					_, _ = fmt.Fprintf(tw, "\t\t\t\t\t\t%s\n", problem)
+				}
+			}
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format %s, supported values are %v", format, outputFormats)
+	}
+}
+
+func valueOrDash(n *int64) string {
+	if n == nil {
+		return "-"
+	}
+	return strconv.FormatInt(*n, 10)
+}
@@ -0,0 +1,192 @@
+package solr_dump
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pritamdas99/solr-dump/model"
+	"k8s.io/klog/v2"
+)
+
+var backupPropertiesRegex = regexp.MustCompile(`^backup_(\d+)\.properties$`)
+
+// ListBackups walks the <backupName>/<collection>/ layout of the backup storage and
+// returns every backup with its collections and backup points. Backup points taken by
+// a run with a manifest are annotated with the run id and document count.
+func ListBackups(ctx context.Context, bl model.Blob) ([]model.BackupInfo, error) {
+	objects, err := bl.ListInfo(ctx, "/")
+	if err != nil {
+		return nil, err
+	}
+
+	backups := map[string]*model.BackupInfo{}
+	collections := map[string]map[string]*model.CollectionBackup{}
+	var runIds []string
+	for _, obj := range objects {
+		if runId, ok := isManifestPath(obj.Path); ok {
+			runIds = append(runIds, runId)
+			continue
+		}
+		part := strings.Split(strings.Trim(obj.Path, "/"), "/")
+		if len(part) < 3 {
+			continue
+		}
+		backupName, collection := part[0], part[1]
+		if backupName == model.MetadataDir {
+			continue
+		}
+		// logical dumps aren't solr backups, they are recorded in the manifests of their runs
+		if len(part) == 4 && isDumpFile(part[3]) {
+			continue
+		}
+		bi, ok := backups[backupName]
+		if !ok {
+			bi = &model.BackupInfo{Name: backupName}
+			backups[backupName] = bi
+			collections[backupName] = map[string]*model.CollectionBackup{}
+		}
+		cb, ok := collections[backupName][collection]
+		if !ok {
+			cb = &model.CollectionBackup{Name: collection}
+			collections[backupName][collection] = cb
+		}
+
+		cb.Size += obj.Size
+		bi.Size += obj.Size
+		if obj.ModTime.After(cb.LastModified) {
+			cb.LastModified = obj.ModTime
+		}
+		if obj.ModTime.After(bi.LastModified) {
+			bi.LastModified = obj.ModTime
+		}
+
+		if len(part) == 3 && backupPropertiesRegex.MatchString(part[2]) {
+			point, err := readBackupPoint(ctx, bl, obj.Path)
+			if err != nil {
+				klog.Warningf("failed to read backup properties %s: %v", obj.Path, err)
+				continue
+			}
+			cb.Points = append(cb.Points, *point)
+		}
+	}
+
+	for _, runId := range runIds {
+		m, err := ReadManifest(ctx, bl, runId)
+		if err != nil {
+			klog.Warning(err)
+			continue
+		}
+		for _, cm := range m.Collections {
+			if cm.BackupId == nil {
+				continue
+			}
+			cb, ok := collections[cm.BackupName][cm.Name]
+			if !ok {
+				continue
+			}
+			for i := range cb.Points {
+				if cb.Points[i].ID == *cm.BackupId {
+					cb.Points[i].RunId = m.RunId
+					cb.Points[i].NumDocs = cm.NumDocs
+				}
+			}
+		}
+	}
+
+	var result []model.BackupInfo
+	for name, bi := range backups {
+		for _, cb := range collections[name] {
+			sort.Slice(cb.Points, func(i, j int) bool {
+				return cb.Points[i].ID < cb.Points[j].ID
+			})
+			bi.Collections = append(bi.Collections, *cb)
+		}
+		sort.Slice(bi.Collections, func(i, j int) bool {
+			return bi.Collections[i].Name < bi.Collections[j].Name
+		})
+		result = append(result, *bi)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// readBackupPoint reads a backup_N.properties file written by solr's incremental backup.
+func readBackupPoint(ctx context.Context, bl model.Blob, filepath string) (*model.BackupPoint, error) {
+	match := backupPropertiesRegex.FindStringSubmatch(path.Base(filepath))
+	if match == nil {
+		return nil, fmt.Errorf("%s is not a backup properties file", filepath)
+	}
+	id, err := strconv.Atoi(match[1])
+	if err != nil {
+		return nil, err
+	}
+	data, err := bl.Get(ctx, filepath)
+	if err != nil {
+		return nil, err
+	}
+	props := parseProperties(data)
+
+	point := &model.BackupPoint{
+		ID:          id,
+		SolrVersion: props["solrVersion"],
+	}
+	if t, err := time.Parse(time.RFC3339Nano, props["startTime"]); err == nil {
+		point.StartTime = &t
+	}
+	if t, err := time.Parse(time.RFC3339Nano, props["endTime"]); err == nil {
+		point.EndTime = &t
+	}
+	if n, err := strconv.Atoi(props["indexFileCount"]); err == nil {
+		point.IndexFileCount = n
+	}
+	if n, err := strconv.ParseFloat(props["indexSizeMB"], 64); err == nil {
+		point.IndexSizeMB = n
+	}
+	return point, nil
+}
+
+// resolveBackupPoint picks the backup point to restore. With backupId set the point must exist,
+// with asOf set the newest point taken at or before asOf is chosen, otherwise the latest point is used.
+func resolveBackupPoint(cb model.CollectionBackup, backupId *int, asOf *time.Time) (*model.BackupPoint, error) {
+	if len(cb.Points) == 0 {
+		return nil, fmt.Errorf("no backup point found for collection %s", cb.Name)
+	}
+	if backupId != nil {
+		for i := range cb.Points {
+			if cb.Points[i].ID == *backupId {
+				return &cb.Points[i], nil
+			}
+		}
+		return nil, fmt.Errorf("backup id %d not found for collection %s", *backupId, cb.Name)
+	}
+	if asOf == nil {
+		return &cb.Points[len(cb.Points)-1], nil
+	}
+
+	var found *model.BackupPoint
+	for i := range cb.Points {
+		point := &cb.Points[i]
+		taken := point.StartTime
+		if taken == nil {
+			taken = point.EndTime
+		}
+		if taken == nil || taken.After(*asOf) {
+			continue
+		}
+		if found == nil || point.ID > found.ID {
+			found = point
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no backup point of collection %s was taken at or before %s", cb.Name, asOf.Format(time.RFC3339))
+	}
+	return found, nil
+}
@@ -0,0 +1,149 @@
+package solr_dump
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pritamdas99/solr-dump/model"
+)
+
+// putBackupPoint writes the backup_<id>.properties file solr writes for a backup point taken at taken.
+func putBackupPoint(t *testing.T, bl model.Blob, backupName string, collection string, id int, taken time.Time) {
+	t.Helper()
+	props := fmt.Sprintf("#Backup properties file\nstartTime=%s\nendTime=%s\nindexFileCount=3\nindexSizeMB=1.5\nsolrVersion=9.4.0\n",
+		taken.Format(time.RFC3339Nano), taken.Add(time.Minute).Format(time.RFC3339Nano))
+	putObject(t, bl, fmt.Sprintf("%s/%s/backup_%d.properties", backupName, collection, id), []byte(props))
+}
+
+func putManifest(t *testing.T, bl model.Blob, m *model.Manifest) {
+	t.Helper()
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := putWithChecksum(context.Background(), bl, manifestPath(m.RunId), data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func TestListBackups(t *testing.T) {
+	bl := newTestBlob(t)
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	putBackupPoint(t, bl, "c1-backup", "c1", 1, day.Add(24*time.Hour))
+	putBackupPoint(t, bl, "c1-backup", "c1", 0, day)
+	putObject(t, bl, "c1-backup/c1/index/segments_1", []byte("index"))
+	putObject(t, bl, "c1-backup/c1/shard_backup_metadata/md_shard1_0.json", []byte("{}"))
+	putBackupPoint(t, bl, "c2-backup", "c2", 0, day)
+	// neither logical dumps nor run metadata are backups
+	putObject(t, bl, "c3-dump/c3/run1/chunk-00000.jsonl.gz", []byte("{}"))
+	putManifest(t, bl, &model.Manifest{
+		RunId: "run1",
+		Collections: []model.CollectionManifest{
+			{Name: "c1", BackupName: "c1-backup", BackupId: intPtr(1), NumDocs: new(int64)},
+			{Name: "c2", BackupName: "c2-backup"},
+		},
+	})
+	putObject(t, bl, "c1-backup/c1/backup_x.properties", []byte("not a backup point"))
+
+	backups, err := ListBackups(context.Background(), bl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 || backups[0].Name != "c1-backup" || backups[1].Name != "c2-backup" {
+		t.Fatalf("got backups %+v, want c1-backup and c2-backup", backups)
+	}
+	cb := backups[0].Collections
+	if len(cb) != 1 || cb[0].Name != "c1" || len(cb[0].Points) != 2 {
+		t.Fatalf("got collections %+v, want c1 with two backup points", cb)
+	}
+	first, second := cb[0].Points[0], cb[0].Points[1]
+	if first.ID != 0 || second.ID != 1 {
+		t.Errorf("got backup points %d and %d, want them sorted by id", first.ID, second.ID)
+	}
+	if first.StartTime == nil || !first.StartTime.Equal(day) || first.EndTime == nil || first.SolrVersion != "9.4.0" ||
+		first.IndexFileCount != 3 || first.IndexSizeMB != 1.5 {
+		t.Errorf("backup point 0 = %+v, want the values of its properties file", first)
+	}
+	if first.RunId != "" || second.RunId != "run1" || second.NumDocs == nil {
+		t.Errorf("got run ids %q and %q, want backup point 1 annotated by run1", first.RunId, second.RunId)
+	}
+	if cb[0].Size == 0 || backups[0].Size != cb[0].Size {
+		t.Errorf("got sizes %d and %d, want the size of every file of the backup", cb[0].Size, backups[0].Size)
+	}
+}
+
+func TestListBackupsSkipsCorruptedManifest(t *testing.T) {
+	bl := newTestBlob(t)
+	putBackupPoint(t, bl, "c1-backup", "c1", 0, time.Now())
+	putManifest(t, bl, &model.Manifest{
+		RunId:       "run1",
+		Collections: []model.CollectionManifest{{Name: "c1", BackupName: "c1-backup", BackupId: intPtr(0)}},
+	})
+	putObject(t, bl, manifestPath("run1"), []byte(`{"runId": "other"}`))
+
+	backups, err := ListBackups(context.Background(), bl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if point := backups[0].Collections[0].Points[0]; point.RunId != "" {
+		t.Errorf("backup point annotated by run %s, whose manifest doesn't match its checksum", point.RunId)
+	}
+}
+
+func TestResolveBackupPoint(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cb := model.CollectionBackup{
+		Name: "c1",
+		Points: []model.BackupPoint{
+			{ID: 0, StartTime: timePtr(day)},
+			// without a start time, the end time is when the point was taken
+			{ID: 1, EndTime: timePtr(day.Add(24 * time.Hour))},
+			{ID: 2},
+			{ID: 3, StartTime: timePtr(day.Add(72 * time.Hour))},
+		},
+	}
+	tests := map[string]struct {
+		cb       model.CollectionBackup
+		backupId *int
+		asOf     *time.Time
+		want     int
+		err      bool
+	}{
+		"latest":             {cb: cb, want: 3},
+		"backup id":          {cb: cb, backupId: intPtr(2), want: 2},
+		"unknown backup id":  {cb: cb, backupId: intPtr(7), err: true},
+		"as of a point time": {cb: cb, asOf: timePtr(day), want: 0},
+		"as of end time":     {cb: cb, asOf: timePtr(day.Add(48 * time.Hour)), want: 1},
+		"as of the future":   {cb: cb, asOf: timePtr(day.Add(1000 * time.Hour)), want: 3},
+		"before every point": {cb: cb, asOf: timePtr(day.Add(-time.Second)), err: true},
+		"no point":           {cb: model.CollectionBackup{Name: "c1"}, err: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			point, err := resolveBackupPoint(test.cb, test.backupId, test.asOf)
+			if test.err {
+				if err == nil {
+					t.Errorf("got backup point %d, want an error", point.ID)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if point.ID != test.want {
+				t.Errorf("got backup point %d, want %d", point.ID, test.want)
+			}
+		})
+	}
+}
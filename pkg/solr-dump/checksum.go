@@ -0,0 +1,91 @@
+package solr_dump
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pritamdas99/solr-dump/blob"
+	"github.com/pritamdas99/solr-dump/model"
+)
+
+// checksumExt is appended to the name of a metadata file to name the file holding its sha256. The
+// manifest can't record its own checksum, nor that of the state which is written while the run is going.
+const checksumExt = ".sha256"
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// putWithChecksum writes data to filepath and its sha256 to filepath.sha256, in the format of sha256sum.
+func putWithChecksum(ctx context.Context, bl model.Blob, filepath string, data []byte) error {
+	if err := bl.Put(ctx, filepath, bytes.NewReader(data)); err != nil {
+		return err
+	}
+	line := fmt.Sprintf("%s  %s\n", sha256Hex(data), filepath[strings.LastIndex(filepath, "/")+1:])
+	return bl.Put(ctx, filepath+checksumExt, strings.NewReader(line))
+}
+
+// getWithChecksum reads filepath and checks it against the sha256 in filepath.sha256. Files written
+// before checksums were recorded have none, they are returned unchecked.
+func getWithChecksum(ctx context.Context, bl model.Blob, filepath string) ([]byte, error) {
+	data, err := bl.Get(ctx, filepath)
+	if err != nil {
+		return nil, err
+	}
+	line, err := bl.Get(ctx, filepath+checksumExt)
+	if blob.IsNotFound(err) {
+		return data, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read checksum of %s: %v", filepath, err)
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("checksum file of %s is empty", filepath)
+	}
+	if sum := sha256Hex(data); sum != fields[0] {
+		return nil, fmt.Errorf("sha256 %s of %s doesn't match recorded sha256 %s, the file is corrupted or truncated", sum, filepath, fields[0])
+	}
+	return data, nil
+}
+
+// checkSHA256 compares the sha256 of data with the sha256 recorded for it, if any.
+func checkSHA256(filepath string, data []byte, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	if sum := sha256Hex(data); sum != expected {
+		return fmt.Errorf("sha256 %s of %s doesn't match recorded sha256 %s, the file is corrupted or truncated", sum, filepath, expected)
+	}
+	return nil
+}
+
+// verifyObject reads filepath and compares its size and sha256 with those recorded in the manifest. A
+// negative size or an empty sum, for files written before checksums were recorded, aren't compared.
+func verifyObject(ctx context.Context, bl model.Blob, filepath string, size int64, sum string) (model.FileProblem, string) {
+	r, err := bl.NewReader(ctx, filepath)
+	if blob.IsNotFound(err) {
+		return model.FileMissing, ""
+	} else if err != nil {
+		return model.FileUnreadable, err.Error()
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return model.FileUnreadable, err.Error()
+	}
+	if size >= 0 && n != size {
+		return model.FileSizeMismatch, fmt.Sprintf("expected %d bytes, found %d", size, n)
+	}
+	if computed := hex.EncodeToString(h.Sum(nil)); sum != "" && computed != sum {
+		return model.FileChecksumMismatch, fmt.Sprintf("sha256 %s doesn't match recorded sha256 %s", computed, sum)
+	}
+	return "", ""
+}
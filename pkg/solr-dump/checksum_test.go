@@ -0,0 +1,153 @@
+package solr_dump
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pritamdas99/solr-dump/model"
+)
+
+func TestPutWithChecksum(t *testing.T) {
+	bl := newTestBlob(t)
+	data := []byte(`{"runId": "run1"}`)
+	if err := putWithChecksum(context.Background(), bl, manifestPath("run1"), data); err != nil {
+		t.Fatal(err)
+	}
+	// the sidecar can be checked with sha256sum -c
+	want := sha256Hex(data) + "  manifest.json\n"
+	if got := getObject(t, bl, manifestPath("run1")+checksumExt); string(got) != want {
+		t.Errorf("got checksum file %q, want %q", got, want)
+	}
+	got, err := getWithChecksum(context.Background(), bl, manifestPath("run1"))
+	if err != nil || string(got) != string(data) {
+		t.Errorf("got %q, %v, want %q", got, err, data)
+	}
+}
+
+func TestGetWithChecksum(t *testing.T) {
+	data := []byte(`{"runId": "run1"}`)
+	tests := map[string]struct {
+		object []byte
+		// checksum replaces the checksum file, noChecksum deletes it
+		checksum   string
+		noChecksum bool
+		err        string
+	}{
+		"truncated": {
+			object: data[:len(data)-1],
+			err:    "corrupted or truncated",
+		},
+		"corrupted": {
+			object: []byte(strings.Replace(string(data), "1", "2", 1)),
+			err:    "corrupted or truncated",
+		},
+		"written before checksums": {
+			object:     data,
+			noChecksum: true,
+		},
+		"empty checksum file": {
+			object:   data,
+			checksum: "\n",
+			err:      "is empty",
+		},
+		"checksum only": {
+			object:   data,
+			checksum: sha256Hex(data),
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			bl := newTestBlob(t)
+			if err := putWithChecksum(context.Background(), bl, "file", data); err != nil {
+				t.Fatal(err)
+			}
+			putObject(t, bl, "file", test.object)
+			if test.noChecksum {
+				if err := bl.Delete(context.Background(), "file"+checksumExt); err != nil {
+					t.Fatal(err)
+				}
+			} else if test.checksum != "" {
+				putObject(t, bl, "file"+checksumExt, []byte(test.checksum))
+			}
+
+			got, err := getWithChecksum(context.Background(), bl, "file")
+			if test.err == "" {
+				if err != nil || string(got) != string(test.object) {
+					t.Errorf("got %q, %v, want %q", got, err, test.object)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestVerifyObject(t *testing.T) {
+	bl := newTestBlob(t)
+	data := []byte("chunk data")
+	putObject(t, bl, "chunk", data)
+	sum := sha256Hex(data)
+
+	tests := map[string]struct {
+		path string
+		size int64
+		sum  string
+		want model.FileProblem
+	}{
+		"ok":                     {path: "chunk", size: int64(len(data)), sum: sum},
+		"missing":                {path: "other", size: int64(len(data)), sum: sum, want: model.FileMissing},
+		"size mismatch":          {path: "chunk", size: int64(len(data)) + 1, sum: sum, want: model.FileSizeMismatch},
+		"checksum mismatch":      {path: "chunk", size: int64(len(data)), sum: sha256Hex([]byte("other")), want: model.FileChecksumMismatch},
+		"size unknown":           {path: "chunk", size: -1, sum: sum},
+		"checksum unknown":       {path: "chunk", size: int64(len(data))},
+		"size and sum unknown":   {path: "chunk", size: -1},
+		"size unknown, mismatch": {path: "chunk", size: -1, sum: sha256Hex(nil), want: model.FileChecksumMismatch},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			problem, detail := verifyObject(context.Background(), bl, test.path, test.size, test.sum)
+			if problem != test.want {
+				t.Errorf("got problem %q (%s), want %q", problem, detail, test.want)
+			}
+			if (detail != "") != (problem != "" && problem != model.FileMissing) {
+				t.Errorf("got detail %q for problem %q", detail, problem)
+			}
+		})
+	}
+}
+
+func TestVerifyDump(t *testing.T) {
+	bl := newTestBlob(t)
+	dir := "c1-dump/c1/run1"
+	schema, chunk := []byte(`{"fields": []}`), []byte("{}\n{}\n")
+	putObject(t, bl, dir+"/schema.json", schema)
+	putObject(t, bl, dir+"/chunk-00000.jsonl", chunk)
+	putObject(t, bl, dir+"/chunk-00001.jsonl", chunk[:3])
+
+	dump := &model.DumpManifest{
+		Path:         dir,
+		Schema:       "schema.json",
+		SchemaSHA256: sha256Hex(schema),
+		Chunks: []model.ChunkManifest{
+			{Name: "chunk-00000.jsonl", Size: int64(len(chunk)), SHA256: sha256Hex(chunk)},
+			{Name: "chunk-00001.jsonl", Size: int64(len(chunk)), SHA256: sha256Hex(chunk)},
+			{Name: "chunk-00002.jsonl", Size: int64(len(chunk)), SHA256: sha256Hex(chunk)},
+		},
+	}
+	var got []model.FileProblem
+	for _, fv := range verifyDump(context.Background(), bl, dump) {
+		got = append(got, fv.Problem)
+	}
+	if want := []model.FileProblem{model.FileSizeMismatch, model.FileMissing}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got problems %v, want %v", got, want)
+	}
+
+	putObject(t, bl, dir+"/schema.json", []byte("{}"))
+	dump.Chunks = dump.Chunks[:1]
+	problems := verifyDump(context.Background(), bl, dump)
+	if len(problems) != 1 || problems[0].File != "schema.json" || problems[0].Problem != model.FileChecksumMismatch {
+		t.Errorf("got problems %+v, want the schema file's checksum mismatch", problems)
+	}
+}
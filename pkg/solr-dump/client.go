@@ -0,0 +1,853 @@
+package solr_dump
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/pritamdas99/solr-dump/model"
+	"k8s.io/klog/v2"
+)
+
+// The solr client from db-client-go doesn't cover every api solr-dump needs,
+// the requests below are sent through its underlying resty client instead.
+
+// newStreamClient returns a client sending requests like c, without its timeout. The solr client
+// builder sets a timeout of 30s, which also bounds reading the response body, so a logical dump or
+// import that streams documents for longer would be cut off. The context of a request bounds it instead.
+func newStreamClient(c *resty.Client) *resty.Client {
+	sc := resty.NewWithClient(&http.Client{Transport: c.GetClient().Transport})
+	sc.SetBaseURL(c.BaseURL)
+	sc.Header = c.Header.Clone()
+	if c.UserInfo != nil {
+		sc.SetBasicAuth(c.UserInfo.Username, c.UserInfo.Password)
+	}
+	sc.SetDisableWarn(true)
+	return sc
+}
+
+type backupParams struct {
+	Location   string `json:"location,omitempty"`
+	Repository string `json:"repository,omitempty"`
+	Async      string `json:"async,omitempty"`
+}
+
+// backupCollection adds a new incremental backup point of collection to backupName.
+func (dumper *SolrDump) backupCollection(ctx context.Context, collection string, backupName string, asyncId string) (map[string]interface{}, error) {
+	klog.V(5).Infof("submitting backup of collection %s to %s with async id %s", collection, backupName, asyncId)
+	req := dumper.slClient.Client.R().SetDoNotParseResponse(true).SetContext(ctx)
+	req.SetHeader("Content-Type", "application/json")
+	req.SetBody(&backupParams{
+		Location:   dumper.location,
+		Repository: dumper.repository,
+		Async:      asyncId,
+	})
+	res, err := req.Post(fmt.Sprintf("/api/collections/%s/backups/%s/versions", collection, backupName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send http request to backup collection %s: %v", collection, err)
+	}
+	return dumper.decodeResponse(res)
+}
+
+type restoreParams struct {
+	Location   string `json:"location,omitempty"`
+	Repository string `json:"repository,omitempty"`
+	Collection string `json:"collection,omitempty"`
+	Async      string `json:"async,omitempty"`
+	BackupId   *int   `json:"backupId,omitempty"`
+}
+
+// restoreCollection restores backupName into collection. If backupId is nil, solr restores the latest backup point.
+func (dumper *SolrDump) restoreCollection(ctx context.Context, collection string, backupName string, backupId *int, asyncId string) (map[string]interface{}, error) {
+	klog.V(5).Infof("submitting restore of backup %s into collection %s with async id %s", backupName, collection, asyncId)
+	req := dumper.slClient.Client.R().SetDoNotParseResponse(true).SetContext(ctx)
+	req.SetHeader("Content-Type", "application/json")
+	req.SetBody(&restoreParams{
+		Location:   dumper.location,
+		Repository: dumper.repository,
+		Collection: collection,
+		Async:      asyncId,
+		BackupId:   backupId,
+	})
+	res, err := req.Post(fmt.Sprintf("/api/backups/%s/restore", backupName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send http request to restore collection %s: %v", collection, err)
+	}
+	return dumper.decodeResponse(res)
+}
+
+// repositoryParams returns the query parameters that select the backup repository and location.
+func (dumper *SolrDump) repositoryParams() map[string]string {
+	params := map[string]string{}
+	if dumper.location != "" {
+		params["location"] = dumper.location
+	}
+	if dumper.repository != "" {
+		params["repository"] = dumper.repository
+	}
+	return params
+}
+
+// deleteBackupPoint deletes backup point backupId of backupName. Solr also purges the index files
+// that are no longer referenced by any remaining backup point.
+func (dumper *SolrDump) deleteBackupPoint(ctx context.Context, backupName string, backupId int) error {
+	req := dumper.slClient.Client.R().SetDoNotParseResponse(true).SetContext(ctx)
+	req.SetQueryParams(dumper.repositoryParams())
+	res, err := req.Delete(fmt.Sprintf("/api/backups/%s/versions/%d", backupName, backupId))
+	if err != nil {
+		return fmt.Errorf("failed to send http request to delete backup point %d of %s: %v", backupId, backupName, err)
+	}
+	_, err = dumper.decodeResponse(res)
+	return err
+}
+
+// listBackupPoints returns the ids of the backup points of backupName known to solr.
+func (dumper *SolrDump) listBackupPoints(ctx context.Context, backupName string) ([]int, error) {
+	req := dumper.slClient.Client.R().SetDoNotParseResponse(true).SetContext(ctx)
+	req.SetQueryParams(dumper.repositoryParams())
+	res, err := req.Get(fmt.Sprintf("/api/backups/%s/versions", backupName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send http request to list backup %s: %v", backupName, err)
+	}
+	responseBody, err := dumper.decodeResponse(res)
+	if err != nil {
+		return nil, err
+	}
+	backups, _ := responseBody["backups"].([]interface{})
+	var ids []int
+	for _, b := range backups {
+		point, _ := b.(map[string]interface{})
+		if id, ok := point["backupId"].(float64); ok {
+			ids = append(ids, int(id))
+		}
+	}
+	return ids, nil
+}
+
+// requestStatus returns the status of the async request asyncId.
+func (dumper *SolrDump) requestStatus(ctx context.Context, asyncId string) (map[string]interface{}, error) {
+	req := dumper.slClient.Client.R().SetDoNotParseResponse(true).SetContext(ctx)
+	res, err := req.Get(fmt.Sprintf("/api/cluster/command-status/%s", asyncId))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send http request to request status: %v", err)
+	}
+	return dumper.decodeResponse(res)
+}
+
+// overseerQueueSize returns the number of tasks in the overseer collection work queue.
+func (dumper *SolrDump) overseerQueueSize(ctx context.Context) (int, error) {
+	req := dumper.slClient.Client.R().SetDoNotParseResponse(true).SetContext(ctx)
+	req.SetQueryParams(map[string]string{
+		"action": "OVERSEERSTATUS",
+		"wt":     "json",
+	})
+	res, err := req.Get("/solr/admin/collections")
+	if err != nil {
+		return 0, fmt.Errorf("failed to send http request to get overseer status: %v", err)
+	}
+	responseBody, err := dumper.decodeResponse(res)
+	if err != nil {
+		return 0, err
+	}
+	size, ok := responseBody["overseer_collection_queue_size"].(float64)
+	if !ok {
+		return 0, fmt.Errorf("didn't find overseer_collection_queue_size")
+	}
+	return int(size), nil
+}
+
+// clusterStatus returns the CLUSTERSTATUS entry of collection.
+func (dumper *SolrDump) clusterStatus(ctx context.Context, collection string) (map[string]interface{}, error) {
+	req := dumper.slClient.Client.R().SetDoNotParseResponse(true).SetContext(ctx)
+	req.SetQueryParams(map[string]string{
+		"action":     "CLUSTERSTATUS",
+		"collection": collection,
+		"wt":         "json",
+	})
+	res, err := req.Get("/solr/admin/collections")
+	if err != nil {
+		return nil, fmt.Errorf("failed to send http request to get cluster status: %v", err)
+	}
+	responseBody, err := dumper.decodeResponse(res)
+	if err != nil {
+		return nil, err
+	}
+	cluster, _ := responseBody["cluster"].(map[string]interface{})
+	collections, _ := cluster["collections"].(map[string]interface{})
+	status, ok := collections[collection].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("didn't find collection %s in cluster status", collection)
+	}
+	return status, nil
+}
+
+// numDocs returns the number of documents in collection.
+func (dumper *SolrDump) numDocs(ctx context.Context, collection string) (int64, error) {
+	return dumper.countDocuments(ctx, collection, model.DumpFilter{})
+}
+
+// countDocuments returns the number of documents of collection matching filter.
+func (dumper *SolrDump) countDocuments(ctx context.Context, collection string, filter model.DumpFilter) (int64, error) {
+	req := dumper.slClient.Client.R().SetDoNotParseResponse(true).SetContext(ctx)
+	params := queryParams(filter, "")
+	params.Del("fl")
+	params.Set("rows", "0")
+	req.SetQueryParamsFromValues(params)
+	res, err := req.Get(fmt.Sprintf("/solr/%s/select", collection))
+	if err != nil {
+		return 0, fmt.Errorf("failed to send http request to count documents: %v", err)
+	}
+	responseBody, err := dumper.decodeResponse(res)
+	if err != nil {
+		return 0, err
+	}
+	response, _ := responseBody["response"].(map[string]interface{})
+	numFound, ok := response["numFound"].(float64)
+	if !ok {
+		return 0, fmt.Errorf("didn't find numFound")
+	}
+	return int64(numFound), nil
+}
+
+// uniqueKey returns the name of the unique key field of collection.
+func (dumper *SolrDump) uniqueKey(ctx context.Context, collection string) (string, error) {
+	req := dumper.slClient.Client.R().SetDoNotParseResponse(true).SetContext(ctx)
+	res, err := req.Get(fmt.Sprintf("/solr/%s/schema/uniquekey?wt=json", collection))
+	if err != nil {
+		return "", fmt.Errorf("failed to send http request to get unique key: %v", err)
+	}
+	responseBody, err := dumper.decodeResponse(res)
+	if err != nil {
+		return "", err
+	}
+	key, ok := responseBody["uniqueKey"].(string)
+	if !ok || key == "" {
+		return "", fmt.Errorf("collection %s has no unique key", collection)
+	}
+	return key, nil
+}
+
+// selectDocuments returns the stored fields of the documents of collection matching q.
+func (dumper *SolrDump) selectDocuments(ctx context.Context, collection string, q string, rows int) ([]map[string]interface{}, error) {
+	req := dumper.slClient.Client.R().SetDoNotParseResponse(true).SetContext(ctx)
+	req.SetQueryParams(map[string]string{
+		"q":    q,
+		"rows": strconv.Itoa(rows),
+		"fl":   "*",
+		"wt":   "json",
+	})
+	res, err := req.Get(fmt.Sprintf("/solr/%s/select", collection))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send http request to select documents: %v", err)
+	}
+	responseBody, err := dumper.decodeResponse(res)
+	if err != nil {
+		return nil, err
+	}
+	response, _ := responseBody["response"].(map[string]interface{})
+	docs, _ := response["docs"].([]interface{})
+	var result []map[string]interface{}
+	for _, d := range docs {
+		if doc, ok := d.(map[string]interface{}); ok {
+			result = append(result, doc)
+		}
+	}
+	return result, nil
+}
+
+// cursorPage reads a page of the documents of collection matching filter with cursorMark deep paging,
+// sorted by the unique key. It returns nextCursor, which equals cursor once every document was read.
+func (dumper *SolrDump) cursorPage(ctx context.Context, collection string, uniqueKey string, filter model.DumpFilter, cursor string, rows int, fn func(doc map[string]interface{}) error) (string, error) {
+	req := dumper.streamClient.R().SetDoNotParseResponse(true).SetContext(ctx)
+	params := queryParams(filter, "*")
+	params.Set("sort", uniqueKey+" asc")
+	params.Set("rows", strconv.Itoa(rows))
+	params.Set("cursorMark", cursor)
+	req.SetQueryParamsFromValues(params)
+	res, err := req.Get(fmt.Sprintf("/solr/%s/select", collection))
+	if err != nil {
+		return "", fmt.Errorf("failed to send http request to read documents: %v", err)
+	}
+	responseBody, err := dumper.streamDocuments(res, fn)
+	if err != nil {
+		return "", err
+	}
+	next, ok := responseBody["nextCursorMark"].(string)
+	if !ok {
+		return "", fmt.Errorf("didn't find nextCursorMark")
+	}
+	return next, nil
+}
+
+// exportDocuments streams every document of collection matching filter through the /export handler,
+// which only returns docValues fields. fields are exported unless filter selects the fields.
+func (dumper *SolrDump) exportDocuments(ctx context.Context, collection string, uniqueKey string, filter model.DumpFilter, fields []string, fn func(doc map[string]interface{}) error) error {
+	req := dumper.streamClient.R().SetDoNotParseResponse(true).SetContext(ctx)
+	params := queryParams(filter, strings.Join(fields, ","))
+	params.Set("sort", uniqueKey+" asc")
+	req.SetQueryParamsFromValues(params)
+	res, err := req.Get(fmt.Sprintf("/solr/%s/export", collection))
+	if err != nil {
+		return fmt.Errorf("failed to send http request to export documents: %v", err)
+	}
+	_, err = dumper.streamDocuments(res, func(doc map[string]interface{}) error {
+		// the export handler reports errors that occur while streaming as a document
+		if exception, ok := doc["EXCEPTION"]; ok {
+			return fmt.Errorf("export failed: %v", exception)
+		}
+		return fn(doc)
+	})
+	return err
+}
+
+// queryParams returns the q, fq and fl parameters selecting the documents and fields of filter.
+func queryParams(filter model.DumpFilter, fl string) url.Values {
+	params := url.Values{}
+	params.Set("q", "*:*")
+	if filter.Query != "" {
+		params.Set("q", filter.Query)
+	}
+	for _, fq := range filter.FilterQueries {
+		params.Add("fq", fq)
+	}
+	if len(filter.Fields) > 0 {
+		fl = strings.Join(filter.Fields, ",")
+	}
+	params.Set("fl", fl)
+	params.Set("wt", "json")
+	return params
+}
+
+// streamDocuments decodes a search response, passing every document of response.docs to fn as
+// it is read instead of holding the whole response in memory. Numbers in the documents are kept
+// as json.Number, so that long values don't lose precision. The rest of the response is returned.
+func (dumper *SolrDump) streamDocuments(res *resty.Response, fn func(doc map[string]interface{}) error) (map[string]interface{}, error) {
+	body := res.RawBody()
+	defer func() {
+		if err := body.Close(); err != nil {
+			klog.Errorf("failed to close response body: %v", err)
+		}
+	}()
+	dec := json.NewDecoder(body)
+	dec.UseNumber()
+	decodeObject := func(into map[string]interface{}, field func(key string) error) error {
+		if err := expectDelim(dec, '{'); err != nil {
+			return err
+		}
+		for dec.More() {
+			token, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			key, _ := token.(string)
+			if field != nil {
+				if err := field(key); err != errSkipField {
+					if err != nil {
+						return err
+					}
+					continue
+				}
+			}
+			// everything but the documents is decoded like decodeResponse does
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return err
+			}
+			var value interface{}
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return err
+			}
+			into[key] = value
+		}
+		return expectDelim(dec, '}')
+	}
+
+	responseBody := make(map[string]interface{})
+	err := decodeObject(responseBody, func(key string) error {
+		if key != "response" {
+			return errSkipField
+		}
+		response := make(map[string]interface{})
+		responseBody["response"] = response
+		return decodeObject(response, func(key string) error {
+			if key != "docs" {
+				return errSkipField
+			}
+			if err := expectDelim(dec, '['); err != nil {
+				return err
+			}
+			for dec.More() {
+				doc := make(map[string]interface{})
+				if err := dec.Decode(&doc); err != nil {
+					return err
+				}
+				if err := fn(doc); err != nil {
+					return &docsError{err}
+				}
+			}
+			return expectDelim(dec, ']')
+		})
+	})
+	if de, ok := err.(*docsError); ok {
+		return nil, de.err
+	}
+	if err != nil {
+		if _, serr := dumper.slClient.GetResponseStatus(responseBody); serr != nil {
+			return responseBody, serr
+		}
+		return nil, fmt.Errorf("failed to deserialize the response with status code %d: %v", res.StatusCode(), err)
+	}
+	if _, err := dumper.slClient.GetResponseStatus(responseBody); err != nil {
+		return responseBody, err
+	}
+	return responseBody, nil
+}
+
+var errSkipField = fmt.Errorf("skip field")
+
+// docsError wraps an error returned for a document, to tell it apart from decoding errors.
+type docsError struct {
+	err error
+}
+
+func (e *docsError) Error() string {
+	return e.err.Error()
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %v, found %v", delim, token)
+	}
+	return nil
+}
+
+// schemaFields returns the explicitly defined fields of the schema of collection, with their defaults.
+func (dumper *SolrDump) schemaFields(ctx context.Context, collection string) ([]map[string]interface{}, error) {
+	return dumper.schemaList(ctx, collection, "fields")
+}
+
+// dynamicFields returns the dynamic fields of the schema of collection, with their defaults.
+func (dumper *SolrDump) dynamicFields(ctx context.Context, collection string) ([]map[string]interface{}, error) {
+	return dumper.schemaList(ctx, collection, "dynamicFields")
+}
+
+// fieldTypes returns the class of every field type of the schema of collection.
+func (dumper *SolrDump) fieldTypes(ctx context.Context, collection string) (map[string]string, error) {
+	list, err := dumper.schemaList(ctx, collection, "fieldTypes")
+	if err != nil {
+		return nil, err
+	}
+	types := map[string]string{}
+	for _, fieldType := range list {
+		name, _ := fieldType["name"].(string)
+		types[name], _ = fieldType["class"].(string)
+	}
+	return types, nil
+}
+
+// schemaList returns the entries of a schema api list, e.g. fields, with their defaults.
+func (dumper *SolrDump) schemaList(ctx context.Context, collection string, kind string) ([]map[string]interface{}, error) {
+	req := dumper.slClient.Client.R().SetDoNotParseResponse(true).SetContext(ctx)
+	req.SetQueryParams(map[string]string{
+		"showDefaults": "true",
+		"wt":           "json",
+	})
+	res, err := req.Get(fmt.Sprintf("/solr/%s/schema/%s", collection, strings.ToLower(kind)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send http request to get schema %s: %v", kind, err)
+	}
+	responseBody, err := dumper.decodeResponse(res)
+	if err != nil {
+		return nil, err
+	}
+	list, _ := responseBody[kind].([]interface{})
+	var entries []map[string]interface{}
+	for _, e := range list {
+		if entry, ok := e.(map[string]interface{}); ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// updateDocuments adds docs to collection. retry is set if solr is overloaded or failed with a
+// server error, the request may then succeed when sent again.
+func (dumper *SolrDump) updateDocuments(ctx context.Context, collection string, docs []map[string]interface{}, commitWithin time.Duration) (retry bool, err error) {
+	req := dumper.streamClient.R().SetDoNotParseResponse(true).SetContext(ctx)
+	params := map[string]string{
+		"wt": "json",
+	}
+	if commitWithin > 0 {
+		params["commitWithin"] = strconv.FormatInt(commitWithin.Milliseconds(), 10)
+	}
+	req.SetQueryParams(params)
+	req.SetHeader("Content-Type", "application/json")
+	req.SetBody(docs)
+	res, err := req.Post(fmt.Sprintf("/solr/%s/update", collection))
+	if err != nil {
+		// the request may not have reached solr
+		return ctx.Err() == nil, fmt.Errorf("failed to send http request to update documents: %v", err)
+	}
+	retry = res.StatusCode() == http.StatusTooManyRequests || res.StatusCode() >= http.StatusInternalServerError
+	if _, err := dumper.decodeResponse(res); err != nil {
+		return retry, err
+	}
+	if res.StatusCode() != http.StatusOK {
+		return retry, fmt.Errorf("failed to update documents, status code %d", res.StatusCode())
+	}
+	return false, nil
+}
+
+// commit makes the documents added to collection visible.
+func (dumper *SolrDump) commit(ctx context.Context, collection string) error {
+	req := dumper.streamClient.R().SetDoNotParseResponse(true).SetContext(ctx)
+	req.SetQueryParams(map[string]string{
+		"commit": "true",
+		"wt":     "json",
+	})
+	res, err := req.Get(fmt.Sprintf("/solr/%s/update", collection))
+	if err != nil {
+		return fmt.Errorf("failed to send http request to commit: %v", err)
+	}
+	_, err = dumper.decodeResponse(res)
+	return err
+}
+
+// copyFieldTargets returns the destinations of the copy fields of the schema of collection. They may be globs.
+func (dumper *SolrDump) copyFieldTargets(ctx context.Context, collection string) ([]string, error) {
+	req := dumper.slClient.Client.R().SetDoNotParseResponse(true).SetContext(ctx)
+	req.SetQueryParam("wt", "json")
+	res, err := req.Get(fmt.Sprintf("/solr/%s/schema/copyfields", collection))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send http request to get copy fields: %v", err)
+	}
+	responseBody, err := dumper.decodeResponse(res)
+	if err != nil {
+		return nil, err
+	}
+	list, _ := responseBody["copyFields"].([]interface{})
+	var targets []string
+	for _, cf := range list {
+		copyField, _ := cf.(map[string]interface{})
+		if dest, ok := copyField["dest"].(string); ok {
+			targets = append(targets, dest)
+		}
+	}
+	return targets, nil
+}
+
+// createCollection creates collection with the given CREATE parameters and waits for it.
+func (dumper *SolrDump) createCollection(ctx context.Context, collection string, createParams map[string]string) error {
+	req := dumper.slClient.Client.R().SetDoNotParseResponse(true).SetContext(ctx)
+	params := map[string]string{
+		"action": "CREATE",
+		"name":   collection,
+		"wt":     "json",
+	}
+	for key, value := range createParams {
+		params[key] = value
+	}
+	req.SetQueryParams(params)
+	res, err := req.Get("/solr/admin/collections")
+	if err != nil {
+		return fmt.Errorf("failed to send http request to create collection %s: %v", collection, err)
+	}
+	_, err = dumper.decodeResponse(res)
+	return err
+}
+
+// deleteCollection deletes collection along with its data.
+func (dumper *SolrDump) deleteCollection(ctx context.Context, collection string) error {
+	req := dumper.slClient.Client.R().SetDoNotParseResponse(true).SetContext(ctx)
+	req.SetQueryParams(map[string]string{
+		"action": "DELETE",
+		"name":   collection,
+		"wt":     "json",
+	})
+	res, err := req.Get("/solr/admin/collections")
+	if err != nil {
+		return fmt.Errorf("failed to send http request to delete collection %s: %v", collection, err)
+	}
+	_, err = dumper.decodeResponse(res)
+	return err
+}
+
+// zkAPIs are the zookeeper read apis of solr 9 and solr 8, for listing children and reading data.
+var zkAPIs = map[string][]string{
+	"children": {"/api/cluster/zookeeper/children", "/api/cluster/zk/ls"},
+	"data":     {"/api/cluster/zookeeper/data", "/api/cluster/zk/data"},
+}
+
+// zkGet sends a zookeeper read request for zkPath. The solr 8 api is only tried if solr doesn't
+// know the solr 9 one. The caller must close the response body.
+func (dumper *SolrDump) zkGet(ctx context.Context, kind string, zkPath string) (*resty.Response, error) {
+	apis := zkAPIs[kind]
+	for i, api := range apis {
+		req := dumper.slClient.Client.R().SetDoNotParseResponse(true).SetContext(ctx)
+		res, err := req.Get(api + zkPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send http request to read zookeeper path %s: %v", zkPath, err)
+		}
+		if res.StatusCode() == http.StatusNotFound && i < len(apis)-1 {
+			_ = res.RawBody().Close()
+			continue
+		}
+		return res, nil
+	}
+	return nil, fmt.Errorf("no zookeeper api for %s", kind)
+}
+
+// zkChildren returns the children of zkPath with their number of children.
+func (dumper *SolrDump) zkChildren(ctx context.Context, zkPath string) (map[string]int, error) {
+	res, err := dumper.zkGet(ctx, "children", zkPath)
+	if err != nil {
+		return nil, err
+	}
+	responseBody, err := dumper.decodeResponse(res)
+	if err != nil {
+		return nil, err
+	}
+	children := map[string]int{}
+	for key, value := range responseBody {
+		node, ok := value.(map[string]interface{})
+		if !ok || key == "responseHeader" {
+			continue
+		}
+		for name, stat := range node {
+			s, _ := stat.(map[string]interface{})
+			children[name] = toInt(s["numChildren"])
+		}
+	}
+	return children, nil
+}
+
+// zkData returns the data of zkPath. found is false if the node doesn't exist.
+func (dumper *SolrDump) zkData(ctx context.Context, zkPath string) (data []byte, found bool, err error) {
+	res, err := dumper.zkGet(ctx, "data", zkPath)
+	if err != nil {
+		return nil, false, err
+	}
+	body := res.RawBody()
+	defer func() {
+		if err := body.Close(); err != nil {
+			klog.Errorf("failed to close response body: %v", err)
+		}
+	}()
+	if res.StatusCode() == http.StatusNotFound {
+		return nil, false, nil
+	}
+	data, err = io.ReadAll(body)
+	if err != nil {
+		return nil, false, err
+	}
+	if res.StatusCode() != http.StatusOK {
+		return nil, false, fmt.Errorf("failed to read zookeeper path %s, status code %d: %s", zkPath, res.StatusCode(), data)
+	}
+	return data, true, nil
+}
+
+// configSets returns the names of the config sets of the cluster.
+func (dumper *SolrDump) configSets(ctx context.Context) ([]string, error) {
+	req := dumper.slClient.Client.R().SetDoNotParseResponse(true).SetContext(ctx)
+	req.SetQueryParams(map[string]string{
+		"action": "LIST",
+		"wt":     "json",
+	})
+	res, err := req.Get("/solr/admin/configs")
+	if err != nil {
+		return nil, fmt.Errorf("failed to send http request to list config sets: %v", err)
+	}
+	responseBody, err := dumper.decodeResponse(res)
+	if err != nil {
+		return nil, err
+	}
+	list, _ := responseBody["configSets"].([]interface{})
+	var names []string
+	for _, name := range list {
+		if n, ok := name.(string); ok {
+			names = append(names, n)
+		}
+	}
+	return names, nil
+}
+
+// uploadConfigSet creates config set name from a zip file.
+func (dumper *SolrDump) uploadConfigSet(ctx context.Context, name string, data []byte) error {
+	req := dumper.slClient.Client.R().SetDoNotParseResponse(true).SetContext(ctx)
+	req.SetQueryParams(map[string]string{
+		"action": "UPLOAD",
+		"name":   name,
+		"wt":     "json",
+	})
+	req.SetHeader("Content-Type", "application/octet-stream")
+	req.SetBody(data)
+	res, err := req.Post("/solr/admin/configs")
+	if err != nil {
+		return fmt.Errorf("failed to send http request to upload config set %s: %v", name, err)
+	}
+	_, err = dumper.decodeResponse(res)
+	return err
+}
+
+// aliases returns the collection aliases of the cluster and their properties.
+func (dumper *SolrDump) aliases(ctx context.Context) (map[string]string, map[string]map[string]string, error) {
+	req := dumper.slClient.Client.R().SetDoNotParseResponse(true).SetContext(ctx)
+	req.SetQueryParams(map[string]string{
+		"action": "LISTALIASES",
+		"wt":     "json",
+	})
+	res, err := req.Get("/solr/admin/collections")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to send http request to list aliases: %v", err)
+	}
+	responseBody, err := dumper.decodeResponse(res)
+	if err != nil {
+		return nil, nil, err
+	}
+	aliases := map[string]string{}
+	list, _ := responseBody["aliases"].(map[string]interface{})
+	for name, collections := range list {
+		aliases[name] = fmt.Sprint(collections)
+	}
+	properties := map[string]map[string]string{}
+	props, _ := responseBody["properties"].(map[string]interface{})
+	for name, p := range props {
+		values, _ := p.(map[string]interface{})
+		if len(values) == 0 {
+			continue
+		}
+		properties[name] = map[string]string{}
+		for key, value := range values {
+			properties[name][key] = fmt.Sprint(value)
+		}
+	}
+	return aliases, properties, nil
+}
+
+// createAlias points alias name to collections and sets its properties.
+func (dumper *SolrDump) createAlias(ctx context.Context, name string, collections string, properties map[string]string) error {
+	req := dumper.slClient.Client.R().SetDoNotParseResponse(true).SetContext(ctx)
+	req.SetQueryParams(map[string]string{
+		"action":      "CREATEALIAS",
+		"name":        name,
+		"collections": collections,
+		"wt":          "json",
+	})
+	res, err := req.Get("/solr/admin/collections")
+	if err != nil {
+		return fmt.Errorf("failed to send http request to create alias %s: %v", name, err)
+	}
+	if _, err := dumper.decodeResponse(res); err != nil || len(properties) == 0 {
+		return err
+	}
+
+	params := map[string]string{
+		"action": "ALIASPROP",
+		"name":   name,
+		"wt":     "json",
+	}
+	for key, value := range properties {
+		params["property."+key] = value
+	}
+	req = dumper.slClient.Client.R().SetDoNotParseResponse(true).SetContext(ctx)
+	req.SetQueryParams(params)
+	res, err = req.Get("/solr/admin/collections")
+	if err != nil {
+		return fmt.Errorf("failed to send http request to set properties of alias %s: %v", name, err)
+	}
+	_, err = dumper.decodeResponse(res)
+	return err
+}
+
+// setClusterProperty sets a cluster property. Nested properties, e.g. collectionDefaults,
+// are set as objects through the v2 api.
+func (dumper *SolrDump) setClusterProperty(ctx context.Context, name string, value interface{}) error {
+	req := dumper.slClient.Client.R().SetDoNotParseResponse(true).SetContext(ctx)
+	var res *resty.Response
+	var err error
+	if _, ok := value.(map[string]interface{}); ok {
+		req.SetHeader("Content-Type", "application/json")
+		req.SetBody(map[string]interface{}{
+			"set-obj-property": map[string]interface{}{name: value},
+		})
+		res, err = req.Post("/api/cluster")
+	} else {
+		var val string
+		if val, err = clusterPropertyValue(value); err != nil {
+			return fmt.Errorf("failed to encode cluster property %s: %v", name, err)
+		}
+		req.SetQueryParams(map[string]string{
+			"action": "CLUSTERPROP",
+			"name":   name,
+			"val":    val,
+			"wt":     "json",
+		})
+		res, err = req.Get("/solr/admin/collections")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to send http request to set cluster property %s: %v", name, err)
+	}
+	_, err = dumper.decodeResponse(res)
+	return err
+}
+
+// clusterPropertyValue returns a scalar cluster property as the CLUSTERPROP action expects it. Numbers
+// and booleans are written as json, so that a number read as float64 isn't sent in exponent notation.
+func clusterPropertyValue(value interface{}) (string, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// solrVersion returns the version reported by the solr node the client is connected to.
+func (dumper *SolrDump) solrVersion(ctx context.Context) (string, error) {
+	req := dumper.slClient.Client.R().SetDoNotParseResponse(true).SetContext(ctx)
+	res, err := req.Get("/solr/admin/info/system?wt=json")
+	if err != nil {
+		return "", fmt.Errorf("failed to send http request to get system info: %v", err)
+	}
+	responseBody, err := dumper.decodeResponse(res)
+	if err != nil {
+		return "", err
+	}
+	lucene, _ := responseBody["lucene"].(map[string]interface{})
+	version, ok := lucene["solr-spec-version"].(string)
+	if !ok {
+		return "", fmt.Errorf("didn't find solr-spec-version")
+	}
+	return version, nil
+}
+
+// decodeResponse decodes the json body of a solr response and checks its status.
+func (dumper *SolrDump) decodeResponse(res *resty.Response) (map[string]interface{}, error) {
+	body := res.RawBody()
+	defer func() {
+		if err := body.Close(); err != nil {
+			klog.Errorf("failed to close response body: %v", err)
+		}
+	}()
+	responseBody := make(map[string]interface{})
+	if err := json.NewDecoder(body).Decode(&responseBody); err != nil {
+		return nil, fmt.Errorf("failed to deserialize the response with status code %d: %v", res.StatusCode(), err)
+	}
+	if _, err := dumper.slClient.GetResponseStatus(responseBody); err != nil {
+		return responseBody, err
+	}
+	return responseBody, nil
+}
@@ -0,0 +1,283 @@
+package solr_dump
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pritamdas99/solr-dump/model"
+	"k8s.io/klog/v2"
+)
+
+const (
+	configSetsDir = "configsets"
+	// defaultConfigSet ships with every solr, it is neither exported nor uploaded
+	defaultConfigSet = "_default"
+)
+
+func configSetPath(runId string, name string) string {
+	return path.Join(runDir(runId), configSetsDir, name+".zip")
+}
+
+// exportClusterMetadata stores the config sets of the cluster in the metadata directory of the run and
+// records the aliases and cluster properties in the manifest.
+func (dumper *SolrDump) exportClusterMetadata(ctx context.Context) error {
+	md := &model.ClusterMetadata{ConfigSetSHA256: map[string]string{}}
+	dumper.cluster.Metadata = md
+
+	names, err := dumper.configSets(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list config sets: %v", err)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == defaultConfigSet {
+			continue
+		}
+		data, err := dumper.zipConfigSet(ctx, name)
+		if err != nil {
+			klog.Errorf("failed to download config set %s: %v", name, err)
+			continue
+		}
+		if err := dumper.bl.Put(ctx, configSetPath(dumper.report.RunId, name), bytes.NewReader(data)); err != nil {
+			klog.Errorf("failed to store config set %s: %v", name, err)
+			continue
+		}
+		md.ConfigSets = append(md.ConfigSets, name)
+		md.ConfigSetSHA256[name] = sha256Hex(data)
+		klog.Infof("exported config set %s", name)
+	}
+
+	md.Aliases, md.AliasProperties, err = dumper.aliases(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list aliases: %v", err)
+	}
+
+	md.Properties, err = dumper.clusterProperties(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read cluster properties: %v", err)
+	}
+	return nil
+}
+
+// zipConfigSet downloads config set name from zookeeper as a zip file, in the layout the
+// configset UPLOAD api expects.
+func (dumper *SolrDump) zipConfigSet(ctx context.Context, name string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	root := "/configs/" + name
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		children, err := dumper.zkChildren(ctx, dir)
+		if err != nil {
+			return err
+		}
+		for child, numChildren := range children {
+			node := dir + "/" + child
+			if numChildren > 0 {
+				if err := walk(node); err != nil {
+					return err
+				}
+				continue
+			}
+			data, _, err := dumper.zkData(ctx, node)
+			if err != nil {
+				return err
+			}
+			w, err := zw.CreateHeader(&zip.FileHeader{
+				Name:     strings.TrimPrefix(node, root+"/"),
+				Method:   zip.Deflate,
+				Modified: time.Now(),
+			})
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(root); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// clusterProperties returns the content of clusterprops.json, which doesn't exist until a property is set.
+func (dumper *SolrDump) clusterProperties(ctx context.Context) (map[string]interface{}, error) {
+	data, found, err := dumper.zkData(ctx, "/clusterprops.json")
+	if err != nil || !found || len(bytes.TrimSpace(data)) == 0 {
+		return nil, err
+	}
+	// numbers are kept as written, a float64 would turn 100000000 into 1e+08
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	props := map[string]interface{}{}
+	if err := dec.Decode(&props); err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+// restoreMetadata returns the cluster metadata to recreate before a restore. It is taken from the
+// manifest of dumper.fromRun, or else from the newest backup run that exported it.
+func (dumper *SolrDump) restoreMetadata(ctx context.Context) (string, *model.ClusterMetadata, error) {
+	if dumper.fromRun != "" {
+		m, err := ReadManifest(ctx, dumper.bl, dumper.fromRun)
+		if err != nil {
+			return "", nil, err
+		}
+		return m.RunId, m.Cluster.Metadata, nil
+	}
+
+	objects, err := dumper.bl.List(ctx, path.Join(model.MetadataDir, "runs"))
+	if err != nil {
+		return "", nil, err
+	}
+	var latest *model.Manifest
+	for _, obj := range objects {
+		runId, ok := isManifestPath(obj)
+		if !ok {
+			continue
+		}
+		m, err := ReadManifest(ctx, dumper.bl, runId)
+		if err != nil {
+			klog.Warning(err)
+			continue
+		}
+		if m.Cluster.Metadata != nil && (latest == nil || m.EndTime.After(latest.EndTime)) {
+			latest = m
+		}
+	}
+	if latest == nil {
+		return "", nil, nil
+	}
+	return latest.RunId, latest.Cluster.Metadata, nil
+}
+
+// restoreClusterMetadata sets the recorded cluster properties and uploads the recorded config sets,
+// which the restored collections may depend on. Properties and config sets that already exist are
+// left untouched.
+func (dumper *SolrDump) restoreClusterMetadata(ctx context.Context, runId string, md *model.ClusterMetadata) {
+	current, err := dumper.clusterProperties(ctx)
+	if err != nil {
+		klog.Errorf("failed to read cluster properties, not restoring them: %v", err)
+	} else {
+		for name, value := range md.Properties {
+			if _, ok := current[name]; ok {
+				klog.Infof("cluster property %s is already set, not restoring it", name)
+				continue
+			}
+			if err := dumper.setClusterProperty(ctx, name, value); err != nil {
+				klog.Errorf("failed to restore cluster property %s: %v", name, err)
+				continue
+			}
+			klog.Infof("restored cluster property %s", name)
+		}
+	}
+
+	existing, err := dumper.configSets(ctx)
+	if err != nil {
+		klog.Errorf("failed to list config sets, not restoring them: %v", err)
+		return
+	}
+	for _, name := range md.ConfigSets {
+		if slices.Contains(existing, name) {
+			klog.Infof("config set %s already exists, not restoring it", name)
+			continue
+		}
+		r, err := dumper.bl.NewReader(ctx, configSetPath(runId, name))
+		if err != nil {
+			klog.Errorf("failed to read config set %s of run %s: %v", name, runId, err)
+			continue
+		}
+		data, err := io.ReadAll(r)
+		_ = r.Close()
+		if err == nil {
+			err = checkSHA256(configSetPath(runId, name), data, md.ConfigSetSHA256[name])
+		}
+		if err != nil {
+			klog.Errorf("failed to read config set %s of run %s: %v", name, runId, err)
+			continue
+		}
+		if err := dumper.uploadConfigSet(ctx, name, data); err != nil {
+			klog.Errorf("failed to restore config set %s: %v", name, err)
+			continue
+		}
+		klog.Infof("restored config set %s", name)
+	}
+}
+
+// restoreAliases creates the recorded aliases whose collections were all restored by this run,
+// pointing them to the restored collections. Routed aliases are managed by solr and skipped.
+func (dumper *SolrDump) restoreAliases(ctx context.Context, md *model.ClusterMetadata) {
+	if len(md.Aliases) == 0 {
+		return
+	}
+	existing, _, err := dumper.aliases(ctx)
+	if err != nil {
+		klog.Errorf("failed to list aliases, not restoring them: %v", err)
+		return
+	}
+	restored := map[string]string{}
+	for _, cr := range dumper.report.Collections {
+		if cr.Status == model.CollectionCompleted {
+			restored[cr.Source] = cr.Collection
+		}
+	}
+
+	names := make([]string, 0, len(md.Aliases))
+	for name := range md.Aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := existing[name]; ok {
+			klog.Infof("alias %s already exists, not restoring it", name)
+			continue
+		}
+		props := md.AliasProperties[name]
+		if isRoutedAlias(props) {
+			klog.Warningf("alias %s is a routed alias, it has to be recreated manually", name)
+			continue
+		}
+		var targets []string
+		for _, collection := range strings.Split(md.Aliases[name], ",") {
+			target, ok := restored[strings.TrimSpace(collection)]
+			if !ok {
+				break
+			}
+			targets = append(targets, target)
+		}
+		if len(targets) != len(strings.Split(md.Aliases[name], ",")) {
+			klog.Infof("not every collection of alias %s was restored, not restoring it", name)
+			continue
+		}
+		if err := dumper.createAlias(ctx, name, strings.Join(targets, ","), props); err != nil {
+			klog.Errorf("failed to restore alias %s: %v", name, err)
+			continue
+		}
+		klog.Infof("restored alias %s -> %s", name, strings.Join(targets, ","))
+	}
+}
+
+func isRoutedAlias(props map[string]string) bool {
+	for key := range props {
+		if strings.HasPrefix(key, "router.") {
+			return true
+		}
+	}
+	return false
+}
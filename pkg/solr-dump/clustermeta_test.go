@@ -0,0 +1,199 @@
+package solr_dump
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pritamdas99/solr-dump/model"
+)
+
+// aliasSolr serves the alias actions of the collections api. It lists the aliases in existing and
+// records the aliases created, and the properties set on them.
+type aliasSolr struct {
+	t          *testing.T
+	mu         sync.Mutex
+	existing   map[string]string
+	created    map[string]string
+	properties map[string]map[string]string
+}
+
+func (s *aliasSolr) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	query := r.URL.Query()
+	body := map[string]interface{}{"responseHeader": map[string]interface{}{"status": 0}}
+	switch {
+	case r.URL.Path != "/solr/admin/collections":
+		s.t.Errorf("unexpected request %s", r.URL)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case query.Get("action") == "LISTALIASES":
+		body["aliases"] = s.existing
+	case query.Get("action") == "CREATEALIAS":
+		s.created[query.Get("name")] = query.Get("collections")
+	case query.Get("action") == "ALIASPROP":
+		props := map[string]string{}
+		for key := range query {
+			if strings.HasPrefix(key, "property.") {
+				props[strings.TrimPrefix(key, "property.")] = query.Get(key)
+			}
+		}
+		s.properties[query.Get("name")] = props
+	default:
+		s.t.Errorf("unexpected request %s", r.URL)
+	}
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func TestRestoreAliases(t *testing.T) {
+	// c1 and c2 are restored to r1 and r2, restoring c3 failed
+	restored := []*model.CollectionReport{
+		{Collection: "r1", Source: "c1", Status: model.CollectionCompleted},
+		{Collection: "r2", Source: "c2", Status: model.CollectionCompleted},
+		{Collection: "c3", Source: "c3", Status: model.CollectionFailed},
+	}
+	tests := map[string]struct {
+		aliases    map[string]string
+		properties map[string]map[string]string
+		existing   map[string]string
+		created    map[string]string
+		// aliasProps are the properties set on the created aliases
+		aliasProps map[string]map[string]string
+	}{
+		"all collections restored": {
+			aliases: map[string]string{"a1": "c1", "a2": "c1,c2"},
+			created: map[string]string{"a1": "r1", "a2": "r1,r2"},
+		},
+		"collection not restored": {
+			aliases: map[string]string{"a1": "c1,c3", "a2": "c3", "a3": "c4", "a4": "c2"},
+			created: map[string]string{"a4": "r2"},
+		},
+		"routed alias": {
+			aliases: map[string]string{"a1": "c1", "a2": "c2"},
+			properties: map[string]map[string]string{
+				"a1": {"router.name": "time", "router.field": "date"},
+			},
+			created: map[string]string{"a2": "r2"},
+		},
+		"alias properties": {
+			aliases:    map[string]string{"a1": "c1"},
+			properties: map[string]map[string]string{"a1": {"owner": "search"}},
+			created:    map[string]string{"a1": "r1"},
+			aliasProps: map[string]map[string]string{"a1": {"owner": "search"}},
+		},
+		"alias exists": {
+			aliases:  map[string]string{"a1": "c1", "a2": "c2"},
+			existing: map[string]string{"a1": "other"},
+			created:  map[string]string{"a2": "r2"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			solr := &aliasSolr{t: t, existing: test.existing, created: map[string]string{}, properties: map[string]map[string]string{}}
+			dumper := newTestDumper(t, solr)
+			dumper.report.Collections = restored
+			dumper.restoreAliases(context.Background(), &model.ClusterMetadata{Aliases: test.aliases, AliasProperties: test.properties})
+
+			if !reflect.DeepEqual(solr.created, test.created) {
+				t.Errorf("created aliases %v, want %v", solr.created, test.created)
+			}
+			if test.aliasProps == nil {
+				test.aliasProps = map[string]map[string]string{}
+			}
+			if !reflect.DeepEqual(solr.properties, test.aliasProps) {
+				t.Errorf("set alias properties %v, want %v", solr.properties, test.aliasProps)
+			}
+		})
+	}
+}
+
+// propertySolr serves clusterprops.json from zookeeper and records the cluster properties set
+// through the collections api and the v2 api.
+type propertySolr struct {
+	t     *testing.T
+	mu    sync.Mutex
+	props string
+	set   map[string]string
+}
+
+func (s *propertySolr) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.URL.Path == "/api/cluster/zookeeper/data/clusterprops.json":
+		_, _ = w.Write([]byte(s.props))
+		return
+	case r.URL.Path == "/solr/admin/collections" && r.URL.Query().Get("action") == "CLUSTERPROP":
+		s.set[r.URL.Query().Get("name")] = r.URL.Query().Get("val")
+	case r.URL.Path == "/api/cluster":
+		var body map[string]map[string]json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			s.t.Errorf("invalid body: %v", err)
+		}
+		for name, value := range body["set-obj-property"] {
+			s.set[name] = string(value)
+		}
+	default:
+		s.t.Errorf("unexpected request %s", r.URL)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"responseHeader": map[string]interface{}{"status": 0}})
+}
+
+func TestSetClusterProperties(t *testing.T) {
+	const props = `{"maxCoresPerNode":100000000,"ratio":0.25,"urlScheme":"https","enabled":true,` +
+		`"collectionDefaults":{"numShards":2,"maxShardsPerNode":100000000}}`
+	want := map[string]string{
+		"maxCoresPerNode":    "100000000",
+		"ratio":              "0.25",
+		"urlScheme":          "https",
+		"enabled":            "true",
+		"collectionDefaults": `{"maxShardsPerNode":100000000,"numShards":2}`,
+	}
+	tests := map[string]struct {
+		// recorded returns the properties to restore as they are recorded by a run
+		recorded func(t *testing.T, props map[string]interface{}) map[string]interface{}
+	}{
+		"read from the cluster": {
+			recorded: func(t *testing.T, props map[string]interface{}) map[string]interface{} { return props },
+		},
+		// a manifest decodes numbers as float64
+		"read from a manifest": {
+			recorded: func(t *testing.T, props map[string]interface{}) map[string]interface{} {
+				data, err := json.Marshal(model.ClusterMetadata{Properties: props})
+				if err != nil {
+					t.Fatal(err)
+				}
+				var md model.ClusterMetadata
+				if err := json.Unmarshal(data, &md); err != nil {
+					t.Fatal(err)
+				}
+				return md.Properties
+			},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			solr := &propertySolr{t: t, props: props, set: map[string]string{}}
+			dumper := newTestDumper(t, solr)
+			current, err := dumper.clusterProperties(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, value := range test.recorded(t, current) {
+				if err := dumper.setClusterProperty(context.Background(), name, value); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !reflect.DeepEqual(solr.set, want) {
+				t.Errorf("set cluster properties %v, want %v", solr.set, want)
+			}
+		})
+	}
+}
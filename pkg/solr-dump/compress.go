@@ -0,0 +1,193 @@
+package solr_dump
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+	CompressionLZ4  = "lz4"
+)
+
+var Compressions = []string{CompressionGzip, CompressionZstd, CompressionLZ4, CompressionNone}
+
+// CompressionOptions configures the compression of the chunks of logical dumps and, optionally, of the
+// metadata files of a run. Compressed files are recognized by their content when they are read.
+type CompressionOptions struct {
+	// Codec is one of Compressions, gzip if it is empty.
+	Codec string
+	// Level trades cpu for size, 0 selects the default level of the codec.
+	Level int
+	// Metadata also compresses the manifest and the state of the run, which older versions of
+	// solr-dump can't read.
+	Metadata bool
+}
+
+func (o CompressionOptions) codec() string {
+	if o.Codec == "" {
+		return CompressionGzip
+	}
+	return o.Codec
+}
+
+// codec is a streaming compression format. Compressed streams start with magic, which is how
+// the decoder is picked when they are read.
+type codec struct {
+	// ext is appended to the names of compressed chunks
+	ext      string
+	magic    []byte
+	maxLevel int
+	// newWriter returns a writer compressing to w at level, 0 being the default of the codec.
+	// Closing it doesn't close w.
+	newWriter func(w io.Writer, level int) (io.WriteCloser, error)
+	newReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+var codecs = map[string]codec{
+	CompressionGzip: {
+		ext:      ".gz",
+		magic:    []byte{0x1f, 0x8b},
+		maxLevel: gzip.BestCompression,
+		newWriter: func(w io.Writer, level int) (io.WriteCloser, error) {
+			if level == 0 {
+				level = gzip.DefaultCompression
+			}
+			return gzip.NewWriterLevel(w, level)
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	},
+	CompressionZstd: {
+		ext:      ".zst",
+		magic:    []byte{0x28, 0xb5, 0x2f, 0xfd},
+		maxLevel: 22,
+		newWriter: func(w io.Writer, level int) (io.WriteCloser, error) {
+			if level == 0 {
+				level = 3
+			}
+			return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)), zstd.WithEncoderConcurrency(1), zstd.WithZeroFrames(true))
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			return d.IOReadCloser(), nil
+		},
+	},
+	CompressionLZ4: {
+		ext:      ".lz4",
+		magic:    []byte{0x04, 0x22, 0x4d, 0x18},
+		maxLevel: 9,
+		newWriter: func(w io.Writer, level int) (io.WriteCloser, error) {
+			z := lz4.NewWriter(w)
+			if err := z.Apply(lz4.CompressionLevelOption(lz4Level(level)), lz4.ChecksumOption(true)); err != nil {
+				return nil, err
+			}
+			return z, nil
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(lz4.NewReader(r)), nil
+		},
+	},
+}
+
+// lz4Level returns the lz4 compression level of level. Like the lz4 command line tool, 0 and 1 select
+// the fast compressor and higher levels the slower high compression one.
+func lz4Level(level int) lz4.CompressionLevel {
+	if level <= 1 {
+		return lz4.Fast
+	}
+	return lz4.CompressionLevel(1 << (8 + level))
+}
+
+// ValidateCompression checks that level is supported by compression, 0 selects the default level.
+func ValidateCompression(compression string, level int) error {
+	if compression == CompressionNone {
+		if level != 0 {
+			return fmt.Errorf("a compression level requires a compression")
+		}
+		return nil
+	}
+	c, ok := codecs[compression]
+	if !ok {
+		return fmt.Errorf("unknown compression %s, supported values are %v", compression, Compressions)
+	}
+	if level < 0 || level > c.maxLevel {
+		return fmt.Errorf("compression level of %s must be between 1 and %d", compression, c.maxLevel)
+	}
+	return nil
+}
+
+// compressionExt returns the extension of files compressed with compression.
+func compressionExt(compression string) string {
+	return codecs[compression].ext
+}
+
+// newCompressor returns a writer compressing to w, or w itself without a compression.
+func newCompressor(w io.Writer, compression string, level int) (io.WriteCloser, error) {
+	c, ok := codecs[compression]
+	if !ok {
+		return nopWriteCloser{w}, nil
+	}
+	return c.newWriter(w, level)
+}
+
+// newDecompressor returns a reader that decompresses r with the codec its magic identifies. Streams
+// that don't start with the magic of a codec are read as they are.
+func newDecompressor(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	for _, c := range codecs {
+		if magic, err := br.Peek(len(c.magic)); err == nil && bytes.Equal(magic, c.magic) {
+			return c.newReader(br)
+		}
+	}
+	return io.NopCloser(br), nil
+}
+
+// compressBytes compresses data as a whole, for metadata files.
+func compressBytes(data []byte, compression string, level int) ([]byte, error) {
+	if _, ok := codecs[compression]; !ok {
+		return data, nil
+	}
+	buf := &bytes.Buffer{}
+	w, err := newCompressor(buf, compression, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressBytes decompresses data read from a file that may be compressed.
+func decompressBytes(data []byte) ([]byte, error) {
+	r, err := newDecompressor(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
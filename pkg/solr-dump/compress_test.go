@@ -0,0 +1,172 @@
+package solr_dump
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// compressible returns n bytes of json lines, half of them repeated.
+func compressible(n int) []byte {
+	var b bytes.Buffer
+	for i := 0; b.Len() < n; i++ {
+		fmt.Fprintf(&b, "{\"id\": \"doc-%d\", \"title\": \"solr backup %d\"}\n", i, i%10)
+	}
+	data := b.Bytes()[:n]
+	copy(data[n/2:], randomBytes(n-n/2))
+	return data
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	sizes := []int{0, 1, 1000, 70 << 10, 9<<20 + 7}
+	for _, compression := range Compressions {
+		levels := []int{0}
+		if c, ok := codecs[compression]; ok {
+			levels = []int{0, 1, c.maxLevel}
+		}
+		for _, level := range levels {
+			for _, size := range sizes {
+				if size > 1<<20 && level > 1 {
+					// slow and not any different from the default level
+					continue
+				}
+				t.Run(fmt.Sprintf("%s/%d/%d", compression, level, size), func(t *testing.T) {
+					data := compressible(size)
+					compressed, err := compressBytes(data, compression, level)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if c, ok := codecs[compression]; ok && !bytes.HasPrefix(compressed, c.magic) {
+						t.Errorf("compressed data doesn't start with the magic of %s", compression)
+					}
+					got, err := decompressBytes(compressed)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !bytes.Equal(got, data) {
+						t.Errorf("decompressed %d bytes, want the %d bytes compressed", len(got), len(data))
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestDecompressCorrupted(t *testing.T) {
+	data := compressible(200 << 10)
+	for compression := range codecs {
+		compressed, err := compressBytes(data, compression, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		flipped := bytes.Clone(compressed)
+		flipped[len(flipped)/2] ^= 0x55
+		tests := map[string][]byte{
+			"truncated header": compressed[:len(codecs[compression].magic)+2],
+			"truncated":        compressed[:len(compressed)/2],
+			"end missing":      compressed[:len(compressed)-1],
+			"byte flipped":     flipped,
+		}
+		for name, corrupted := range tests {
+			t.Run(compression+"/"+name, func(t *testing.T) {
+				if got, err := decompressBytes(corrupted); err == nil {
+					t.Errorf("decompressed %d bytes of corrupted data", len(got))
+				}
+			})
+		}
+	}
+}
+
+func TestDecompressLZ4Corrupted(t *testing.T) {
+	data := bytes.Repeat([]byte("solr-dump "), 100)
+	frame, err := compressBytes(data, CompressionLZ4, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the 7 byte frame header, the size of the only block, the block, the end mark and the content checksum
+	const header, block = 7, 11
+	if got, err := decompressBytes(frame); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("got %d bytes, %v, want the frame to decompress", len(got), err)
+	}
+	corrupt := func(change func(frame []byte) []byte) []byte {
+		return change(bytes.Clone(frame))
+	}
+
+	tests := map[string][]byte{
+		"header checksum": corrupt(func(f []byte) []byte {
+			f[header-1] ^= 0xff
+			return f
+		}),
+		"block size": corrupt(func(f []byte) []byte {
+			f[header+2] = 0x50
+			return f
+		}),
+		// the first sequence of the block copies the 10 bytes before, it can't reach before the start
+		"match offset": corrupt(func(f []byte) []byte {
+			f[block+11], f[block+12] = 0xff, 0xff
+			return f
+		}),
+		"content checksum": corrupt(func(f []byte) []byte {
+			f[len(f)-1] ^= 0xff
+			return f
+		}),
+		"truncated block":    frame[:block+10],
+		"truncated checksum": frame[:len(frame)-2],
+	}
+	for name, corrupted := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got, err := decompressBytes(corrupted); err == nil {
+				t.Errorf("decompressed %d bytes of a frame with a bad %s", len(got), name)
+			}
+		})
+	}
+}
+
+func TestDecompressLZ4CommandLine(t *testing.T) {
+	// written by lz4 1.9.4 with linked blocks of 64 KB and block checksums, followed by a second frame:
+	// lz4 -BD -BX -B4 a.jsonl && lz4 b.txt && cat a.jsonl.lz4 b.txt.lz4
+	compressed, err := os.ReadFile("testdata/cli.jsonl.lz4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want strings.Builder
+	for i := 0; i < 4000; i++ {
+		fmt.Fprintf(&want, "{\"id\": \"doc-%d\", \"title\": \"solr backup %d\"}", i, i%10)
+		want.WriteString("\n")
+	}
+	want.WriteString("second frame\n")
+
+	got, err := decompressBytes(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want.String() {
+		t.Errorf("decompressed %d bytes, want %d", len(got), want.Len())
+	}
+}
+
+func TestValidateCompression(t *testing.T) {
+	tests := []struct {
+		compression string
+		level       int
+		valid       bool
+	}{
+		{CompressionNone, 0, true},
+		{CompressionNone, 1, false},
+		{CompressionGzip, 0, true},
+		{CompressionGzip, 9, true},
+		{CompressionGzip, 10, false},
+		{CompressionZstd, 22, true},
+		{CompressionZstd, -1, false},
+		{CompressionLZ4, 9, true},
+		{CompressionLZ4, 10, false},
+		{"brotli", 0, false},
+	}
+	for _, test := range tests {
+		if err := ValidateCompression(test.compression, test.level); (err == nil) != test.valid {
+			t.Errorf("ValidateCompression(%s, %d) = %v, want valid %v", test.compression, test.level, err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package solr_dump
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+	dbc "kubedb.dev/db-client-go/solr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ConnectionOptions tells solr-dump how to reach solr. If SolrURL is set the KubeDB Solr
+// object is not looked up and solr is accessed directly, otherwise the Solr object
+// DB/Namespace is read from the cluster selected by Kubeconfig and KubeContext.
+type ConnectionOptions struct {
+	Kubeconfig  string
+	KubeContext string
+
+	SolrURL            string
+	Username           string
+	PasswordFile       string
+	CACertFile         string
+	ClientCertFile     string
+	ClientKeyFile      string
+	InsecureSkipVerify bool
+}
+
+// newKubeConfig returns the rest config of the cluster. Without an explicit kubeconfig or context
+// the in-cluster config is used, falling back to the default kubeconfig loading rules.
+func newKubeConfig(opts ConnectionOptions) (*rest.Config, error) {
+	if opts.Kubeconfig == "" && opts.KubeContext == "" {
+		config, err := rest.InClusterConfig()
+		if err == nil {
+			return config, nil
+		}
+		klog.V(3).Infof("in-cluster config is not available, using kubeconfig: %v", err)
+	}
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = opts.Kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: opts.KubeContext}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %v", err)
+	}
+	return config, nil
+}
+
+// getSecret reads the kubernetes secret namespace/name of the cluster selected by conn.
+func getSecret(ctx context.Context, conn ConnectionOptions, namespace string, name string) (*core.Secret, error) {
+	config, err := newKubeConfig(conn)
+	if err != nil {
+		return nil, err
+	}
+	kc, err := client.New(config, client.Options{Scheme: scm})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client: %v", err)
+	}
+	secret := &core.Secret{}
+	if err := kc.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// newKubeDBSolrClient builds the solr client for the KubeDB Solr object dbname/namespace.
+func newKubeDBSolrClient(opts ConnectionOptions, dbname string, namespace string) (dbc.SLClient, *api.Solr, error) {
+	config, err := newKubeConfig(opts)
+	if err != nil {
+		return dbc.SLClient{}, nil, err
+	}
+	kc, err := client.New(config, client.Options{
+		Scheme: scm,
+		Mapper: nil,
+	})
+	if err != nil {
+		return dbc.SLClient{}, nil, fmt.Errorf("failed to get client: %v", err)
+	}
+	db := &api.Solr{}
+	err = kc.Get(context.TODO(), types.NamespacedName{
+		Name:      dbname,
+		Namespace: namespace,
+	}, db)
+	if err != nil {
+		return dbc.SLClient{}, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Second)
+	defer cancel()
+	slClient, err := dbc.NewKubeDBClientBuilder(kc, db).WithContext(ctx).WithLog(klog.Background()).GetSolrClient()
+	return slClient, db, err
+}
+
+// newDirectSolrClient builds the solr client for opts.SolrURL without a KubeDB Solr object.
+func newDirectSolrClient(opts ConnectionOptions) (dbc.SLClient, error) {
+	u, err := url.Parse(opts.SolrURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return dbc.SLClient{}, fmt.Errorf("invalid solr url %q, expected e.g. https://solr.example.com:8983", opts.SolrURL)
+	}
+	if (opts.Username == "") != (opts.PasswordFile == "") {
+		return dbc.SLClient{}, fmt.Errorf("--username and --password-file must be set together for basic auth")
+	}
+	tlsFlags := opts.CACertFile != "" || opts.ClientCertFile != "" || opts.ClientKeyFile != "" || opts.InsecureSkipVerify
+	if tlsFlags && u.Scheme != "https" {
+		return dbc.SLClient{}, fmt.Errorf("--ca-cert-file, --client-cert-file, --client-key-file and --insecure-skip-verify require an https solr url, got %s", opts.SolrURL)
+	}
+
+	// The builder only needs the Solr object for the connection scheme and the auth secret.
+	// Security is disabled here so that it doesn't look up the secret, basic auth is set below.
+	db := &api.Solr{}
+	db.Spec.EnableSSL = u.Scheme == "https"
+	db.Spec.DisableSecurity = true
+	slClient, err := dbc.NewKubeDBClientBuilder(nil, db).
+		WithURL(strings.TrimSuffix(opts.SolrURL, "/")).
+		WithContext(context.TODO()).
+		WithLog(klog.Background()).
+		GetSolrClient()
+	if err != nil {
+		return dbc.SLClient{}, err
+	}
+
+	if opts.Username != "" {
+		data, err := os.ReadFile(opts.PasswordFile)
+		if err != nil {
+			return dbc.SLClient{}, fmt.Errorf("failed to read password file: %v", err)
+		}
+		slClient.Client.SetBasicAuth(opts.Username, strings.TrimRight(string(data), "\r\n"))
+	}
+
+	if u.Scheme == "https" {
+		tlsConfig, err := newTLSConfig(opts)
+		if err != nil {
+			return dbc.SLClient{}, err
+		}
+		slClient.Client.SetTLSClientConfig(tlsConfig)
+	}
+	return slClient, nil
+}
+
+func newTLSConfig(opts ConnectionOptions) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+	}
+	if opts.CACertFile != "" {
+		ca, err := os.ReadFile(opts.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca cert file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in ca cert file %s", opts.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if opts.ClientCertFile != "" || opts.ClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.ClientCertFile, opts.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
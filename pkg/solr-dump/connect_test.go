@@ -0,0 +1,19 @@
+package solr_dump
+
+import "testing"
+
+func TestNewDirectSolrClientTLSFlags(t *testing.T) {
+	tests := map[string]ConnectionOptions{
+		"ca cert":              {CACertFile: "ca.crt"},
+		"client cert":          {ClientCertFile: "tls.crt", ClientKeyFile: "tls.key"},
+		"insecure skip verify": {InsecureSkipVerify: true},
+	}
+	for name, opts := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts.SolrURL = "http://solr.example.com:8983"
+			if _, err := newDirectSolrClient(opts); err == nil {
+				t.Error("accepted tls flags with an http solr url")
+			}
+		})
+	}
+}
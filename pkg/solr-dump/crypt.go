@@ -0,0 +1,547 @@
+package solr_dump
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pritamdas99/solr-dump/model"
+)
+
+// Objects written by solr-dump are encrypted with envelope encryption: every object is encrypted with
+// its own AES-256-GCM data key, which is stored in the header of the object wrapped by a key
+// encryption key. The plaintext is sealed in segments, so objects are encrypted and decrypted while
+// they are streamed. An encrypted object is
+//
+//	encMagic | uint32 length of the header | json header | segment...
+//
+// Every segment holds encSegmentSize bytes of plaintext, the last one may hold less, followed by the
+// GCM tag. The nonce of a segment is the nonce prefix of the header, the segment number and a flag
+// marking the last segment, which detects reordered and truncated objects. The header is
+// authenticated with every segment.
+
+const (
+	EncryptionAlgorithm = "AES-256-GCM"
+
+	KeyProviderFile   = "file"
+	KeyProviderSecret = "secret"
+	KeyProviderKMS    = "kms"
+
+	// encMagic can't start a manifest, a chunk or any file solr writes
+	encMagic       = "SDENC\x00"
+	encSegmentSize = 64 << 10
+	encKeySize     = 32
+	encNoncePrefix = 7
+	// encMaxHeader bounds the header read from an object
+	encMaxHeader = 64 << 10
+)
+
+// KeyWrapper protects data keys with a key encryption key.
+type KeyWrapper interface {
+	// Provider is where the key encryption key comes from, one of the KeyProvider constants.
+	Provider() string
+	// KeyId identifies the key encryption key. It is stored next to every wrapped data key.
+	KeyId() string
+	WrapKey(ctx context.Context, dek []byte) ([]byte, error)
+	// UnwrapKey returns the data key wrapped by the key encryption key keyId.
+	UnwrapKey(ctx context.Context, keyId string, wrapped []byte) ([]byte, error)
+}
+
+// KMS is a key management service that encrypts data keys with keys that never leave it.
+type KMS interface {
+	Encrypt(ctx context.Context, keyId string, plaintext []byte) ([]byte, error)
+	Decrypt(ctx context.Context, keyId string, ciphertext []byte) ([]byte, error)
+}
+
+// staticKeyWrapper wraps data keys with a key encryption key it holds, read from a file or a secret.
+// The key is identified by its fingerprint, so the same key may be read from either source.
+type staticKeyWrapper struct {
+	provider string
+	kek      []byte
+}
+
+// NewFileKeyWrapper reads the key encryption key from file. It holds 32 bytes, raw, base64 or hex encoded.
+func NewFileKeyWrapper(file string) (KeyWrapper, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption key file: %v", err)
+	}
+	kek, err := parseKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key in %s: %v", file, err)
+	}
+	return &staticKeyWrapper{provider: KeyProviderFile, kek: kek}, nil
+}
+
+// NewSecretKeyWrapper reads the key encryption key from data key of the kubernetes secret
+// namespace/name, in the cluster selected by conn.
+func NewSecretKeyWrapper(ctx context.Context, conn ConnectionOptions, namespace string, name string, key string) (KeyWrapper, error) {
+	secret, err := getSecret(ctx, conn, namespace, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get encryption key secret %s/%s: %v", namespace, name, err)
+	}
+	data, ok := secret.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("secret %s/%s has no key %s", namespace, name, key)
+	}
+	kek, err := parseKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key in secret %s/%s: %v", namespace, name, err)
+	}
+	return &staticKeyWrapper{provider: KeyProviderSecret, kek: kek}, nil
+}
+
+// parseKey decodes a 32 byte key, given raw, base64 or hex encoded.
+func parseKey(data []byte) ([]byte, error) {
+	if len(data) == encKeySize {
+		return data, nil
+	}
+	s := strings.TrimSpace(string(data))
+	if key, err := base64.StdEncoding.DecodeString(s); err == nil && len(key) == encKeySize {
+		return key, nil
+	}
+	if key, err := hex.DecodeString(s); err == nil && len(key) == encKeySize {
+		return key, nil
+	}
+	return nil, fmt.Errorf("expected a %d byte key, raw, base64 or hex encoded", encKeySize)
+}
+
+func (w *staticKeyWrapper) Provider() string {
+	return w.provider
+}
+
+func (w *staticKeyWrapper) KeyId() string {
+	sum := sha256.Sum256(w.kek)
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+func (w *staticKeyWrapper) WrapKey(_ context.Context, dek []byte) ([]byte, error) {
+	return gcmSeal(w.kek, dek)
+}
+
+func (w *staticKeyWrapper) UnwrapKey(_ context.Context, keyId string, wrapped []byte) ([]byte, error) {
+	if keyId != w.KeyId() {
+		return nil, fmt.Errorf("data key is wrapped by key %s, the configured key is %s", keyId, w.KeyId())
+	}
+	return gcmOpen(w.kek, wrapped)
+}
+
+type kmsKeyWrapper struct {
+	kms   KMS
+	keyId string
+}
+
+// NewKMSKeyWrapper wraps data keys with the key keyId of kms.
+func NewKMSKeyWrapper(kms KMS, keyId string) KeyWrapper {
+	return &kmsKeyWrapper{kms: kms, keyId: keyId}
+}
+
+func (w *kmsKeyWrapper) Provider() string {
+	return KeyProviderKMS
+}
+
+func (w *kmsKeyWrapper) KeyId() string {
+	return w.keyId
+}
+
+func (w *kmsKeyWrapper) WrapKey(ctx context.Context, dek []byte) ([]byte, error) {
+	return w.kms.Encrypt(ctx, w.keyId, dek)
+}
+
+func (w *kmsKeyWrapper) UnwrapKey(ctx context.Context, keyId string, wrapped []byte) ([]byte, error) {
+	return w.kms.Decrypt(ctx, keyId, wrapped)
+}
+
+// FileKMS is a stand-in for a key management service, for tests and setups without one. The key
+// keyId is the file keyId in Dir, holding 32 bytes, raw, base64 or hex encoded.
+type FileKMS struct {
+	Dir string
+}
+
+func (k FileKMS) key(keyId string) ([]byte, error) {
+	if keyId == "" || keyId != filepath.Base(keyId) || strings.HasPrefix(keyId, ".") {
+		return nil, fmt.Errorf("invalid key id %q", keyId)
+	}
+	data, err := os.ReadFile(filepath.Join(k.Dir, keyId))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key %s: %v", keyId, err)
+	}
+	return parseKey(data)
+}
+
+func (k FileKMS) Encrypt(_ context.Context, keyId string, plaintext []byte) ([]byte, error) {
+	kek, err := k.key(keyId)
+	if err != nil {
+		return nil, err
+	}
+	return gcmSeal(kek, plaintext)
+}
+
+func (k FileKMS) Decrypt(_ context.Context, keyId string, ciphertext []byte) ([]byte, error) {
+	kek, err := k.key(keyId)
+	if err != nil {
+		return nil, err
+	}
+	return gcmOpen(kek, ciphertext)
+}
+
+// gcmSeal encrypts plaintext with a random nonce, which is prepended to the ciphertext.
+func gcmSeal(key []byte, plaintext []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func gcmOpen(key []byte, ciphertext []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	return aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptionHeader is stored in plaintext at the start of every encrypted object.
+type encryptionHeader struct {
+	Algorithm   string `json:"algorithm"`
+	KeyProvider string `json:"keyProvider"`
+	KeyId       string `json:"keyId"`
+	WrappedKey  []byte `json:"wrappedKey"`
+	NoncePrefix []byte `json:"noncePrefix"`
+	SegmentSize int    `json:"segmentSize"`
+}
+
+// encryption returns the encryption recorded in the manifests of the run, nil if nothing is encrypted.
+func encryption(keys KeyWrapper) *model.Encryption {
+	if keys == nil {
+		return nil
+	}
+	return &model.Encryption{Algorithm: EncryptionAlgorithm, KeyProvider: keys.Provider(), KeyId: keys.KeyId()}
+}
+
+// encryptedBlob encrypts every object written through it with keys and decrypts the encrypted objects
+// read through it. With keys, the files of solr backups are the only objects read without encryption,
+// manifests, config sets and dumps that aren't encrypted are rejected. Without keys nothing is
+// encrypted and reading an encrypted object fails.
+type encryptedBlob struct {
+	model.Blob
+	keys KeyWrapper
+}
+
+// NewEncryptedBlob wraps bl to encrypt the objects written with keys, which may be nil.
+func NewEncryptedBlob(bl model.Blob, keys KeyWrapper) model.Blob {
+	return &encryptedBlob{Blob: bl, keys: keys}
+}
+
+func (b *encryptedBlob) Get(ctx context.Context, filepath string) ([]byte, error) {
+	r, err := b.NewReader(ctx, filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func (b *encryptedBlob) Put(ctx context.Context, filepath string, r io.Reader) error {
+	if b.keys == nil {
+		return b.Blob.Put(ctx, filepath, r)
+	}
+	// the writer is aborted by cancelling its context if the copy fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w, err := b.NewWriter(ctx, filepath)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		cancel()
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (b *encryptedBlob) NewWriter(ctx context.Context, filepath string) (io.WriteCloser, error) {
+	if b.keys == nil {
+		return b.Blob.NewWriter(ctx, filepath)
+	}
+	dek := make([]byte, encKeySize)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, err
+	}
+	wrapped, err := b.keys.WrapKey(ctx, dek)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key of %s: %v", filepath, err)
+	}
+	header := encryptionHeader{
+		Algorithm:   EncryptionAlgorithm,
+		KeyProvider: b.keys.Provider(),
+		KeyId:       b.keys.KeyId(),
+		WrappedKey:  wrapped,
+		NoncePrefix: make([]byte, encNoncePrefix),
+		SegmentSize: encSegmentSize,
+	}
+	if _, err := rand.Read(header.NoncePrefix); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+
+	// the object is aborted by cancelling the context of its writer, closing it would commit the
+	// segments written so far
+	ctx, cancel := context.WithCancel(ctx)
+	w, err := b.Blob.NewWriter(ctx, filepath)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	prefix := make([]byte, 0, len(encMagic)+4+len(data))
+	prefix = append(prefix, encMagic...)
+	prefix = binary.BigEndian.AppendUint32(prefix, uint32(len(data)))
+	prefix = append(prefix, data...)
+	if _, err := w.Write(prefix); err != nil {
+		cancel()
+		_ = w.Close()
+		return nil, err
+	}
+	return &encryptWriter{w: w, cancel: cancel, aead: aead, header: header, aad: data}, nil
+}
+
+func (b *encryptedBlob) NewReader(ctx context.Context, filepath string) (io.ReadCloser, error) {
+	rc, err := b.Blob.NewReader(ctx, filepath)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(rc)
+	magic, err := br.Peek(len(encMagic))
+	if err != nil || string(magic) != encMagic {
+		// too short to be encrypted, or not encrypted
+		if b.keys != nil && !isSolrBackupFile(filepath) {
+			_ = rc.Close()
+			return nil, fmt.Errorf("%s isn't encrypted, but encryption key %s is configured", filepath, b.keys.KeyId())
+		}
+		return &bufferedReadCloser{Reader: br, Closer: rc}, nil
+	}
+	header, aad, err := readEncryptionHeader(br)
+	if err != nil {
+		_ = rc.Close()
+		return nil, fmt.Errorf("invalid encryption header of %s: %v", filepath, err)
+	}
+	if b.keys == nil {
+		_ = rc.Close()
+		return nil, fmt.Errorf("%s is encrypted with key %s of provider %s, but no encryption key is configured", filepath, header.KeyId, header.KeyProvider)
+	}
+	// keys of files and secrets are interchangeable, kms keys never leave the kms
+	if (header.KeyProvider == KeyProviderKMS) != (b.keys.Provider() == KeyProviderKMS) {
+		_ = rc.Close()
+		return nil, fmt.Errorf("%s is encrypted with key %s of provider %s, the configured key is of provider %s", filepath, header.KeyId, header.KeyProvider, b.keys.Provider())
+	}
+	dek, err := b.keys.UnwrapKey(ctx, header.KeyId, header.WrappedKey)
+	if err != nil {
+		_ = rc.Close()
+		return nil, fmt.Errorf("failed to unwrap data key of %s: %v", filepath, err)
+	}
+	aead, err := newGCM(dek)
+	if err != nil {
+		_ = rc.Close()
+		return nil, err
+	}
+	return &decryptReader{r: br, c: rc, aead: aead, header: header, aad: aad}, nil
+}
+
+// isSolrBackupFile reports whether filepath is written by solr's backup, which solr-dump can't encrypt:
+// a backup_N.properties file in <backupName>/<collection>/ or a file of its index, shard metadata or
+// zookeeper directories.
+func isSolrBackupFile(filepath string) bool {
+	part := strings.Split(strings.Trim(filepath, "/"), "/")
+	if len(part) < 3 || part[0] == model.MetadataDir {
+		return false
+	}
+	if len(part) == 3 {
+		return backupPropertiesRegex.MatchString(part[2])
+	}
+	return part[2] == indexDir || part[2] == shardMetadataDir || strings.HasPrefix(part[2], zkBackupPrefix)
+}
+
+func readEncryptionHeader(r io.Reader) (encryptionHeader, []byte, error) {
+	var header encryptionHeader
+	prefix := make([]byte, len(encMagic)+4)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return header, nil, err
+	}
+	n := binary.BigEndian.Uint32(prefix[len(encMagic):])
+	if n > encMaxHeader {
+		return header, nil, fmt.Errorf("header of %d bytes is too large", n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return header, nil, err
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return header, nil, err
+	}
+	if header.Algorithm != EncryptionAlgorithm {
+		return header, nil, fmt.Errorf("unsupported algorithm %s", header.Algorithm)
+	}
+	if len(header.NoncePrefix) != encNoncePrefix || header.SegmentSize <= 0 || header.SegmentSize > encSegmentSize<<4 {
+		return header, nil, errors.New("invalid nonce prefix or segment size")
+	}
+	return header, data, nil
+}
+
+// segmentNonce returns the nonce of segment n: the nonce prefix, n and the last segment flag.
+func segmentNonce(prefix []byte, n uint32, last bool) []byte {
+	nonce := make([]byte, 0, encNoncePrefix+5)
+	nonce = append(nonce, prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, n)
+	if last {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+type encryptWriter struct {
+	w      io.WriteCloser
+	cancel context.CancelFunc
+	aead   cipher.AEAD
+	header encryptionHeader
+	aad    []byte
+	buf    []byte
+	n      uint32
+	err    error
+}
+
+// Write seals the buffered plaintext once more than a segment is buffered, the last segment is
+// only known when the writer is closed.
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	e.buf = append(e.buf, p...)
+	for len(e.buf) > e.header.SegmentSize {
+		if e.err = e.seal(e.buf[:e.header.SegmentSize], false); e.err != nil {
+			return 0, e.err
+		}
+		e.buf = append(e.buf[:0], e.buf[e.header.SegmentSize:]...)
+	}
+	return len(p), nil
+}
+
+func (e *encryptWriter) seal(plaintext []byte, last bool) error {
+	if e.n == ^uint32(0) {
+		return errors.New("too many segments")
+	}
+	_, err := e.w.Write(e.aead.Seal(nil, segmentNonce(e.header.NoncePrefix, e.n, last), plaintext, e.aad))
+	e.n++
+	return err
+}
+
+// Close seals the last segment and commits the object. If sealing a segment failed, the object is
+// aborted instead, so that no truncated object is left under its name.
+func (e *encryptWriter) Close() error {
+	defer e.cancel()
+	if e.err == nil {
+		e.err = e.seal(e.buf, true)
+	}
+	if e.err != nil {
+		e.cancel()
+		_ = e.w.Close()
+		return e.err
+	}
+	return e.w.Close()
+}
+
+type decryptReader struct {
+	r      *bufio.Reader
+	c      io.Closer
+	aead   cipher.AEAD
+	header encryptionHeader
+	aad    []byte
+	// plain holds the decrypted plaintext of the current segment that wasn't read yet
+	plain []byte
+	n     uint32
+	done  bool
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// next decrypts the next segment. A segment is the last one if the object ends with it.
+func (d *decryptReader) next() error {
+	segment := make([]byte, d.header.SegmentSize+d.aead.Overhead())
+	n, err := io.ReadFull(d.r, segment)
+	switch {
+	case err == io.ErrUnexpectedEOF || err == io.EOF:
+		d.done = true
+	case err != nil:
+		return err
+	default:
+		if _, err := d.r.Peek(1); err == io.EOF {
+			d.done = true
+		} else if err != nil {
+			return err
+		}
+	}
+	plain, err := d.aead.Open(segment[:0], segmentNonce(d.header.NoncePrefix, d.n, d.done), segment[:n], d.aad)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt segment %d, the object is corrupted or truncated: %v", d.n, err)
+	}
+	d.plain = plain
+	d.n++
+	return nil
+}
+
+func (d *decryptReader) Close() error {
+	return d.c.Close()
+}
+
+type bufferedReadCloser struct {
+	*bufio.Reader
+	io.Closer
+}
@@ -0,0 +1,193 @@
+package solr_dump
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/pritamdas99/solr-dump/blob"
+	"github.com/pritamdas99/solr-dump/model"
+)
+
+func testKeys(seed byte) KeyWrapper {
+	return &staticKeyWrapper{provider: KeyProviderFile, kek: bytes.Repeat([]byte{seed}, encKeySize)}
+}
+
+func randomBytes(n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(data)
+	return data
+}
+
+// segmentsOf splits an encrypted object into its header and its sealed segments.
+func segmentsOf(t *testing.T, object []byte) ([]byte, [][]byte) {
+	t.Helper()
+	n := len(encMagic) + 4 + int(binary.BigEndian.Uint32(object[len(encMagic):]))
+	header, rest := object[:n], object[n:]
+	size := encSegmentSize + 16
+	var segments [][]byte
+	for len(rest) > size {
+		segments = append(segments, rest[:size])
+		rest = rest[size:]
+	}
+	return header, append(segments, rest)
+}
+
+func join(header []byte, segments ...[]byte) []byte {
+	return bytes.Join(append([][]byte{header}, segments...), nil)
+}
+
+func TestEncryptedBlobRoundTrip(t *testing.T) {
+	sizes := map[string]int{
+		"empty":                  0,
+		"one byte":               1,
+		"below a segment":        encSegmentSize - 1,
+		"exactly a segment":      encSegmentSize,
+		"exactly two segments":   2 * encSegmentSize,
+		"two segments and extra": 2*encSegmentSize + 1,
+	}
+	for name, size := range sizes {
+		t.Run(name, func(t *testing.T) {
+			raw := newTestBlob(t)
+			bl := NewEncryptedBlob(raw, testKeys(1))
+			plain := randomBytes(size)
+			putObject(t, bl, "obj", plain)
+
+			object := getObject(t, raw, "obj")
+			if !bytes.HasPrefix(object, []byte(encMagic)) {
+				t.Fatal("object is not encrypted")
+			}
+			if size >= 16 && bytes.Contains(object, plain) {
+				t.Fatal("object holds the plaintext")
+			}
+			_, segments := segmentsOf(t, object)
+			if want := max(1, (size+encSegmentSize-1)/encSegmentSize); len(segments) != want {
+				t.Errorf("got %d segments, want %d", len(segments), want)
+			}
+			if got := getObject(t, bl, "obj"); !bytes.Equal(got, plain) {
+				t.Errorf("decrypted %d bytes, want the %d bytes written", len(got), len(plain))
+			}
+		})
+	}
+}
+
+func TestEncryptedBlobDetectsTampering(t *testing.T) {
+	raw := newTestBlob(t)
+	bl := NewEncryptedBlob(raw, testKeys(1))
+	putObject(t, bl, "obj", randomBytes(2*encSegmentSize+100))
+	header, segments := segmentsOf(t, getObject(t, raw, "obj"))
+	if len(segments) != 3 {
+		t.Fatalf("got %d segments, want 3", len(segments))
+	}
+	last := segments[2]
+
+	tests := map[string][]byte{
+		"last segment dropped":   join(header, segments[0], segments[1]),
+		"last segment truncated": join(header, segments[0], segments[1], last[:len(last)-1]),
+		"segments reordered":     join(header, segments[1], segments[0], last),
+		"segment duplicated":     join(header, segments[0], segments[0], segments[1], last),
+		"bit flipped":            join(header, segments[0], append([]byte{segments[1][0] ^ 1}, segments[1][1:]...), last),
+	}
+	for name, object := range tests {
+		t.Run(name, func(t *testing.T) {
+			putObject(t, raw, "tampered", object)
+			if _, err := bl.Get(context.Background(), "tampered"); err == nil || !strings.Contains(err.Error(), "corrupted or truncated") {
+				t.Errorf("got error %v, want a corrupted or truncated object", err)
+			}
+		})
+	}
+}
+
+func TestEncryptedBlobKeys(t *testing.T) {
+	raw := newTestBlob(t)
+	putObject(t, NewEncryptedBlob(raw, testKeys(1)), "obj", []byte("secret"))
+
+	if _, err := NewEncryptedBlob(raw, testKeys(2)).Get(context.Background(), "obj"); err == nil {
+		t.Error("decrypted with a wrong key")
+	}
+	if _, err := NewEncryptedBlob(raw, nil).Get(context.Background(), "obj"); err == nil {
+		t.Error("read an encrypted object without a key")
+	}
+
+	// the files of solr backups are read as they are, anything else must be encrypted
+	for _, filepath := range []string{
+		"b1/c1/backup_0.properties",
+		"b1/c1/index/_0.cfs",
+		"b1/c1/shard_backup_metadata/md_shard1_0.json",
+		"b1/c1/zk_backup_0/configs/conf1/solrconfig.xml",
+	} {
+		putObject(t, raw, filepath, []byte("not encrypted"))
+		if got := getObject(t, NewEncryptedBlob(raw, testKeys(1)), filepath); string(got) != "not encrypted" {
+			t.Errorf("got %q for solr backup file %s", got, filepath)
+		}
+	}
+	for _, filepath := range []string{
+		manifestPath("run1"),
+		configSetPath("run1", "conf1"),
+		"b1/c1/run1/" + schemaFile,
+		"b1/c1/run1/chunk-00000.jsonl.gz",
+		"b1/c1/backup_0.properties.tmp",
+		"empty",
+	} {
+		data := []byte("not encrypted")
+		if filepath == "empty" {
+			data = nil
+		}
+		putObject(t, raw, filepath, data)
+		if _, err := NewEncryptedBlob(raw, testKeys(1)).Get(context.Background(), filepath); err == nil {
+			t.Errorf("read %s that isn't encrypted with a key configured", filepath)
+		}
+		if got := getObject(t, NewEncryptedBlob(raw, nil), filepath); string(got) != string(data) {
+			t.Errorf("got %q for %s without a key", got, filepath)
+		}
+	}
+}
+
+// failingBlob fails every write once failAfter bytes were written to an object.
+type failingBlob struct {
+	model.Blob
+	failAfter int
+}
+
+func (b *failingBlob) NewWriter(ctx context.Context, filepath string) (io.WriteCloser, error) {
+	w, err := b.Blob.NewWriter(ctx, filepath)
+	if err != nil {
+		return nil, err
+	}
+	return &failingWriter{WriteCloser: w, left: b.failAfter}, nil
+}
+
+type failingWriter struct {
+	io.WriteCloser
+	left int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.left {
+		return 0, errors.New("write failed")
+	}
+	w.left -= len(p)
+	return w.WriteCloser.Write(p)
+}
+
+func TestEncryptWriterAbortsOnFailure(t *testing.T) {
+	raw := newTestBlob(t)
+	bl := NewEncryptedBlob(&failingBlob{Blob: raw, failAfter: 1024}, testKeys(1))
+	w, err := bl.NewWriter(context.Background(), "obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the header fits, the first segment, sealed once the second one starts, doesn't
+	_, _ = w.Write(randomBytes(2*encSegmentSize + 1))
+	if err := w.Close(); err == nil {
+		t.Fatal("close succeeded after a failed write")
+	}
+	if _, err := raw.Stat(context.Background(), "obj"); !blob.IsNotFound(err) {
+		t.Errorf("got %v, want the aborted object not to exist", err)
+	}
+}
@@ -3,18 +3,18 @@ package solr_dump
 import (
 	"context"
 	"fmt"
+	"github.com/go-resty/resty/v2"
 	"github.com/pritamdas99/solr-dump/blob"
 	"github.com/pritamdas99/solr-dump/model"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientSetScheme "k8s.io/client-go/kubernetes/scheme"
-	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
 	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
 	dbc "kubedb.dev/db-client-go/solr"
-	"sigs.k8s.io/controller-runtime/pkg/client"
-	"strings"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -27,50 +27,198 @@ func init() {
 	utilruntime.Must(api.AddToScheme(scm))
 }
 
+type Options struct {
+	// Action is one of backup, restore, prune or verify, backup if empty.
+	Action string
+	// Mode selects physical backups through the solr backup api or logical dumps of the documents.
+	Mode    model.BackupMode
+	Logical LogicalOptions
+	// Compression applies to logical dumps and the metadata files of the run.
+	Compression CompressionOptions
+	DB          string
+	Namespace   string
+	Connection  ConnectionOptions
+	Location    string
+	Repository  string
+	Storage     *model.BackupStorage
+	Filter      *CollectionFilter
+	// Rename maps a collection in the backup to the collection it is restored into.
+	Rename map[string]string
+	// TargetSuffix is appended to every restored collection that has no Rename entry.
+	TargetSuffix string
+	// FromRun restores the backup points recorded in the manifest of this backup run.
+	FromRun string
+	// Backup restores the collections of this backup only, every backup is restored if empty.
+	Backup string
+	// BackupId selects the backup point to restore. AsOf selects the newest backup point
+	// taken at or before the given time. The latest backup point is restored if both are nil.
+	BackupId *int
+	AsOf     *time.Time
+	// Resume is the id of an interrupted run to continue. Its state is read from StateDir,
+	// or from the backup storage if StateDir is empty.
+	Resume   string
+	StateDir string
+	// Timeout limits the whole run. Zero means no limit.
+	Timeout time.Duration
+	Tracker TrackerOptions
+	// Parallelism is the number of collections backed up or restored at the same time.
+	Parallelism int
+	// FailFast stops submitting new collections once a collection failed.
+	FailFast bool
+	// MaxOverseerQueue holds back new submissions while the overseer collection queue
+	// has at least this many tasks. Zero disables the check.
+	MaxOverseerQueue int
+	// Retention is applied by Prune, and after a backup to the collections it completed
+	// unless the policy is zero.
+	Retention RetentionPolicy
+	// DryRun makes Prune only report the backup points it would remove.
+	DryRun bool
+	// SampleSize is the number of documents per collection whose hashes are recorded in the
+	// manifest before a backup, for verify --restore-test. Zero disables sampling.
+	SampleSize int
+	// ClusterMetadata exports config sets, aliases and cluster properties along with a backup
+	// and recreates them during a restore.
+	ClusterMetadata bool
+	// Encryption encrypts every object solr-dump writes to the backup storage: manifests, logical
+	// dumps and config sets. Encrypted objects can only be read with the same key.
+	Encryption KeyWrapper
+}
+
 type SolrDump struct {
-	action     string
-	slClient   dbc.SLClient
-	location   string
-	repository string
+	action       string
+	mode         model.BackupMode
+	logical      LogicalOptions
+	compression  CompressionOptions
+	slClient     dbc.SLClient
+	streamClient *resty.Client
+	location     string
+	repository   string
+	bl           model.Blob
+	keys         KeyWrapper
+	cluster      model.ClusterManifest
+	filter       *CollectionFilter
+	rename       map[string]string
+	targetSuffix string
+	fromRun      string
+	backup       string
+	backupId     *int
+	asOf         *time.Time
+	resume       string
+	state        stateStore
+	timeout      time.Duration
+	trackerOpts  TrackerOptions
+	parallelism  int
+	failFast     bool
+
+	maxOverseerQueue int
+	retention        RetentionPolicy
+	dryRun           bool
+	sampleSize       int
+	clusterMetadata  bool
+
+	// mu guards report once collections are processed concurrently
+	mu     sync.Mutex
+	report *model.Report
 }
 
-func NewSolrDump(action string, dbname string, namespace string, location string, repository string) (*SolrDump, error) {
-	if action != "restore" {
+func NewSolrDump(opts Options) (*SolrDump, error) {
+	action := opts.Action
+	switch action {
+	case "backup", "restore", "prune", "verify":
+	case "":
 		action = "backup"
+	default:
+		return nil, fmt.Errorf("unknown action %s", action)
 	}
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		fmt.Printf("Failed to get config %s", config)
-		return nil, err
+	mode := opts.Mode
+	if mode == "" {
+		mode = model.ModePhysical
 	}
-	kc, err := client.New(config, client.Options{
-		Scheme: scm,
-		Mapper: nil,
-	})
-	if err != nil {
-		fmt.Println("failed to get client")
-		return nil, err
+	if mode != model.ModePhysical && mode != model.ModeLogical {
+		return nil, fmt.Errorf("unknown mode %s", mode)
+	}
+	var slClient dbc.SLClient
+	var err error
+	cluster := model.ClusterManifest{
+		Name:      opts.DB,
+		Namespace: opts.Namespace,
+	}
+	if opts.Connection.SolrURL != "" {
+		slClient, err = newDirectSolrClient(opts.Connection)
+		cluster = model.ClusterManifest{Name: opts.Connection.SolrURL}
+	} else {
+		var db *api.Solr
+		slClient, db, err = newKubeDBSolrClient(opts.Connection, opts.DB, opts.Namespace)
+		if db != nil {
+			cluster.SolrVersion = db.Spec.Version
+		}
 	}
-	db := &api.Solr{}
-	err = kc.Get(context.TODO(), types.NamespacedName{
-		Name:      dbname,
-		Namespace: namespace,
-	}, db)
 	if err != nil {
 		return nil, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Second)
-	defer cancel()
-	slClient, err := dbc.NewKubeDBClientBuilder(kc, db).WithContext(ctx).WithLog(klog.Background()).GetSolrClient()
-	if err != nil {
-		return nil, err
+	var bl model.Blob
+	if opts.Storage != nil {
+		bl, err = blob.NewBlob(opts.Storage)
+		if err != nil {
+			return nil, err
+		}
+		bl = NewEncryptedBlob(bl, opts.Encryption)
+	} else if opts.Encryption != nil {
+		return nil, fmt.Errorf("encryption requires a backup storage")
+	}
+	if opts.Encryption != nil && mode == model.ModePhysical && action == "backup" {
+		klog.Warning("solr writes the index files of physical backups unencrypted, only the files of solr-dump are encrypted")
 	}
+
+	if mode == model.ModeLogical && bl == nil {
+		return nil, fmt.Errorf("backup storage is required for a logical dump")
+	}
+
+	// only backup and restore runs can be resumed
+	var state stateStore
+	if action == "backup" || action == "restore" {
+		switch {
+		case opts.StateDir != "":
+			state = &localStateStore{dir: opts.StateDir}
+		case bl != nil:
+			state = &blobStateStore{bl: bl, compression: opts.Compression}
+		default:
+			klog.Warning("neither a state dir nor a backup storage is configured, the run can't be resumed")
+		}
+	}
+
 	return &SolrDump{
-		action,
-		slClient,
-		location,
-		repository,
+		action:       action,
+		mode:         mode,
+		logical:      opts.Logical,
+		compression:  opts.Compression,
+		slClient:     slClient,
+		streamClient: newStreamClient(slClient.Client),
+		location:     opts.Location,
+		repository:   opts.Repository,
+		bl:           bl,
+		keys:         opts.Encryption,
+		cluster:      cluster,
+		fromRun:      opts.FromRun,
+		backup:       opts.Backup,
+		filter:       opts.Filter,
+		rename:       opts.Rename,
+		targetSuffix: opts.TargetSuffix,
+		backupId:     opts.BackupId,
+		asOf:         opts.AsOf,
+		resume:       opts.Resume,
+		state:        state,
+		timeout:      opts.Timeout,
+		trackerOpts:  opts.Tracker,
+		parallelism:  opts.Parallelism,
+		failFast:     opts.FailFast,
+
+		maxOverseerQueue: opts.MaxOverseerQueue,
+		retention:        opts.Retention,
+		dryRun:           opts.DryRun,
+		sampleSize:       opts.SampleSize,
+		clusterMetadata:  opts.ClusterMetadata,
 	}, nil
 }
 
@@ -87,200 +235,440 @@ func (dumper *SolrDump) flushStatus(asyncId string) error {
 
 	_, err = dumper.slClient.GetResponseStatus(responseBody)
 	if err != nil {
-		klog.Error(fmt.Sprintf("status is non zero while listing collection"))
-		return err
+		// logged by the tracker along with the async id
+		return fmt.Errorf("solr answered with status code %d: %v", resp.Code, err)
 	}
 
 	return nil
 }
 
-func (dumper *SolrDump) Execute() {
-	if dumper.action == "backup" {
-		err := dumper.backup()
+// Execute runs the backup or restore. The returned report is always set, the error is non nil
+// if the run failed for any collection.
+func (dumper *SolrDump) Execute() (*model.Report, error) {
+	ctx := context.Background()
+	if dumper.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dumper.timeout)
+		defer cancel()
+	}
+
+	if dumper.resume != "" {
+		state, err := dumper.loadState(dumper.resume)
 		if err != nil {
-			klog.Error(err)
+			// keep the stored state untouched, it may still be resumed later
+			dumper.state = nil
+			dumper.report = newReport(dumper.action, dumper.resume)
+			return dumper.report, dumper.finishReport(err)
 		}
+		dumper.report = state
+		return dumper.report, dumper.finishReport(dumper.runAndRecord(ctx))
+	}
+
+	dumper.report = newReport(dumper.action, newRunId(dumper.action))
+	dumper.report.Mode = dumper.mode
+	klog.Infof("starting %s run %s", dumper.action, dumper.report.RunId)
+	var err error
+	if dumper.action == "backup" {
+		err = dumper.planBackup()
 	} else {
-		err := dumper.restore()
-		if err != nil {
-			klog.Error(err)
+		err = dumper.planRestore()
+	}
+	if err == nil {
+		err = dumper.runAndRecord(ctx)
+	}
+	return dumper.report, dumper.finishReport(err)
+}
+
+func (dumper *SolrDump) loadState(runId string) (*model.Report, error) {
+	if dumper.state == nil {
+		return nil, fmt.Errorf("can't resume run %s, no state store is configured", runId)
+	}
+	state, err := dumper.state.Load(context.TODO(), runId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state of run %s: %v", runId, err)
+	}
+	if state.Action != dumper.action {
+		return nil, fmt.Errorf("run %s is a %s run, not %s", runId, state.Action, dumper.action)
+	}
+	if state.Mode == "" {
+		state.Mode = model.ModePhysical
+	}
+	if state.Mode != dumper.mode {
+		return nil, fmt.Errorf("run %s is a %s run, not %s", runId, state.Mode, dumper.mode)
+	}
+	klog.Infof("resuming %s run %s", state.Action, runId)
+	state.Status = ""
+	state.Error = ""
+	for _, cr := range state.Collections {
+		// the async request of a timed out collection may still be running in solr
+		if cr.Status == model.CollectionTimedOut {
+			cr.Status = model.CollectionSubmitted
+			cr.EndTime = nil
+			cr.Error = ""
 		}
 	}
+	if state.Mode == model.ModeLogical {
+		resetLogical(state)
+	}
+	return state, nil
 }
 
-func (dumper *SolrDump) checkStatus(collections []string) int {
-	fl := 0
+// saveState persists the report as the state of the run.
+func (dumper *SolrDump) saveState() {
+	if dumper.state == nil {
+		return
+	}
+	dumper.mu.Lock()
+	defer dumper.mu.Unlock()
+	if err := dumper.state.Save(context.TODO(), dumper.report); err != nil {
+		klog.Errorf("failed to save state of run %s: %v", dumper.report.RunId, err)
+	}
+}
 
-	for _, collection := range collections {
-		if collection == "kubedb-system" {
-			continue
-		}
-		asyncId := fmt.Sprintf("%s-%s", collection, dumper.action)
-		resp, err := dumper.slClient.RequestStatus(asyncId)
-		if err != nil {
-			klog.Error(fmt.Sprintf("Failed to get response for asyncId %s. Error: %v", asyncId, err))
-			continue
+// runAndRecord runs the collections. For a backup it also exports the cluster metadata, writes the
+// manifest of the run and applies the retention policy. For a restore it recreates the cluster metadata
+// in dependency order: cluster properties and config sets before the collections, aliases after them.
+func (dumper *SolrDump) runAndRecord(ctx context.Context) error {
+	var metadataRun string
+	var md *model.ClusterMetadata
+	if dumper.clusterMetadata && dumper.bl != nil && dumper.action == "restore" {
+		var err error
+		metadataRun, md, err = dumper.restoreMetadata(ctx)
+		switch {
+		case err != nil:
+			klog.Errorf("failed to find the cluster metadata to restore: %v", err)
+		case md == nil:
+			klog.Info("no backup run recorded cluster metadata, only collections are restored")
+		default:
+			klog.Infof("restoring cluster metadata of run %s", metadataRun)
+			dumper.restoreClusterMetadata(ctx, metadataRun, md)
 		}
+	}
 
-		responseBody, err := dumper.slClient.DecodeResponse(resp)
-		if err != nil {
-			klog.Error(fmt.Sprintf("Failed to decode response for asyncId %s. Error: %v", asyncId, err))
-			continue
+	err := dumper.run(ctx)
+	if md != nil {
+		dumper.restoreAliases(ctx, md)
+	}
+	if dumper.action == "backup" {
+		// the run context may have timed out, the manifest is still worth writing
+		mctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		if dumper.clusterMetadata && dumper.bl != nil {
+			if merr := dumper.exportClusterMetadata(mctx); merr != nil {
+				klog.Errorf("failed to export cluster metadata: %v", merr)
+			}
 		}
-
-		_, err = dumper.slClient.GetResponseStatus(responseBody)
-		if err != nil {
-			klog.Error(fmt.Sprintf("status is non zero while checking status for asyncId %s. Error %v", asyncId, err))
-			continue
+		if merr := dumper.writeManifest(mctx); merr != nil {
+			klog.Error(merr)
 		}
+		if !dumper.retention.IsZero() {
+			dumper.pruneAfterBackup(context.Background())
+		}
+	}
+	return err
+}
 
-		state, err := dumper.slClient.GetAsyncStatus(responseBody)
-		if err != nil {
-			klog.Error(fmt.Sprintf("status is non zero while checking state of async for asyncId %s. Error %v", asyncId, err))
+// run submits the pending collections of the report and waits for them to finish, with at most
+// dumper.parallelism collections in flight. Collections that were submitted before a resume are
+// looked up and only submitted again if solr never received them. A failed collection doesn't stop
+// the others unless failFast is set.
+func (dumper *SolrDump) run(ctx context.Context) error {
+	parallelism := dumper.parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	tr := newTracker(dumper, dumper.trackerOpts)
+
+	var wg sync.WaitGroup
+	var failed atomic.Bool
+	slots := make(chan struct{}, parallelism)
+	for _, cr := range dumper.report.Collections {
+		if cr.Status != model.CollectionPending && cr.Status != model.CollectionSubmitted {
 			continue
 		}
-		if state == "completed" {
-			klog.Info(fmt.Sprintf("API call for asyncId %s completed.", asyncId))
-			err := dumper.flushStatus(asyncId)
-			if err != nil {
-				klog.Error(fmt.Sprintf("Failed to flush api call for asyncId %s. Error %v", asyncId, err))
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil || (dumper.failFast && failed.Load()) {
+			break
+		}
+
+		wg.Add(1)
+		go func(cr *model.CollectionReport) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			if dumper.mode == model.ModeLogical {
+				if dumper.action == "backup" {
+					dumper.exportCollection(ctx, cr)
+				} else {
+					dumper.importCollection(ctx, cr)
+				}
+				if cr.Status != model.CollectionCompleted {
+					failed.Store(true)
+				}
+				return
 			}
-			collection = "kubedb-system"
-		} else if state == "failed" {
-			klog.Info(fmt.Sprintf("API call for asyncId %s failed", asyncId))
-			err := dumper.flushStatus(asyncId)
-			if err != nil {
-				klog.Error(fmt.Sprintf("Failed to flush api call for asyncId %s. Error %v", asyncId, err))
+			if cr.Status == model.CollectionSubmitted {
+				dumper.checkSubmitted(ctx, cr)
 			}
-			collection = "kubedb-system"
-		} else if state == "notfound" {
-			klog.Info(fmt.Sprintf("API call for asyncid %s not found", asyncId))
-			collection = "kubedb-system"
-		} else {
-			fl = 1
+			if cr.Status == model.CollectionPending {
+				if err := dumper.waitForOverseer(ctx); err != nil {
+					klog.Errorf("collection %s is not submitted: %v", cr.Collection, err)
+					failed.Store(true)
+					return
+				}
+				err := dumper.submit(ctx, cr)
+				dumper.saveState()
+				if err != nil {
+					failed.Store(true)
+					return
+				}
+			}
+			tr.wait(ctx, []*model.CollectionReport{cr})
+			if cr.Status != model.CollectionCompleted {
+				failed.Store(true)
+			}
+		}(cr)
+	}
+	wg.Wait()
+
+	dumper.logSummary()
+	if dumper.failFast && failed.Load() {
+		return fmt.Errorf("stopped submitting collections after the first failure")
+	}
+	return nil
+}
+
+// waitForOverseer blocks while the overseer collection work queue holds at least
+// dumper.maxOverseerQueue tasks, so that a large run doesn't flood the overseer.
+func (dumper *SolrDump) waitForOverseer(ctx context.Context) error {
+	if dumper.maxOverseerQueue <= 0 {
+		return nil
+	}
+	interval := dumper.trackerOpts.PollInterval
+	for {
+		size, err := dumper.overseerQueueSize(ctx)
+		if err != nil {
+			klog.Warningf("failed to read overseer status, not throttling: %v", err)
+			return nil
+		}
+		if size < dumper.maxOverseerQueue {
+			return nil
+		}
+		klog.Infof("overseer collection queue holds %d tasks, waiting for it to drop below %d", size, dumper.maxOverseerQueue)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
 		}
 	}
-	return fl
 }
 
-func (dumper *SolrDump) backup() error {
-	resp, err := dumper.slClient.ListCollection()
-	if err != nil {
-		return err
+// submit sends the async backup or restore request of a single collection.
+func (dumper *SolrDump) submit(ctx context.Context, cr *model.CollectionReport) error {
+	if dumper.action == "backup" {
+		dumper.describeSubmitted(ctx, cr)
 	}
+	asyncId := dumper.asyncId(cr.Collection)
+	dumper.markSubmitted(cr.Collection, cr.Source, cr.BackupName, asyncId)
+	// the async id is persisted before the request is sent, so that a resume after a crash
+	// looks the request up instead of sending the same async id again
+	dumper.saveState()
 
-	responseBody, err := dumper.slClient.DecodeResponse(resp)
+	var responseBody map[string]interface{}
+	var err error
+	if dumper.action == "backup" {
+		klog.Infof("backup collection %s", cr.Collection)
+		responseBody, err = dumper.backupCollection(ctx, cr.Collection, cr.BackupName, asyncId)
+	} else {
+		klog.Infof("restore collection %s from backup %s", cr.Collection, cr.BackupName)
+		responseBody, err = dumper.restoreCollection(ctx, cr.Collection, cr.BackupName, cr.BackupId, asyncId)
+	}
+	klog.V(3).Infof("responsebody %v", responseBody)
 	if err != nil {
+		klog.Errorf("failed to %s collection %s: %v", dumper.action, cr.Collection, err)
+		dumper.markDone(cr.Collection, model.CollectionFailed, err)
 		return err
 	}
+	return nil
+}
 
-	_, err = dumper.slClient.GetResponseStatus(responseBody)
+// checkSubmitted looks up the async request of a collection that was submitted before the run was
+// resumed. The state is saved before a request is sent, so a request solr doesn't know was never
+// received and the collection is put back to pending to be submitted again.
+func (dumper *SolrDump) checkSubmitted(ctx context.Context, cr *model.CollectionReport) {
+	responseBody, err := dumper.requestStatus(ctx, cr.AsyncId)
 	if err != nil {
-		klog.Error(fmt.Sprintf("status is non zero while listing collection"))
-		return err
+		klog.Warningf("failed to check status of asyncId %s, tracking it: %v", cr.AsyncId, err)
+		return
+	}
+	state, err := dumper.slClient.GetAsyncStatus(responseBody)
+	if err != nil {
+		klog.Warningf("failed to read state of asyncId %s, tracking it: %v", cr.AsyncId, err)
+		return
 	}
+	if state != "notfound" {
+		return
+	}
+	klog.Infof("asyncId %s was never received by solr, submitting collection %s again", cr.AsyncId, cr.Collection)
+	dumper.mu.Lock()
+	cr.Status = model.CollectionPending
+	cr.StartTime = nil
+	dumper.mu.Unlock()
+}
 
-	collectionList, err := dumper.slClient.GetCollectionList(responseBody)
+// planBackup adds every collection that is selected for backup to the report.
+func (dumper *SolrDump) planBackup() error {
+	collectionList, err := dumper.listCollections()
 	if err != nil {
 		return err
 	}
 
 	for _, collection := range collectionList {
-		if collection == "kubedb-system" {
+		if collection == "kubedb-system" || !dumper.filter.Match(collection) {
 			continue
 		}
-		fmt.Printf("backup collection %s", collection)
-		resp, err := dumper.slClient.BackupCollection(context.TODO(), collection, fmt.Sprintf("%s-backup", collection), dumper.location, dumper.repository)
-		if err != nil {
-			klog.Error(fmt.Sprintf("Failed to backup collection %s", collection))
-			return err
-		}
-		responseBody, err := dumper.slClient.DecodeResponse(resp)
-		klog.Infof(fmt.Sprintf("responsebody %v", responseBody))
-		if err != nil {
-			klog.Error(fmt.Sprintf("Failed to decode backup response body for collection %s", collection))
-			return err
-		}
-		_, err = dumper.slClient.GetResponseStatus(responseBody)
-		if err != nil {
-			klog.Error(fmt.Sprintf("status is non zero while listing collection"))
-			return err
+		cr := dumper.collectionReport(collection)
+		cr.Source = collection
+		if dumper.mode == model.ModeLogical {
+			cr.BackupName = dumpName(collection)
+		} else {
+			cr.BackupName = fmt.Sprintf("%s-backup", collection)
 		}
 	}
-
-	for {
-		fl := dumper.checkStatus(collectionList)
-		if fl == 0 {
-			break
-		}
-		time.Sleep(10 * time.Second)
+	if len(dumper.report.Collections) == 0 {
+		return fmt.Errorf("no collection matched the collection filters")
 	}
-
 	return nil
 }
 
-func NewS3(prefix string) (model.Blob, error) {
-	bs := &model.BackupStorage{
-		Storage: model.Storage{
-			Provider: model.ProviderS3,
-			S3: &model.S3{
-				Bucket:   "solrbackup",
-				Region:   "us-east-1",
-				Endpoint: "http://proxy-svc.demo.svc:80",
-				Prefix:   prefix,
-			},
-		},
-	}
-	return blob.NewBlob(bs)
-}
+// listCollections returns the collections of the cluster.
+func (dumper *SolrDump) listCollections() ([]string, error) {
+	resp, err := dumper.slClient.ListCollection()
+	if err != nil {
+		return nil, err
+	}
 
-func (dumper *SolrDump) restore() error {
+	responseBody, err := dumper.slClient.DecodeResponse(resp)
+	if err != nil {
+		return nil, err
+	}
 
-	s3b, err := NewS3("/")
+	_, err = dumper.slClient.GetResponseStatus(responseBody)
 	if err != nil {
-		return err
+		klog.Errorf("failed to list collections, solr answered with status code %d: %v", resp.Code, err)
+		return nil, err
 	}
 
-	list, err := s3b.List(context.TODO(), "/")
+	return dumper.slClient.GetCollectionList(responseBody)
+}
+
+// planRestore adds every collection of the backup storage that is selected for restore to the report.
+func (dumper *SolrDump) planRestore() error {
+	if dumper.bl == nil {
+		return fmt.Errorf("backup storage is required for restore")
+	}
+	if dumper.mode == model.ModeLogical {
+		return dumper.planImport()
+	}
+	if dumper.fromRun != "" {
+		return dumper.planRestoreFromRun()
+	}
+
+	backups, err := ListBackups(context.TODO(), dumper.bl)
 	if err != nil {
 		return err
 	}
-	var collectionList []string
-	backupName := ""
-	collection := ""
-	for _, x := range list {
-		part := strings.Split(strings.Trim(x, "/"), "/")
-		if part[0] != backupName && part[1] != collection {
-			backupName = part[0]
-			collection = part[1]
-			collectionList = append(collectionList, collection)
-			resp, err := dumper.slClient.RestoreCollection(context.TODO(), collection, backupName, dumper.location, dumper.repository)
-			if err != nil {
-				klog.Error(fmt.Sprintf("Failed to backup collection %s", collection))
-				return err
+	for _, backup := range backups {
+		if dumper.backup != "" && backup.Name != dumper.backup {
+			continue
+		}
+		for _, cb := range backup.Collections {
+			if !dumper.filter.Match(cb.Name) {
+				continue
 			}
-			responseBody, err := dumper.slClient.DecodeResponse(resp)
-			klog.Infof(fmt.Sprintf("responsebody %v", responseBody))
-			if err != nil {
-				klog.Error(fmt.Sprintf("Failed to decode backup response body for collection %s", collection))
-				return err
+			collection := dumper.targetCollection(cb.Name)
+			if i := slices.IndexFunc(dumper.report.Collections, func(cr *model.CollectionReport) bool {
+				return cr.Collection == collection
+			}); i >= 0 {
+				other := dumper.report.Collections[i]
+				return fmt.Errorf("collection %s would be restored from backup %s and from backup %s, select one with --backup, restore the backup points of a run with --from-run or restore one of them under another name with --rename",
+					collection, other.BackupName, backup.Name)
 			}
-			_, err = dumper.slClient.GetResponseStatus(responseBody)
-			if err != nil {
-				klog.Error(fmt.Sprintf("status is non zero while listing collection"))
-				return err
+			if collection != cb.Name {
+				klog.Infof("restoring collection %s of backup %s into collection %s", cb.Name, backup.Name, collection)
+			}
+			cr := dumper.collectionReport(collection)
+			cr.Source = cb.Name
+			cr.BackupName = backup.Name
+			if dumper.backupId != nil || dumper.asOf != nil {
+				point, err := resolveBackupPoint(cb, dumper.backupId, dumper.asOf)
+				if err != nil {
+					dumper.markDone(collection, model.CollectionFailed, err)
+					return err
+				}
+				klog.Infof("restoring backup id %d of backup %s", point.ID, backup.Name)
+				cr.BackupId = &point.ID
 			}
-
 		}
 	}
-
-	for {
-		fl := dumper.checkStatus(collectionList)
-		if fl == 0 {
-			break
+	if len(dumper.report.Collections) == 0 {
+		if dumper.backup != "" {
+			return fmt.Errorf("no collection of backup %s matched the collection filters", dumper.backup)
 		}
-		time.Sleep(10 * time.Second)
+		return fmt.Errorf("no collection in the backup storage matched the collection filters")
 	}
+	return nil
+}
 
+// planRestoreFromRun adds the collections recorded in the manifest of dumper.fromRun to the report.
+// They are restored at the backup points taken by that run.
+func (dumper *SolrDump) planRestoreFromRun() error {
+	if dumper.backupId != nil || dumper.asOf != nil {
+		return fmt.Errorf("a backup id or time can't be selected when restoring from run %s", dumper.fromRun)
+	}
+	m, err := ReadManifest(context.TODO(), dumper.bl, dumper.fromRun)
+	if err != nil {
+		return err
+	}
+	if m.Mode == model.ModeLogical {
+		return fmt.Errorf("run %s is a logical dump, it is restored with --mode %s", dumper.fromRun, model.ModeLogical)
+	}
+	for _, cm := range m.Collections {
+		if cm.Status != model.CollectionCompleted || !dumper.filter.Match(cm.Name) {
+			continue
+		}
+		collection := dumper.targetCollection(cm.Name)
+		if collection != cm.Name {
+			klog.Infof("restoring collection %s of backup %s into collection %s", cm.Name, cm.BackupName, collection)
+		}
+		cr := dumper.collectionReport(collection)
+		cr.Source = cm.Name
+		cr.BackupName = cm.BackupName
+		cr.BackupId = cm.BackupId
+	}
+	if len(dumper.report.Collections) == 0 {
+		return fmt.Errorf("no completed collection of run %s matched the collection filters", dumper.fromRun)
+	}
 	return nil
 }
+
+// targetCollection returns the name of the collection the given backed up collection is restored into.
+func (dumper *SolrDump) targetCollection(collection string) string {
+	if target, ok := dumper.rename[collection]; ok && target != "" {
+		return target
+	}
+	return collection + dumper.targetSuffix
+}
+
+// asyncError returns the error message solr reported for a failed async request.
+func asyncError(responseBody map[string]interface{}) error {
+	if status, ok := responseBody["status"].(map[string]interface{}); ok {
+		if msg, ok := status["msg"].(string); ok && msg != "" {
+			return fmt.Errorf("%s", msg)
+		}
+	}
+	return fmt.Errorf("async request failed")
+}
@@ -0,0 +1,71 @@
+package solr_dump
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlanRestore(t *testing.T) {
+	taken := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := map[string]struct {
+		backup string
+		rename map[string]string
+		// want maps the restored collections to their backups, empty if planning fails
+		want map[string]string
+		err  string
+	}{
+		"collection in two backups": {
+			err: "--backup",
+		},
+		"backup selected": {
+			backup: "nightly",
+			want:   map[string]string{"c1": "nightly", "c2": "nightly"},
+		},
+		"renamed onto another collection": {
+			backup: "nightly",
+			rename: map[string]string{"c2": "c1"},
+			err:    "--rename",
+		},
+		"unknown backup": {
+			backup: "weekly",
+			err:    "no collection of backup weekly",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			bl := newTestBlob(t)
+			putBackupPoint(t, bl, "c1-backup", "c1", 0, taken)
+			putBackupPoint(t, bl, "nightly", "c1", 0, taken)
+			putBackupPoint(t, bl, "nightly", "c2", 0, taken)
+			filter, err := NewCollectionFilter(nil, nil, "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			dumper := &SolrDump{bl: bl, filter: filter, backup: test.backup, rename: test.rename, report: newReport("restore", "run1")}
+
+			err = dumper.planRestore()
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want one mentioning %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]string{}
+			for _, cr := range dumper.report.Collections {
+				got[cr.Collection] = cr.BackupName
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("planned %v, want %v", got, test.want)
+			}
+			for collection, backup := range test.want {
+				if got[collection] != backup {
+					t.Errorf("collection %s is restored from backup %q, want %q", collection, got[collection], backup)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package solr_dump
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+)
+
+// CollectionFilter decides which collections take part in a backup or restore.
+// Include and Exclude entries are collection names or glob patterns (see path.Match).
+// A collection is selected if it matches any include rule (or no include rule is given)
+// and matches no exclude rule.
+type CollectionFilter struct {
+	include      []string
+	exclude      []string
+	includeRegex *regexp.Regexp
+	excludeRegex *regexp.Regexp
+}
+
+func NewCollectionFilter(include []string, exclude []string, includeRegex string, excludeRegex string) (*CollectionFilter, error) {
+	f := &CollectionFilter{}
+	for _, pattern := range include {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid collection pattern %q: %v", pattern, err)
+		}
+		f.include = append(f.include, pattern)
+	}
+	for _, pattern := range exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid collection pattern %q: %v", pattern, err)
+		}
+		f.exclude = append(f.exclude, pattern)
+	}
+	var err error
+	if includeRegex != "" {
+		if f.includeRegex, err = regexp.Compile(includeRegex); err != nil {
+			return nil, fmt.Errorf("invalid collection regex %q: %v", includeRegex, err)
+		}
+	}
+	if excludeRegex != "" {
+		if f.excludeRegex, err = regexp.Compile(excludeRegex); err != nil {
+			return nil, fmt.Errorf("invalid collection regex %q: %v", excludeRegex, err)
+		}
+	}
+	return f, nil
+}
+
+func (f *CollectionFilter) Match(collection string) bool {
+	if f == nil {
+		return true
+	}
+	if matchAny(f.exclude, collection) || (f.excludeRegex != nil && f.excludeRegex.MatchString(collection)) {
+		return false
+	}
+	if len(f.include) == 0 && f.includeRegex == nil {
+		return true
+	}
+	return matchAny(f.include, collection) || (f.includeRegex != nil && f.includeRegex.MatchString(collection))
+}
+
+func matchAny(patterns []string, collection string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, collection); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package solr_dump
+
+import "testing"
+
+func TestNewCollectionFilterErrors(t *testing.T) {
+	tests := map[string]struct {
+		include, exclude           []string
+		includeRegex, excludeRegex string
+	}{
+		"include pattern": {include: []string{"logs-["}},
+		"exclude pattern": {exclude: []string{"["}},
+		"include regex":   {includeRegex: "logs-("},
+		"exclude regex":   {excludeRegex: "*"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewCollectionFilter(test.include, test.exclude, test.includeRegex, test.excludeRegex); err == nil {
+				t.Error("invalid filter was accepted")
+			}
+		})
+	}
+}
+
+func TestCollectionFilterMatch(t *testing.T) {
+	tests := map[string]struct {
+		include, exclude           []string
+		includeRegex, excludeRegex string
+		match                      map[string]bool
+	}{
+		"no rule": {
+			match: map[string]bool{"c1": true, "logs-2024": true},
+		},
+		"names": {
+			include: []string{"c1", "c2"},
+			match:   map[string]bool{"c1": true, "c2": true, "c3": false, "c10": false},
+		},
+		"glob": {
+			include: []string{"logs-*"},
+			exclude: []string{"logs-tmp*"},
+			match:   map[string]bool{"logs-2024": true, "logs-tmp1": false, "logs": false, "users": false},
+		},
+		"exclude only": {
+			exclude: []string{"?-test"},
+			match:   map[string]bool{"a-test": false, "ab-test": true, "users": true},
+		},
+		"regex": {
+			includeRegex: `^logs-\d+$`,
+			excludeRegex: `^logs-0`,
+			match:        map[string]bool{"logs-2024": true, "logs-01": false, "logs-x": false},
+		},
+		"glob or regex": {
+			include:      []string{"users"},
+			includeRegex: `^logs-`,
+			match:        map[string]bool{"users": true, "logs-1": true, "orders": false},
+		},
+		"exclude wins": {
+			include:      []string{"c1"},
+			excludeRegex: `1$`,
+			match:        map[string]bool{"c1": false},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, err := NewCollectionFilter(test.include, test.exclude, test.includeRegex, test.excludeRegex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for collection, want := range test.match {
+				if got := f.Match(collection); got != want {
+					t.Errorf("Match(%s) = %v, want %v", collection, got, want)
+				}
+			}
+		})
+	}
+
+	var f *CollectionFilter
+	if !f.Match("c1") {
+		t.Error("nil filter doesn't match every collection")
+	}
+}
@@ -0,0 +1,262 @@
+package solr_dump
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pritamdas99/solr-dump/model"
+	"k8s.io/klog/v2"
+)
+
+const (
+	FormatJSONL   = "jsonl"
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+
+	// schemaFile describes the columns of csv and parquet chunks, next to the chunks
+	schemaFile = "schema.json"
+
+	columnString    = "string"
+	columnInt32     = "int32"
+	columnInt64     = "int64"
+	columnFloat     = "float"
+	columnDouble    = "double"
+	columnBoolean   = "boolean"
+	columnTimestamp = "timestamp"
+)
+
+var Formats = []string{FormatJSONL, FormatCSV, FormatParquet}
+
+// columnTypes maps the field type classes of solr to column types, other classes are written as strings.
+var columnTypes = map[string]string{
+	"IntPointField":    columnInt32,
+	"TrieIntField":     columnInt32,
+	"LongPointField":   columnInt64,
+	"TrieLongField":    columnInt64,
+	"FloatPointField":  columnFloat,
+	"TrieFloatField":   columnFloat,
+	"DoublePointField": columnDouble,
+	"TrieDoubleField":  columnDouble,
+	"BoolField":        columnBoolean,
+	"DatePointField":   columnTimestamp,
+	"TrieDateField":    columnTimestamp,
+}
+
+// isDumpFile reports whether name is a file of a logical dump, a chunk or the schema.
+func isDumpFile(name string) bool {
+	return chunkRegex.MatchString(name) || name == schemaFile
+}
+
+// dumpSchema infers the columns of a csv or parquet dump of collection from its schema. The selected
+// fields may be explicit or dynamic fields. Without a selection every stored explicit field is a column,
+// the unique key first. Dynamic fields are only written if they are selected.
+func (dumper *SolrDump) dumpSchema(ctx context.Context, collection string, uniqueKey string, selected []string) (*model.DumpSchema, error) {
+	fields, err := dumper.schemaFields(ctx, collection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schema fields: %v", err)
+	}
+	dynamic, err := dumper.dynamicFields(ctx, collection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schema dynamic fields: %v", err)
+	}
+	types, err := dumper.fieldTypes(ctx, collection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schema field types: %v", err)
+	}
+	// solr matches the longest dynamic field pattern first
+	sort.SliceStable(dynamic, func(i, j int) bool {
+		return len(fmt.Sprint(dynamic[i]["name"])) > len(fmt.Sprint(dynamic[j]["name"]))
+	})
+
+	column := func(name string, field map[string]interface{}) model.DumpField {
+		solrType, _ := field["type"].(string)
+		class := types[solrType]
+		columnType, ok := columnTypes[class[strings.LastIndex(class, ".")+1:]]
+		if !ok {
+			columnType = columnString
+		}
+		multiValued, _ := field["multiValued"].(bool)
+		return model.DumpField{Name: name, Type: columnType, SolrType: solrType, MultiValued: multiValued}
+	}
+
+	schema := &model.DumpSchema{Collection: collection, UniqueKey: uniqueKey}
+	if len(selected) > 0 {
+	next:
+		for _, name := range selected {
+			for _, field := range fields {
+				if field["name"] == name {
+					schema.Fields = append(schema.Fields, column(name, field))
+					continue next
+				}
+			}
+			for _, field := range dynamic {
+				if ok, _ := path.Match(fmt.Sprint(field["name"]), name); ok {
+					schema.Fields = append(schema.Fields, column(name, field))
+					continue next
+				}
+			}
+			return nil, fmt.Errorf("field %s isn't defined in the schema of collection %s", name, collection)
+		}
+		return schema, nil
+	}
+
+	for _, field := range fields {
+		name, _ := field["name"].(string)
+		stored, _ := field["stored"].(bool)
+		docValues, _ := field["docValues"].(bool)
+		asStored, _ := field["useDocValuesAsStored"].(bool)
+		// internal fields like _version_ and _root_ are left out
+		internal := strings.HasPrefix(name, "_") && strings.HasSuffix(name, "_")
+		if name == "" || internal || !(stored || docValues && asStored) {
+			continue
+		}
+		schema.Fields = append(schema.Fields, column(name, field))
+	}
+	sort.SliceStable(schema.Fields, func(i, j int) bool {
+		if schema.Fields[i].Name == uniqueKey || schema.Fields[j].Name == uniqueKey {
+			return schema.Fields[i].Name == uniqueKey
+		}
+		return schema.Fields[i].Name < schema.Fields[j].Name
+	})
+	if len(dynamic) > 0 {
+		klog.Infof("dynamic fields of collection %s are only dumped if they are selected with --fields", collection)
+	}
+	return schema, nil
+}
+
+// docEncoder writes documents to a chunk in one of the dump formats.
+type docEncoder interface {
+	encode(doc map[string]interface{}) error
+	// close writes whatever is buffered, it doesn't close the underlying writer.
+	close() error
+}
+
+func newDocEncoder(dump *model.DumpManifest, w io.Writer, schema *model.DumpSchema) (docEncoder, error) {
+	switch dump.Format {
+	case FormatJSONL:
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		return &jsonlEncoder{enc: enc}, nil
+	case FormatCSV:
+		return &csvEncoder{w: csv.NewWriter(w), schema: schema}, nil
+	case FormatParquet:
+		return newParquetEncoder(w, schema, dump.Compression, dump.CompressionLevel)
+	}
+	return nil, fmt.Errorf("unknown format %s", dump.Format)
+}
+
+type jsonlEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *jsonlEncoder) encode(doc map[string]interface{}) error {
+	return e.enc.Encode(doc)
+}
+
+func (e *jsonlEncoder) close() error {
+	return nil
+}
+
+// csvEncoder writes a header with the field names of the schema, followed by a row per document.
+type csvEncoder struct {
+	w      *csv.Writer
+	schema *model.DumpSchema
+	header bool
+}
+
+func (e *csvEncoder) encode(doc map[string]interface{}) error {
+	if !e.header {
+		names := make([]string, 0, len(e.schema.Fields))
+		for _, field := range e.schema.Fields {
+			names = append(names, field.Name)
+		}
+		if err := e.w.Write(names); err != nil {
+			return err
+		}
+		e.header = true
+	}
+	row := make([]string, 0, len(e.schema.Fields))
+	for _, field := range e.schema.Fields {
+		value, err := csvValue(field, doc[field.Name])
+		if err != nil {
+			return err
+		}
+		row = append(row, value)
+	}
+	return e.w.Write(row)
+}
+
+func (e *csvEncoder) close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// csvValue formats a field value for a csv cell. Missing values are empty, multiple values a json array.
+func csvValue(field model.DumpField, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to format field %s: %v", field.Name, err)
+	}
+	return string(data), nil
+}
+
+// toInt64 converts a dumped value of an integer field.
+func toInt64(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case json.Number:
+		return v.Int64()
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("%v isn't an integer", v)
+		}
+		return int64(v), nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	}
+	return 0, fmt.Errorf("%v isn't an integer", value)
+}
+
+// toFloat64 converts a dumped value of a floating point field.
+func toFloat64(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case json.Number:
+		return v.Float64()
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, fmt.Errorf("%v isn't a number", value)
+}
+
+// toMillis converts a dumped date to milliseconds since the epoch.
+func toMillis(value interface{}) (int64, error) {
+	s, ok := value.(string)
+	if !ok {
+		return 0, fmt.Errorf("%v isn't a date", value)
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return 0, err
+	}
+	return t.UnixMilli(), nil
+}
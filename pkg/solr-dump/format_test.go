@@ -0,0 +1,255 @@
+package solr_dump
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pritamdas99/solr-dump/model"
+)
+
+// schemaSolr serves the schema api of collection c1.
+func schemaSolr(t *testing.T) http.Handler {
+	lists := map[string][]map[string]interface{}{
+		"fields": {
+			{"name": "title", "type": "text_general", "stored": true},
+			{"name": "_version_", "type": "plong", "stored": true, "docValues": true},
+			{"name": "price", "type": "pfloat", "stored": false, "docValues": true, "useDocValuesAsStored": true},
+			{"name": "hidden", "type": "pint", "stored": false, "docValues": true, "useDocValuesAsStored": false},
+			{"name": "id", "type": "string", "stored": true},
+			{"name": "tags", "type": "strings", "stored": true, "multiValued": true},
+			{"name": "_text_", "type": "text_general", "stored": false},
+			{"name": "active", "type": "boolean", "stored": true},
+		},
+		"dynamicFields": {
+			{"name": "*_i", "type": "pint", "stored": true},
+			{"name": "attr_*", "type": "text_general", "stored": true, "multiValued": true},
+			{"name": "*_dt", "type": "pdate", "stored": true},
+		},
+		"fieldTypes": {
+			{"name": "string", "class": "solr.StrField"},
+			{"name": "strings", "class": "solr.StrField"},
+			{"name": "text_general", "class": "solr.TextField"},
+			{"name": "boolean", "class": "solr.BoolField"},
+			{"name": "pint", "class": "solr.IntPointField"},
+			{"name": "plong", "class": "solr.LongPointField"},
+			{"name": "pfloat", "class": "solr.FloatPointField"},
+			{"name": "pdate", "class": "org.apache.solr.schema.DatePointField"},
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("showDefaults") != "true" {
+			t.Errorf("schema requested without defaults: %s", r.URL)
+		}
+		for kind, list := range lists {
+			if r.URL.Path == "/solr/c1/schema/"+strings.ToLower(kind) {
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"responseHeader": map[string]interface{}{"status": 0},
+					kind:             list,
+				})
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"responseHeader": map[string]interface{}{"status": 404},
+			"error":          map[string]interface{}{"msg": "no such collection", "code": 404},
+		})
+	})
+}
+
+func TestDumpSchema(t *testing.T) {
+	tests := map[string]struct {
+		selected []string
+		want     []model.DumpField
+	}{
+		"stored fields": {
+			want: []model.DumpField{
+				{Name: "id", Type: columnString, SolrType: "string"},
+				{Name: "active", Type: columnBoolean, SolrType: "boolean"},
+				{Name: "price", Type: columnFloat, SolrType: "pfloat"},
+				{Name: "tags", Type: columnString, SolrType: "strings", MultiValued: true},
+				{Name: "title", Type: columnString, SolrType: "text_general"},
+			},
+		},
+		"selected fields": {
+			selected: []string{"title", "hidden", "_version_", "id"},
+			want: []model.DumpField{
+				{Name: "title", Type: columnString, SolrType: "text_general"},
+				{Name: "hidden", Type: columnInt32, SolrType: "pint"},
+				{Name: "_version_", Type: columnInt64, SolrType: "plong"},
+				{Name: "id", Type: columnString, SolrType: "string"},
+			},
+		},
+		"dynamic fields": {
+			selected: []string{"id", "views_i", "attr_size_i", "created_dt"},
+			want: []model.DumpField{
+				{Name: "id", Type: columnString, SolrType: "string"},
+				{Name: "views_i", Type: columnInt32, SolrType: "pint"},
+				// the longest pattern wins
+				{Name: "attr_size_i", Type: columnString, SolrType: "text_general", MultiValued: true},
+				{Name: "created_dt", Type: columnTimestamp, SolrType: "pdate"},
+			},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dumper := newTestDumper(t, schemaSolr(t))
+			schema, err := dumper.dumpSchema(context.Background(), "c1", "id", test.selected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if schema.Collection != "c1" || schema.UniqueKey != "id" {
+				t.Errorf("schema is of collection %s with unique key %s", schema.Collection, schema.UniqueKey)
+			}
+			if !reflect.DeepEqual(schema.Fields, test.want) {
+				t.Errorf("fields = %+v, want %+v", schema.Fields, test.want)
+			}
+		})
+	}
+}
+
+func TestDumpSchemaErrors(t *testing.T) {
+	dumper := newTestDumper(t, schemaSolr(t))
+	_, err := dumper.dumpSchema(context.Background(), "c1", "id", []string{"id", "missing"})
+	if err == nil || !strings.Contains(err.Error(), "isn't defined in the schema") {
+		t.Errorf("unknown field returned %v", err)
+	}
+	if _, err := dumper.dumpSchema(context.Background(), "c2", "id", nil); err == nil {
+		t.Error("schema of a missing collection was returned")
+	}
+}
+
+func TestCSVEncoder(t *testing.T) {
+	schema := &model.DumpSchema{
+		Collection: "c1",
+		UniqueKey:  "id",
+		Fields: []model.DumpField{
+			{Name: "id", Type: columnString},
+			{Name: "count", Type: columnInt32},
+			{Name: "active", Type: columnBoolean},
+			{Name: "tags", Type: columnString, MultiValued: true},
+			{Name: "title", Type: columnString},
+		},
+	}
+	docs := []map[string]interface{}{
+		{"id": "1", "count": json.Number("42"), "active": true, "tags": []interface{}{"a", "b"}, "title": "plain"},
+		{"id": "2", "active": false, "title": "with, comma and \"quotes\"\nand a newline"},
+		{"id": "3", "tags": []interface{}{}, "other": "not a column"},
+	}
+
+	var buf bytes.Buffer
+	e, err := newDocEncoder(&model.DumpManifest{Format: FormatCSV}, &buf, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, doc := range docs {
+		if err := e.encode(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"id", "count", "active", "tags", "title"},
+		{"1", "42", "true", `["a","b"]`, "plain"},
+		{"2", "", "false", "", "with, comma and \"quotes\"\nand a newline"},
+		{"3", "", "", "[]", ""},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %q, want %q", rows, want)
+	}
+
+	// the header is only written with the first document
+	buf.Reset()
+	e, _ = newDocEncoder(&model.DumpManifest{Format: FormatCSV}, &buf, schema)
+	if err := e.close(); err != nil || buf.Len() != 0 {
+		t.Errorf("empty chunk = %q, %v", buf.String(), err)
+	}
+}
+
+func TestToInt64(t *testing.T) {
+	tests := map[string]struct {
+		value   interface{}
+		want    int64
+		wantErr bool
+	}{
+		"number":          {value: json.Number("-42"), want: -42},
+		"large number":    {value: json.Number("9007199254740993"), want: 9007199254740993},
+		"float":           {value: float64(7), want: 7},
+		"string":          {value: "12", want: 12},
+		"fraction number": {value: json.Number("1.5"), wantErr: true},
+		"fraction float":  {value: 1.5, wantErr: true},
+		"bad string":      {value: "twelve", wantErr: true},
+		"boolean":         {value: true, wantErr: true},
+		"nil":             {value: nil, wantErr: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := toInt64(test.value)
+			if (err != nil) != test.wantErr || !test.wantErr && got != test.want {
+				t.Errorf("toInt64(%#v) = %d, %v, want %d", test.value, got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestToFloat64(t *testing.T) {
+	tests := map[string]struct {
+		value   interface{}
+		want    float64
+		wantErr bool
+	}{
+		"number":     {value: json.Number("1.25"), want: 1.25},
+		"exponent":   {value: json.Number("-2e3"), want: -2000},
+		"float":      {value: 0.5, want: 0.5},
+		"string":     {value: "3.5", want: 3.5},
+		"bad number": {value: json.Number("x"), wantErr: true},
+		"bad string": {value: "high", wantErr: true},
+		"boolean":    {value: false, wantErr: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := toFloat64(test.value)
+			if (err != nil) != test.wantErr || !test.wantErr && got != test.want {
+				t.Errorf("toFloat64(%#v) = %v, %v, want %v", test.value, got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestToMillis(t *testing.T) {
+	tests := map[string]struct {
+		value   interface{}
+		want    int64
+		wantErr bool
+	}{
+		"epoch":        {value: "1970-01-01T00:00:00Z", want: 0},
+		"seconds":      {value: "2024-01-01T00:00:00Z", want: 1704067200000},
+		"milliseconds": {value: "2024-01-01T00:00:00.123Z", want: 1704067200123},
+		"before epoch": {value: "1969-12-31T23:59:59.5Z", want: -500},
+		"offset":       {value: "2024-01-01T01:00:00+01:00", want: 1704067200000},
+		"no time":      {value: "2024-01-01", wantErr: true},
+		"number":       {value: json.Number("1704067200000"), wantErr: true},
+		"nil":          {value: nil, wantErr: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := toMillis(test.value)
+			if (err != nil) != test.wantErr || !test.wantErr && got != test.want {
+				t.Errorf("toMillis(%#v) = %d, %v, want %d", test.value, got, err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package solr_dump
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pritamdas99/solr-dump/blob"
+	"github.com/pritamdas99/solr-dump/model"
+)
+
+// newTestBlob returns an in-memory backup storage of its own for test t.
+func newTestBlob(t *testing.T) model.Blob {
+	t.Helper()
+	bl, err := blob.NewBlob(&model.BackupStorage{Storage: model.Storage{
+		Provider: model.ProviderMemory,
+		Memory:   &model.Memory{Name: t.Name()},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bl
+}
+
+func putObject(t *testing.T, bl model.Blob, filepath string, data []byte) {
+	t.Helper()
+	if err := bl.Put(context.Background(), filepath, bytes.NewReader(data)); err != nil {
+		t.Fatalf("failed to put %s: %v", filepath, err)
+	}
+}
+
+func getObject(t *testing.T, bl model.Blob, filepath string) []byte {
+	t.Helper()
+	data, err := bl.Get(context.Background(), filepath)
+	if err != nil {
+		t.Fatalf("failed to get %s: %v", filepath, err)
+	}
+	return data
+}
+
+// newTestDumper returns a SolrDump connected to a solr served by handler.
+func newTestDumper(t *testing.T, handler http.Handler) *SolrDump {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	slClient, err := newDirectSolrClient(ConnectionOptions{SolrURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &SolrDump{slClient: slClient, report: newReport("backup", "run1")}
+}
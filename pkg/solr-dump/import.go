@@ -0,0 +1,391 @@
+package solr_dump
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pritamdas99/solr-dump/model"
+	"k8s.io/klog/v2"
+)
+
+// maxRetryInterval caps the backoff between retries of an update request.
+const maxRetryInterval = 30 * time.Second
+
+// planImport adds the collections of the logical dumps in the backup storage that are selected for
+// restore to the report. A collection is imported from the newest dump, or from the newest dump taken
+// at or before dumper.asOf. dumper.fromRun selects the dumps of a single run instead.
+func (dumper *SolrDump) planImport() error {
+	if dumper.backupId != nil {
+		return fmt.Errorf("logical dumps have no backup ids, select a dump by its run or time")
+	}
+	var manifests []*model.Manifest
+	if dumper.fromRun != "" {
+		m, err := ReadManifest(context.TODO(), dumper.bl, dumper.fromRun)
+		if err != nil {
+			return err
+		}
+		if m.Mode != model.ModeLogical {
+			return fmt.Errorf("run %s is not a logical dump", dumper.fromRun)
+		}
+		manifests = append(manifests, m)
+	} else {
+		var err error
+		manifests, err = logicalManifests(context.TODO(), dumper.bl)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, m := range manifests {
+		if dumper.asOf != nil && m.EndTime.After(*dumper.asOf) {
+			continue
+		}
+		for _, cm := range m.Collections {
+			if cm.Status != model.CollectionCompleted || cm.Dump == nil || !dumper.filter.Match(cm.Name) {
+				continue
+			}
+			collection := dumper.targetCollection(cm.Name)
+			if slices.ContainsFunc(dumper.report.Collections, func(cr *model.CollectionReport) bool {
+				return cr.Collection == collection
+			}) {
+				// a newer dump of the collection is imported already
+				continue
+			}
+			klog.Infof("importing collection %s of run %s into collection %s", cm.Name, m.RunId, collection)
+			cr := dumper.collectionReport(collection)
+			cr.Source = cm.Name
+			cr.BackupName = cm.BackupName
+			cr.Dump = cm.Dump
+		}
+	}
+	if len(dumper.report.Collections) == 0 {
+		return fmt.Errorf("no completed logical dump matched the collection filters")
+	}
+	return nil
+}
+
+// logicalManifests returns the manifests of the logical dumps in the backup storage, newest first.
+func logicalManifests(ctx context.Context, bl model.Blob) ([]*model.Manifest, error) {
+	objects, err := bl.List(ctx, path.Join(model.MetadataDir, "runs"))
+	if err != nil {
+		return nil, err
+	}
+	var manifests []*model.Manifest
+	for _, obj := range objects {
+		runId, ok := isManifestPath(obj)
+		if !ok {
+			continue
+		}
+		m, err := ReadManifest(ctx, bl, runId)
+		if err != nil {
+			klog.Warning(err)
+			continue
+		}
+		if m.Mode == model.ModeLogical {
+			manifests = append(manifests, m)
+		}
+	}
+	sort.Slice(manifests, func(i, j int) bool {
+		return manifests[i].EndTime.After(manifests[j].EndTime)
+	})
+	return manifests, nil
+}
+
+// importCollection indexes the documents of the logical dump of cr into the collection of cr, which is
+// created first if it doesn't exist.
+func (dumper *SolrDump) importCollection(ctx context.Context, cr *model.CollectionReport) {
+	dumper.markSubmitted(cr.Collection, cr.Source, cr.BackupName, "")
+	dumper.saveState()
+	if dumper.trackerOpts.CollectionTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dumper.trackerOpts.CollectionTimeout)
+		defer cancel()
+	}
+
+	klog.Infof("import collection %s from %s", cr.Collection, cr.Dump.Path)
+	if f := cr.Dump.Filter; cr.Dump.Partial && f != nil {
+		klog.Warningf("dump %s is partial, it holds %d documents selected by query %q, filter queries %v and max docs %d",
+			cr.Dump.Path, cr.Dump.NumDocs, f.Query, f.FilterQueries, f.MaxDocs)
+		if len(f.Fields) > 0 {
+			klog.Warningf("dump %s only holds fields %v, the imported documents replace existing documents with the same %s entirely", cr.Dump.Path, f.Fields, cr.Dump.UniqueKey)
+		}
+	}
+	n, err := dumper.importDocuments(ctx, cr)
+	status := model.CollectionCompleted
+	switch {
+	case err != nil && ctx.Err() == context.DeadlineExceeded && dumper.trackerOpts.CollectionTimeout > 0:
+		status = model.CollectionTimedOut
+	case err != nil:
+		status = model.CollectionFailed
+	default:
+		klog.Infof("imported %d documents into collection %s", n, cr.Collection)
+	}
+	if err != nil {
+		klog.Errorf("failed to import collection %s after %d documents: %v", cr.Collection, n, err)
+	}
+	dumper.markDone(cr.Collection, status, err)
+	dumper.saveState()
+}
+
+// importDocuments reads the chunks of the dump of cr and sends their documents to solr in batches of
+// dumper.logical.BatchSize, with at most dumper.logical.Concurrency update requests in flight. The
+// documents are committed once all of them are indexed. It returns the number of indexed documents.
+func (dumper *SolrDump) importDocuments(ctx context.Context, cr *model.CollectionReport) (int64, error) {
+	dump := cr.Dump
+	if dump.Format != FormatJSONL {
+		return 0, fmt.Errorf("format %s of dump %s can't be imported", dump.Format, dump.Path)
+	}
+	// the chunks are read twice, a corrupted chunk must fail the import before anything is indexed
+	klog.Infof("checking the checksums of the %d chunks of %s", len(dump.Chunks), dump.Path)
+	if problems := verifyDump(ctx, dumper.bl, dump); len(problems) > 0 {
+		fv := problems[0]
+		problem := string(fv.Problem)
+		if fv.Detail != "" {
+			problem += ": " + fv.Detail
+		}
+		return 0, fmt.Errorf("%s of dump %s is invalid, nothing was imported: %s", fv.File, dump.Path, problem)
+	}
+	if err := dumper.ensureCollection(ctx, cr); err != nil {
+		return 0, err
+	}
+	mapper, err := dumper.fieldMapper(ctx, cr.Collection)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	concurrency := dumper.logical.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var wg sync.WaitGroup
+	var indexed atomic.Int64
+	var failure atomic.Pointer[error]
+	batches := make(chan []map[string]interface{})
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				if err := dumper.sendBatch(ctx, cr.Collection, batch); err != nil {
+					failure.CompareAndSwap(nil, &err)
+					cancel()
+					continue
+				}
+				indexed.Add(int64(len(batch)))
+			}
+		}()
+	}
+
+	err = dumper.readDump(ctx, dump, mapper, batches)
+	close(batches)
+	wg.Wait()
+	if ferr := failure.Load(); ferr != nil {
+		return indexed.Load(), *ferr
+	}
+	if err != nil {
+		return indexed.Load(), err
+	}
+	if err := dumper.commit(ctx, cr.Collection); err != nil {
+		return indexed.Load(), fmt.Errorf("failed to commit: %v", err)
+	}
+	return indexed.Load(), nil
+}
+
+// readDump reads the chunks of dump in order, maps their documents and sends them to batches.
+func (dumper *SolrDump) readDump(ctx context.Context, dump *model.DumpManifest, mapper *fieldMapper, batches chan<- []map[string]interface{}) error {
+	batchSize := dumper.logical.BatchSize
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	batch := make([]map[string]interface{}, 0, batchSize)
+	send := func() error {
+		select {
+		case batches <- batch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		batch = make([]map[string]interface{}, 0, batchSize)
+		return nil
+	}
+	for _, chunk := range dump.Chunks {
+		var docs int64
+		err := readChunk(ctx, dumper.bl, dump, chunk, func(doc map[string]interface{}) error {
+			docs++
+			mapper.apply(doc)
+			batch = append(batch, doc)
+			if len(batch) == batchSize {
+				return send()
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if docs != chunk.Docs {
+			return fmt.Errorf("chunk %s holds %d documents, its manifest records %d", chunk.Name, docs, chunk.Docs)
+		}
+		klog.V(3).Infof("read %d documents of chunk %s", docs, path.Join(dump.Path, chunk.Name))
+	}
+	if len(batch) > 0 {
+		return send()
+	}
+	return nil
+}
+
+// readChunk passes every document of a chunk to fn.
+func readChunk(ctx context.Context, bl model.Blob, dump *model.DumpManifest, chunk model.ChunkManifest, fn func(doc map[string]interface{}) error) error {
+	filepath := path.Join(dump.Path, chunk.Name)
+	rc, err := bl.NewReader(ctx, filepath)
+	if err != nil {
+		return fmt.Errorf("failed to open chunk %s: %v", filepath, err)
+	}
+	defer rc.Close()
+
+	r, err := newDecompressor(rc)
+	if err != nil {
+		return fmt.Errorf("failed to read chunk %s: %v", filepath, err)
+	}
+	defer r.Close()
+
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	for {
+		doc := make(map[string]interface{})
+		if err := dec.Decode(&doc); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read chunk %s: %v", filepath, err)
+		}
+		if err := fn(doc); err != nil {
+			return err
+		}
+	}
+}
+
+// sendBatch indexes docs, retrying with a growing interval while solr is overloaded or fails with
+// a server error.
+func (dumper *SolrDump) sendBatch(ctx context.Context, collection string, docs []map[string]interface{}) error {
+	interval := time.Second
+	for attempt := 0; ; attempt++ {
+		retry, err := dumper.updateDocuments(ctx, collection, docs, dumper.logical.CommitWithin)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= dumper.logical.MaxRetries {
+			return err
+		}
+		klog.Warningf("failed to index %d documents into collection %s, retrying in %v: %v", len(docs), collection, interval, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+		interval *= 2
+		if interval > maxRetryInterval {
+			interval = maxRetryInterval
+		}
+	}
+}
+
+// ensureCollection creates the collection of cr with the creation parameters recorded at dump
+// time, unless it exists already.
+func (dumper *SolrDump) ensureCollection(ctx context.Context, cr *model.CollectionReport) error {
+	collections, err := dumper.listCollections()
+	if err != nil {
+		return fmt.Errorf("failed to list collections: %v", err)
+	}
+	if slices.Contains(collections, cr.Collection) {
+		return nil
+	}
+
+	// the chunks of a dump are stored in <backupName>/<collection>/<runId>
+	runId := path.Base(cr.Dump.Path)
+	m, err := ReadManifest(ctx, dumper.bl, runId)
+	if err != nil {
+		return err
+	}
+	var params map[string]string
+	for _, cm := range m.Collections {
+		if cm.Name != cr.Source || len(cm.CreateParams) == 0 {
+			continue
+		}
+		params = make(map[string]string, len(cm.CreateParams))
+		for key, value := range cm.CreateParams {
+			params[key] = value
+		}
+		// the implicit router needs the shard names instead of their number
+		if params["router.name"] == "implicit" {
+			var shards []string
+			for _, sm := range cm.Shards {
+				shards = append(shards, sm.Name)
+			}
+			params["shards"] = strings.Join(shards, ",")
+			delete(params, "numShards")
+		}
+	}
+	if params == nil {
+		return fmt.Errorf("collection %s doesn't exist and run %s didn't record how to create it", cr.Collection, runId)
+	}
+	// removed in solr 9
+	delete(params, "maxShardsPerNode")
+	klog.Infof("creating collection %s with %v", cr.Collection, params)
+	if err := dumper.createCollection(ctx, cr.Collection, params); err != nil {
+		return fmt.Errorf("failed to create collection %s: %v", cr.Collection, err)
+	}
+	return nil
+}
+
+// fieldMapper prepares dumped documents for indexing into a collection.
+type fieldMapper struct {
+	drop   []string
+	rename map[string]string
+	// copyTargets are the destinations of the copy fields of the target schema, solr fills them
+	// itself and rejects multiple values for a single valued destination.
+	copyTargets []string
+}
+
+func (dumper *SolrDump) fieldMapper(ctx context.Context, collection string) (*fieldMapper, error) {
+	targets, err := dumper.copyFieldTargets(ctx, collection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get copy fields of collection %s: %v", collection, err)
+	}
+	return &fieldMapper{
+		drop:        dumper.logical.DropFields,
+		rename:      dumper.logical.RenameFields,
+		copyTargets: targets,
+	}, nil
+}
+
+// apply drops _version_, which would make solr reject the document as a conflicting update, and the
+// dropped fields, renames fields and finally drops the fields solr fills through copy fields.
+func (fm *fieldMapper) apply(doc map[string]interface{}) {
+	delete(doc, "_version_")
+	for _, name := range fm.drop {
+		delete(doc, name)
+	}
+	for from, to := range fm.rename {
+		if value, ok := doc[from]; ok {
+			delete(doc, from)
+			doc[to] = value
+		}
+	}
+	for name := range doc {
+		for _, pattern := range fm.copyTargets {
+			if ok, _ := path.Match(pattern, name); ok {
+				delete(doc, name)
+				break
+			}
+		}
+	}
+}
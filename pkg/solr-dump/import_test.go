@@ -0,0 +1,171 @@
+package solr_dump
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pritamdas99/solr-dump/model"
+)
+
+func TestFieldMapperApply(t *testing.T) {
+	tests := map[string]struct {
+		mapper fieldMapper
+		doc    map[string]interface{}
+		want   map[string]interface{}
+	}{
+		"version": {
+			doc:  map[string]interface{}{"id": "1", "_version_": json.Number("1790000000000000000")},
+			want: map[string]interface{}{"id": "1"},
+		},
+		"drop and rename": {
+			mapper: fieldMapper{drop: []string{"secret", "absent"}, rename: map[string]string{"name": "title", "absent": "other"}},
+			doc:    map[string]interface{}{"id": "1", "secret": "s", "name": "n"},
+			want:   map[string]interface{}{"id": "1", "title": "n"},
+		},
+		"copy field targets": {
+			mapper: fieldMapper{copyTargets: []string{"_text_", "*_sort"}},
+			doc:    map[string]interface{}{"id": "1", "_text_": "all", "title_sort": "t", "title": "t"},
+			want:   map[string]interface{}{"id": "1", "title": "t"},
+		},
+		// renaming happens before copy field targets are removed
+		"renamed onto a copy field target": {
+			mapper: fieldMapper{rename: map[string]string{"title": "title_sort"}, copyTargets: []string{"*_sort"}},
+			doc:    map[string]interface{}{"id": "1", "title": "t", "name": "n"},
+			want:   map[string]interface{}{"id": "1", "name": "n"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			test.mapper.apply(test.doc)
+			if !reflect.DeepEqual(test.doc, test.want) {
+				t.Errorf("got %v, want %v", test.doc, test.want)
+			}
+		})
+	}
+}
+
+// updateSolr answers the update requests of collection c1 with statuses, one per request. The last
+// status is repeated.
+type updateSolr struct {
+	mu       sync.Mutex
+	statuses []int
+	requests int
+}
+
+func (s *updateSolr) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.URL.Path != "/solr/c1/update" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	status := s.statuses[min(s.requests, len(s.statuses)-1)]
+	s.requests++
+	w.WriteHeader(status)
+	body := map[string]interface{}{"responseHeader": map[string]interface{}{"status": 0}}
+	if status != http.StatusOK {
+		body = map[string]interface{}{
+			"responseHeader": map[string]interface{}{"status": status},
+			"error":          map[string]interface{}{"msg": http.StatusText(status), "code": status},
+		}
+	}
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func TestSendBatch(t *testing.T) {
+	tests := map[string]struct {
+		statuses   []int
+		maxRetries int
+		requests   int
+		err        bool
+	}{
+		"indexed":           {statuses: []int{http.StatusOK}, maxRetries: 5, requests: 1},
+		"unavailable":       {statuses: []int{http.StatusServiceUnavailable, http.StatusOK}, maxRetries: 5, requests: 2},
+		"too many requests": {statuses: []int{http.StatusTooManyRequests, http.StatusOK}, maxRetries: 5, requests: 2},
+		"bad request":       {statuses: []int{http.StatusBadRequest}, maxRetries: 5, requests: 1, err: true},
+		"retries exhausted": {statuses: []int{http.StatusServiceUnavailable}, maxRetries: 1, requests: 2, err: true},
+		"retries disabled":  {statuses: []int{http.StatusInternalServerError}, maxRetries: 0, requests: 1, err: true},
+		"error after a 5xx": {statuses: []int{http.StatusBadGateway, http.StatusBadRequest}, maxRetries: 5, requests: 2, err: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			solr := &updateSolr{statuses: test.statuses}
+			dumper := newTestDumper(t, solr)
+			dumper.streamClient = newStreamClient(dumper.slClient.Client)
+			dumper.logical.MaxRetries = test.maxRetries
+
+			err := dumper.sendBatch(context.Background(), "c1", []map[string]interface{}{{"id": "1"}})
+			if (err != nil) != test.err {
+				t.Errorf("got error %v, want error %v", err, test.err)
+			}
+			if solr.requests != test.requests {
+				t.Errorf("sent %d requests, want %d", solr.requests, test.requests)
+			}
+		})
+	}
+}
+
+func TestReadDump(t *testing.T) {
+	tests := map[string]struct {
+		docs int64
+		err  string
+	}{
+		"document count matches": {docs: 3},
+		"chunk holds fewer":      {docs: 4, err: "chunk chunk-00001.jsonl holds 3 documents, its manifest records 4"},
+		"chunk holds more":       {docs: 2, err: "chunk chunk-00001.jsonl holds 3 documents, its manifest records 2"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			bl := newTestBlob(t)
+			putObject(t, bl, "c1-dump/c1/run1/chunk-00000.jsonl", []byte(`{"id":"1","_version_":1}`+"\n"+`{"id":"2","_version_":2}`+"\n"))
+			putObject(t, bl, "c1-dump/c1/run1/chunk-00001.jsonl", []byte(`{"id":"3"}`+"\n"+`{"id":"4"}`+"\n"+`{"id":"5","name":"n"}`+"\n"))
+			dump := &model.DumpManifest{
+				Path:   "c1-dump/c1/run1",
+				Format: FormatJSONL,
+				Chunks: []model.ChunkManifest{
+					{Name: "chunk-00000.jsonl", Docs: 2},
+					{Name: "chunk-00001.jsonl", Docs: test.docs},
+				},
+			}
+			dumper := &SolrDump{bl: bl, logical: LogicalOptions{BatchSize: 2}}
+			mapper := &fieldMapper{rename: map[string]string{"name": "title"}}
+
+			batches := make(chan []map[string]interface{})
+			var got [][]map[string]interface{}
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for batch := range batches {
+					got = append(got, batch)
+				}
+			}()
+			err := dumper.readDump(context.Background(), dump, mapper, batches)
+			close(batches)
+			<-done
+
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := [][]map[string]interface{}{
+				{{"id": "1"}, {"id": "2"}},
+				{{"id": "3"}, {"id": "4"}},
+				{{"id": "5", "title": "n"}},
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got batches %v, want %v", got, want)
+			}
+		})
+	}
+}
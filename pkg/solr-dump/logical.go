@@ -0,0 +1,393 @@
+package solr_dump
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/pritamdas99/solr-dump/model"
+	"k8s.io/klog/v2"
+)
+
+const (
+	ExportCursor  = "cursor"
+	ExportHandler = "export"
+)
+
+// errMaxDocs stops reading documents once the dump holds the maximum number of documents.
+var errMaxDocs = errors.New("maximum number of documents dumped")
+
+// chunkRegex matches the chunk files of a logical dump, chunk-<n>.<format>[.<compression>].
+var chunkRegex = regexp.MustCompile(`^chunk-\d{5,}\.`)
+
+// LogicalOptions configures logical dumps.
+type LogicalOptions struct {
+	// Format is the format of the chunks, one of Formats. csv and parquet chunks have a column per
+	// field of the schema described in schema.json next to the chunks.
+	Format string
+	// Method is how documents are read: ExportCursor pages through the select handler with
+	// cursorMark, ExportHandler streams them through the /export handler, which requires
+	// docValues on every exported field.
+	Method string
+	// BatchSize is the number of documents read per cursorMark request, and sent per update
+	// request by an import.
+	BatchSize int
+	// ChunkSize is the number of documents per chunk file.
+	ChunkSize int
+	// Filter selects the documents and fields to dump.
+	Filter model.DumpFilter
+	// Concurrency is the number of update requests an import sends to a collection at the same time.
+	Concurrency int
+	// CommitWithin is passed to solr with every update request. Zero leaves it to the autoCommit
+	// settings, the documents are committed explicitly once the import finished in any case.
+	CommitWithin time.Duration
+	// MaxRetries is the number of times an update request is retried while solr answers with
+	// 429 or a 5xx status code.
+	MaxRetries int
+	// DropFields are removed from the documents before they are imported, RenameFields renames
+	// fields from their dumped to their imported name.
+	DropFields   []string
+	RenameFields map[string]string
+}
+
+func DefaultLogicalOptions() LogicalOptions {
+	return LogicalOptions{
+		Format:    FormatJSONL,
+		Method:    ExportCursor,
+		BatchSize: 1000,
+		ChunkSize: 100000,
+
+		Concurrency: 4,
+		MaxRetries:  5,
+	}
+}
+
+func dumpName(collection string) string {
+	return collection + "-dump"
+}
+
+// dumpPath returns the directory of the chunks of a logical dump of collection.
+func dumpPath(backupName string, collection string, runId string) string {
+	return path.Join(backupName, collection, runId)
+}
+
+// exportCollection writes every document of the collection of cr to chunks in
+// <collection>-dump/<collection>/<runId>/. The chunks written are recorded in the report of the collection.
+func (dumper *SolrDump) exportCollection(ctx context.Context, cr *model.CollectionReport) {
+	dumper.markSubmitted(cr.Collection, cr.Source, cr.BackupName, "")
+	dumper.saveState()
+	if dumper.trackerOpts.CollectionTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dumper.trackerOpts.CollectionTimeout)
+		defer cancel()
+	}
+
+	cm := dumper.describeCollection(ctx, cr.Collection)
+	dumper.mu.Lock()
+	cr.Description = cm
+	dumper.mu.Unlock()
+
+	klog.Infof("dump collection %s", cr.Collection)
+	dump, err := dumper.dumpDocuments(ctx, cr.Collection, dumpPath(cr.BackupName, cr.Collection, dumper.report.RunId))
+	status := model.CollectionCompleted
+	switch {
+	case err != nil && ctx.Err() == context.DeadlineExceeded && dumper.trackerOpts.CollectionTimeout > 0:
+		status = model.CollectionTimedOut
+	case err != nil:
+		status = model.CollectionFailed
+	default:
+		klog.Infof("dumped %d documents of collection %s in %d chunks", dump.NumDocs, cr.Collection, len(dump.Chunks))
+	}
+	if err != nil {
+		klog.Errorf("failed to dump collection %s: %v", cr.Collection, err)
+	}
+	dumper.mu.Lock()
+	cr.Dump = dump
+	dumper.mu.Unlock()
+	dumper.markDone(cr.Collection, status, err)
+	dumper.saveState()
+}
+
+// dumpDocuments reads the documents of collection and writes them to chunks in dir. Chunks left
+// behind by an interrupted attempt are removed first.
+func (dumper *SolrDump) dumpDocuments(ctx context.Context, collection string, dir string) (*model.DumpManifest, error) {
+	stale, err := dumper.bl.List(ctx, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %v", dir, err)
+	}
+	for _, obj := range stale {
+		if err := dumper.bl.Delete(ctx, obj); err != nil {
+			return nil, fmt.Errorf("failed to remove %s of an earlier attempt: %v", obj, err)
+		}
+	}
+
+	uniqueKey, err := dumper.uniqueKey(ctx, collection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unique key: %v", err)
+	}
+	filter := dumper.logical.Filter
+	// the unique key is needed to import the documents again
+	if len(filter.Fields) > 0 && !slices.Contains(filter.Fields, uniqueKey) {
+		filter.Fields = append([]string{uniqueKey}, filter.Fields...)
+	}
+	dump := &model.DumpManifest{
+		Path:             dir,
+		Format:           dumper.logical.Format,
+		Compression:      dumper.compression.codec(),
+		CompressionLevel: dumper.compression.Level,
+		Method:           dumper.logical.Method,
+		UniqueKey:        uniqueKey,
+		Encryption:       encryption(dumper.keys),
+		Chunks:           []model.ChunkManifest{},
+	}
+	if dump.Format == "" {
+		dump.Format = FormatJSONL
+	}
+	if !filter.IsZero() {
+		dump.Filter = &filter
+		dump.Partial = (filter.Query != "" && filter.Query != "*:*") || len(filter.FilterQueries) > 0 || len(filter.Fields) > 0
+	}
+
+	var schema *model.DumpSchema
+	if dump.Format != FormatJSONL {
+		schema, err = dumper.dumpSchema(ctx, collection, uniqueKey, filter.Fields)
+		if err != nil {
+			return dump, err
+		}
+		data, err := json.MarshalIndent(schema, "", "  ")
+		if err != nil {
+			return dump, err
+		}
+		if err := dumper.bl.Put(ctx, path.Join(dir, schemaFile), bytes.NewReader(data)); err != nil {
+			return dump, fmt.Errorf("failed to write %s: %v", schemaFile, err)
+		}
+		dump.Schema = schemaFile
+		dump.SchemaSHA256 = sha256Hex(data)
+		// only the columns of the schema are written
+		if len(filter.Fields) == 0 {
+			for _, field := range schema.Fields {
+				filter.Fields = append(filter.Fields, field.Name)
+			}
+		}
+	}
+	cw := &chunkWriter{bl: dumper.bl, dump: dump, schema: schema, chunkSize: dumper.logical.ChunkSize, maxDocs: filter.MaxDocs}
+	defer cw.abort()
+
+	switch dumper.logical.Method {
+	case ExportHandler:
+		var fields []string
+		if len(filter.Fields) == 0 {
+			fields, err = dumper.docValuesFields(ctx, collection)
+			if err != nil {
+				return dump, err
+			}
+		}
+		err = dumper.exportDocuments(ctx, collection, uniqueKey, filter, fields, cw.write(ctx))
+	default:
+		cursor := "*"
+		for {
+			rows := dumper.logical.BatchSize
+			if remaining := filter.MaxDocs - cw.docs(); filter.MaxDocs > 0 && remaining < int64(rows) {
+				rows = int(remaining)
+			}
+			var next string
+			next, err = dumper.cursorPage(ctx, collection, uniqueKey, filter, cursor, rows, cw.write(ctx))
+			if err != nil || next == cursor {
+				break
+			}
+			cursor = next
+		}
+	}
+	if errors.Is(err, errMaxDocs) {
+		err = nil
+		// the dump is partial only if documents are left once it stopped at the limit
+		numFound, cerr := dumper.countDocuments(ctx, collection, filter)
+		switch {
+		case cerr != nil:
+			klog.Warningf("failed to count documents of collection %s, marking its dump partial: %v", collection, cerr)
+			dump.Partial = true
+		case numFound > filter.MaxDocs:
+			klog.Infof("dump of collection %s stopped at %d of %d documents", collection, filter.MaxDocs, numFound)
+			dump.Partial = true
+		}
+	}
+	if err != nil {
+		return dump, err
+	}
+	return dump, cw.close()
+}
+
+// docValuesFields returns the schema fields the export handler can return.
+func (dumper *SolrDump) docValuesFields(ctx context.Context, collection string) ([]string, error) {
+	fields, err := dumper.schemaFields(ctx, collection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schema fields: %v", err)
+	}
+	var names []string
+	for _, field := range fields {
+		name, _ := field["name"].(string)
+		if docValues, _ := field["docValues"].(bool); docValues && name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no field of collection %s has docValues, use the %s method", collection, ExportCursor)
+	}
+	klog.V(3).Infof("exporting fields %v of collection %s", names, collection)
+	return names, nil
+}
+
+// chunkWriter writes documents to rolling chunk files of at most chunkSize documents and records
+// every completed chunk in dump.
+type chunkWriter struct {
+	bl        model.Blob
+	dump      *model.DumpManifest
+	schema    *model.DumpSchema
+	chunkSize int
+	maxDocs   int64
+
+	cancel context.CancelFunc
+	w      io.WriteCloser
+	cnt    *countingWriter
+	sum    hash.Hash
+	zw     io.WriteCloser
+	enc    docEncoder
+	chunk  model.ChunkManifest
+}
+
+// write returns a function that writes a document to the current chunk, starting a new chunk when needed.
+func (cw *chunkWriter) write(ctx context.Context) func(doc map[string]interface{}) error {
+	return func(doc map[string]interface{}) error {
+		if cw.w == nil {
+			if err := cw.open(ctx); err != nil {
+				return err
+			}
+		}
+		if err := cw.enc.encode(doc); err != nil {
+			return fmt.Errorf("failed to write chunk %s: %v", cw.chunk.Name, err)
+		}
+		cw.chunk.Docs++
+		if cw.chunkSize > 0 && cw.chunk.Docs >= int64(cw.chunkSize) {
+			if err := cw.close(); err != nil {
+				return err
+			}
+		}
+		if cw.maxDocs > 0 && cw.docs() >= cw.maxDocs {
+			return errMaxDocs
+		}
+		return nil
+	}
+}
+
+// docs returns the number of documents written so far.
+func (cw *chunkWriter) docs() int64 {
+	if cw.w == nil {
+		return cw.dump.NumDocs
+	}
+	return cw.dump.NumDocs + cw.chunk.Docs
+}
+
+func (cw *chunkWriter) open(ctx context.Context) error {
+	cw.chunk = model.ChunkManifest{
+		Name: fmt.Sprintf("chunk-%05d.%s", len(cw.dump.Chunks), cw.dump.Format),
+	}
+	// parquet compresses its pages, the file itself isn't compressed
+	if cw.dump.Format != FormatParquet && cw.dump.Compression != CompressionNone {
+		cw.chunk.Name += compressionExt(cw.dump.Compression)
+		cw.chunk.Compression = cw.dump.Compression
+	}
+	// cancelling the context discards a chunk that isn't complete
+	wctx, cancel := context.WithCancel(ctx)
+	w, err := cw.bl.NewWriter(wctx, path.Join(cw.dump.Path, cw.chunk.Name))
+	if err != nil {
+		cancel()
+		return fmt.Errorf("failed to create chunk %s: %v", cw.chunk.Name, err)
+	}
+	cw.cancel = cancel
+	cw.w = w
+	cw.sum = sha256.New()
+	cw.cnt = &countingWriter{w: io.MultiWriter(w, cw.sum)}
+	cw.zw, err = newCompressor(cw.cnt, cw.chunk.Compression, cw.dump.CompressionLevel)
+	if err != nil {
+		cw.abort()
+		return err
+	}
+	cw.enc, err = newDocEncoder(cw.dump, cw.zw, cw.schema)
+	if err != nil {
+		cw.abort()
+		return err
+	}
+	return nil
+}
+
+// close completes the current chunk, if any.
+func (cw *chunkWriter) close() error {
+	if cw.w == nil {
+		return nil
+	}
+	err := cw.enc.close()
+	if err == nil {
+		err = cw.zw.Close()
+	}
+	if err != nil {
+		cw.abort()
+		return fmt.Errorf("failed to write chunk %s: %v", cw.chunk.Name, err)
+	}
+	err = cw.w.Close()
+	cw.cancel()
+	cw.w = nil
+	if err != nil {
+		return fmt.Errorf("failed to write chunk %s: %v", cw.chunk.Name, err)
+	}
+	cw.chunk.Size = cw.cnt.n
+	cw.chunk.SHA256 = hex.EncodeToString(cw.sum.Sum(nil))
+	cw.dump.Chunks = append(cw.dump.Chunks, cw.chunk)
+	cw.dump.NumDocs += cw.chunk.Docs
+	return nil
+}
+
+// abort discards the current chunk, if any.
+func (cw *chunkWriter) abort() {
+	if cw.w == nil {
+		return
+	}
+	cw.cancel()
+	_ = cw.w.Close()
+	cw.w = nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// resetLogical prepares the collections of a resumed logical dump or import. A dump or import that
+// was interrupted can't be continued, it is started over. Importing documents again overwrites them.
+func resetLogical(state *model.Report) {
+	for _, cr := range state.Collections {
+		if cr.Status == model.CollectionSubmitted || cr.Status == model.CollectionTimedOut {
+			cr.Status = model.CollectionPending
+			cr.EndTime = nil
+			cr.Error = ""
+			if state.Action == "backup" {
+				cr.Dump = nil
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package solr_dump
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// selectSolr serves the unique key and cursor paging of collection c1, which holds n documents. The
+// cursor mark is the number of documents read so far.
+func selectSolr(t *testing.T, n int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := map[string]interface{}{"status": 0}
+		switch r.URL.Path {
+		case "/solr/c1/schema/uniquekey":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"responseHeader": header, "uniqueKey": "id"})
+		case "/solr/c1/select":
+			rows, _ := strconv.Atoi(r.URL.Query().Get("rows"))
+			start := 0
+			if cursor := r.URL.Query().Get("cursorMark"); cursor != "" && cursor != "*" {
+				start, _ = strconv.Atoi(cursor)
+			}
+			docs := []map[string]interface{}{}
+			for i := start; i < n && i < start+rows; i++ {
+				docs = append(docs, map[string]interface{}{"id": fmt.Sprintf("doc-%d", i)})
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"responseHeader": header,
+				"response":       map[string]interface{}{"numFound": n, "start": 0, "docs": docs},
+				"nextCursorMark": strconv.Itoa(start + len(docs)),
+			})
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+func TestDumpDocumentsMaxDocs(t *testing.T) {
+	tests := map[string]struct {
+		maxDocs int64
+		numDocs int64
+		partial bool
+	}{
+		"no limit":           {maxDocs: 0, numDocs: 5},
+		"limit above count":  {maxDocs: 10, numDocs: 5},
+		"limit equals count": {maxDocs: 5, numDocs: 5},
+		"limit below count":  {maxDocs: 3, numDocs: 3, partial: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dumper := newTestDumper(t, selectSolr(t, 5))
+			dumper.streamClient = newStreamClient(dumper.slClient.Client)
+			dumper.bl = newTestBlob(t)
+			dumper.logical = DefaultLogicalOptions()
+			dumper.logical.BatchSize = 2
+			dumper.logical.Filter.MaxDocs = test.maxDocs
+			dumper.compression = CompressionOptions{Codec: CompressionNone}
+
+			dump, err := dumper.dumpDocuments(context.Background(), "c1", "c1-dump/c1/run1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dump.NumDocs != test.numDocs {
+				t.Errorf("dumped %d documents, want %d", dump.NumDocs, test.numDocs)
+			}
+			if dump.Partial != test.partial {
+				t.Errorf("partial = %v, want %v", dump.Partial, test.partial)
+			}
+		})
+	}
+}
@@ -0,0 +1,319 @@
+package solr_dump
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pritamdas99/solr-dump/model"
+	v "gomodules.xyz/x/version"
+	"k8s.io/klog/v2"
+)
+
+const manifestFile = "manifest.json"
+
+func manifestPath(runId string) string {
+	return path.Join(runDir(runId), manifestFile)
+}
+
+// describeCollection records the layout and document count of collection right before it is backed up.
+func (dumper *SolrDump) describeCollection(ctx context.Context, collection string) *model.CollectionManifest {
+	cm := &model.CollectionManifest{Name: collection}
+
+	status, err := dumper.clusterStatus(ctx, collection)
+	if err != nil {
+		klog.Warningf("failed to get layout of collection %s: %v", collection, err)
+	} else {
+		cm.ConfigName, _ = status["configName"].(string)
+		if router, ok := status["router"].(map[string]interface{}); ok {
+			cm.Router, _ = router["name"].(string)
+		}
+		cm.ReplicationFactor = toInt(status["replicationFactor"])
+		shards, _ := status["shards"].(map[string]interface{})
+		for name, s := range shards {
+			shard, _ := s.(map[string]interface{})
+			sm := model.ShardManifest{Name: name}
+			sm.Range, _ = shard["range"].(string)
+			replicas, _ := shard["replicas"].(map[string]interface{})
+			for replicaName, r := range replicas {
+				replica, _ := r.(map[string]interface{})
+				rm := model.ReplicaManifest{Name: replicaName}
+				rm.Core, _ = replica["core"].(string)
+				rm.Node, _ = replica["node_name"].(string)
+				rm.Type, _ = replica["type"].(string)
+				sm.Replicas = append(sm.Replicas, rm)
+			}
+			sort.Slice(sm.Replicas, func(i, j int) bool {
+				return sm.Replicas[i].Name < sm.Replicas[j].Name
+			})
+			cm.Shards = append(cm.Shards, sm)
+		}
+		sort.Slice(cm.Shards, func(i, j int) bool {
+			return cm.Shards[i].Name < cm.Shards[j].Name
+		})
+		cm.CreateParams = createParams(status, len(shards))
+	}
+
+	if n, err := dumper.numDocs(ctx, collection); err != nil {
+		klog.Warningf("failed to count documents of collection %s: %v", collection, err)
+	} else {
+		cm.NumDocs = &n
+	}
+
+	if dumper.sampleSize > 0 {
+		if err := dumper.sampleDocuments(ctx, cm); err != nil {
+			klog.Warningf("failed to sample documents of collection %s: %v", collection, err)
+		}
+	}
+	return cm
+}
+
+// createParams returns the CREATE parameters of a collection from its CLUSTERSTATUS entry.
+func createParams(status map[string]interface{}, numShards int) map[string]string {
+	params := map[string]string{
+		"numShards": strconv.Itoa(numShards),
+	}
+	if configName, ok := status["configName"].(string); ok {
+		params["collection.configName"] = configName
+	}
+	if router, ok := status["router"].(map[string]interface{}); ok {
+		for _, key := range []string{"name", "field"} {
+			if value, ok := router[key].(string); ok {
+				params["router."+key] = value
+			}
+		}
+	}
+	for _, key := range []string{"replicationFactor", "nrtReplicas", "tlogReplicas", "pullReplicas", "maxShardsPerNode", "perReplicaState"} {
+		if value, ok := status[key]; ok && value != nil {
+			params[key] = fmt.Sprint(value)
+		}
+	}
+	return params
+}
+
+// sampleDocuments records the hashes of the first dumper.sampleSize documents of the collection.
+func (dumper *SolrDump) sampleDocuments(ctx context.Context, cm *model.CollectionManifest) error {
+	key, err := dumper.uniqueKey(ctx, cm.Name)
+	if err != nil {
+		return err
+	}
+	docs, err := dumper.selectDocuments(ctx, cm.Name, "*:*", dumper.sampleSize)
+	if err != nil {
+		return err
+	}
+	cm.UniqueKey = key
+	for _, doc := range docs {
+		id := fmt.Sprint(doc[key])
+		hash, err := docHash(doc)
+		if err != nil {
+			return err
+		}
+		cm.Sample = append(cm.Sample, model.DocSample{ID: id, Hash: hash})
+	}
+	return nil
+}
+
+// docHash returns the sha256 of the stored fields of doc without _version_, which solr
+// assigns on every update. The fields are hashed in sorted order.
+func docHash(doc map[string]interface{}) (string, error) {
+	fields := make(map[string]interface{}, len(doc))
+	for name, value := range doc {
+		if name != "_version_" {
+			fields[name] = value
+		}
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// writeManifest writes the manifest of the finished backup run to the backup storage.
+func (dumper *SolrDump) writeManifest(ctx context.Context) error {
+	if dumper.bl == nil {
+		klog.Warning("no backup storage is configured, the backup manifest is not written")
+		return nil
+	}
+	r := dumper.report
+	m := &model.Manifest{
+		RunId:       r.RunId,
+		ToolVersion: v.Version.Version,
+		Mode:        r.Mode,
+		Encryption:  encryption(dumper.keys),
+		Cluster:     dumper.cluster,
+		StartTime:   r.StartTime,
+		EndTime:     time.Now().UTC(),
+		Collections: []model.CollectionManifest{},
+	}
+	if m.Cluster.SolrVersion == "" {
+		if version, err := dumper.solrVersion(ctx); err != nil {
+			klog.Warningf("failed to get solr version: %v", err)
+		} else {
+			m.Cluster.SolrVersion = version
+		}
+	}
+
+	for _, cr := range r.Collections {
+		cm := model.CollectionManifest{Name: cr.Collection}
+		if cr.Description != nil {
+			cm = *cr.Description
+		}
+		cm.BackupName = cr.BackupName
+		cm.BackupId = cr.BackupId
+		cm.AsyncId = cr.AsyncId
+		cm.Status = cr.Status
+		cm.StartTime = cr.StartTime
+		cm.EndTime = cr.EndTime
+		cm.Dump = cr.Dump
+		if cr.Status == model.CollectionCompleted && r.Mode != model.ModeLogical && cr.BackupId == nil {
+			klog.Warningf("backup id of collection %s is unknown, it isn't recorded in the manifest", cr.Collection)
+		}
+		m.Collections = append(m.Collections, cm)
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dumper.compression.Metadata {
+		if data, err = compressBytes(data, dumper.compression.codec(), dumper.compression.Level); err != nil {
+			return err
+		}
+	}
+	if err := putWithChecksum(ctx, dumper.bl, manifestPath(m.RunId), data); err != nil {
+		return fmt.Errorf("failed to write manifest of run %s: %v", m.RunId, err)
+	}
+	klog.Infof("wrote manifest %s", manifestPath(m.RunId))
+	return nil
+}
+
+// describeSubmitted records the description of the collection of cr and the backup points stored
+// for it before its backup is submitted.
+func (dumper *SolrDump) describeSubmitted(ctx context.Context, cr *model.CollectionReport) {
+	cm := dumper.describeCollection(ctx, cr.Collection)
+	var prior []int
+	if dumper.bl != nil {
+		ids, err := backupIds(ctx, dumper.bl, cr.BackupName, cr.Collection)
+		if err != nil {
+			klog.Warningf("failed to list backup points of collection %s: %v", cr.Collection, err)
+		}
+		prior = ids
+	}
+	dumper.mu.Lock()
+	defer dumper.mu.Unlock()
+	cr.Description = cm
+	cr.PriorBackupIds = prior
+}
+
+// recordBackupId records the id of the backup point created by the completed backup of cr. Solr
+// reports it in the status of incremental backups, otherwise it is the one backup point that
+// wasn't stored before the backup was submitted.
+func (dumper *SolrDump) recordBackupId(ctx context.Context, cr *model.CollectionReport, responseBody map[string]interface{}) {
+	id, ok := statusBackupId(responseBody)
+	if !ok && dumper.bl != nil {
+		ids, err := backupIds(ctx, dumper.bl, cr.BackupName, cr.Collection)
+		if err != nil {
+			klog.Warningf("failed to list backup points of collection %s: %v", cr.Collection, err)
+			return
+		}
+		prior := map[int]bool{}
+		for _, id := range cr.PriorBackupIds {
+			prior[id] = true
+		}
+		var created []int
+		for _, id := range ids {
+			if !prior[id] {
+				created = append(created, id)
+			}
+		}
+		if len(created) != 1 {
+			klog.Warningf("found %d new backup points of collection %s in %s, can't tell which one the backup created", len(created), cr.Collection, path.Join(cr.BackupName, cr.Collection))
+			return
+		}
+		id, ok = created[0], true
+	}
+	if !ok {
+		return
+	}
+	dumper.mu.Lock()
+	defer dumper.mu.Unlock()
+	cr.BackupId = &id
+}
+
+// statusBackupId returns the backupId in the response of the status of a completed backup.
+func statusBackupId(responseBody map[string]interface{}) (int, bool) {
+	response, ok := responseBody["response"].(map[string]interface{})
+	if !ok {
+		return 0, false
+	}
+	id, ok := response["backupId"].(float64)
+	if !ok {
+		return 0, false
+	}
+	return int(id), true
+}
+
+// backupIds returns the ids of the backup points in <backupName>/<collection>/.
+func backupIds(ctx context.Context, bl model.Blob, backupName string, collection string) ([]int, error) {
+	objects, err := bl.List(ctx, path.Join(backupName, collection))
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, obj := range objects {
+		match := backupPropertiesRegex.FindStringSubmatch(path.Base(obj))
+		if match == nil {
+			continue
+		}
+		if id, err := strconv.Atoi(match[1]); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// ReadManifest reads the manifest of backup run runId and checks it against its recorded sha256.
+func ReadManifest(ctx context.Context, bl model.Blob, runId string) (*model.Manifest, error) {
+	data, err := getWithChecksum(ctx, bl, manifestPath(runId))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest of run %s: %v", runId, err)
+	}
+	if data, err = decompressBytes(data); err != nil {
+		return nil, fmt.Errorf("failed to decompress manifest of run %s: %v", runId, err)
+	}
+	m := &model.Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest of run %s: %v", runId, err)
+	}
+	return m, nil
+}
+
+// isManifestPath reports whether filepath is .solrdump/runs/<runId>/manifest.json and returns the run id.
+func isManifestPath(filepath string) (string, bool) {
+	part := strings.Split(strings.Trim(filepath, "/"), "/")
+	if len(part) == 4 && part[0] == model.MetadataDir && part[1] == "runs" && part[3] == manifestFile {
+		return part[2], true
+	}
+	return "", false
+}
+
+func toInt(value interface{}) int {
+	switch val := value.(type) {
+	case float64:
+		return int(val)
+	case string:
+		n, _ := strconv.Atoi(val)
+		return n
+	}
+	return 0
+}
@@ -0,0 +1,67 @@
+package solr_dump
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pritamdas99/solr-dump/model"
+)
+
+func TestRecordBackupId(t *testing.T) {
+	taken := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := map[string]struct {
+		status map[string]interface{}
+		prior  []int
+		stored []int
+		want   *int
+	}{
+		"reported by solr": {
+			status: map[string]interface{}{"response": map[string]interface{}{"backupId": float64(3)}},
+			prior:  []int{0, 1},
+			stored: []int{0, 1, 2, 3},
+			want:   intPtr(3),
+		},
+		"new backup point": {
+			status: map[string]interface{}{},
+			prior:  []int{0, 1, 2},
+			stored: []int{0, 1, 2, 3},
+			want:   intPtr(3),
+		},
+		"first backup point": {
+			status: map[string]interface{}{},
+			stored: []int{0},
+			want:   intPtr(0),
+		},
+		// another backup of the collection completed meanwhile
+		"several new backup points": {
+			status: map[string]interface{}{},
+			prior:  []int{0},
+			stored: []int{0, 1, 2},
+		},
+		"no new backup point": {
+			status: map[string]interface{}{},
+			prior:  []int{0, 1},
+			stored: []int{0, 1},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			bl := newTestBlob(t)
+			for _, id := range test.stored {
+				putBackupPoint(t, bl, "c1-backup", "c1", id, taken)
+			}
+			dumper := &SolrDump{bl: bl, report: newReport("backup", "run1")}
+			cr := &model.CollectionReport{Collection: "c1", BackupName: "c1-backup", PriorBackupIds: test.prior}
+			dumper.recordBackupId(context.Background(), cr, test.status)
+			switch {
+			case test.want == nil && cr.BackupId != nil:
+				t.Errorf("recorded backup id %d, want none", *cr.BackupId)
+			case test.want != nil && cr.BackupId == nil:
+				t.Errorf("recorded no backup id, want %d", *test.want)
+			case test.want != nil && *cr.BackupId != *test.want:
+				t.Errorf("recorded backup id %d, want %d", *cr.BackupId, *test.want)
+			}
+		})
+	}
+}
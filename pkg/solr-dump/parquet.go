@@ -0,0 +1,208 @@
+package solr_dump
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+
+	kzstd "github.com/klauspost/compress/zstd"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+	"github.com/parquet-go/parquet-go/compress/gzip"
+	"github.com/parquet-go/parquet-go/compress/lz4"
+	"github.com/parquet-go/parquet-go/compress/uncompressed"
+	"github.com/parquet-go/parquet-go/compress/zstd"
+	"github.com/parquet-go/parquet-go/encoding"
+	"github.com/pritamdas99/solr-dump/model"
+)
+
+// Parquet chunks are written with parquet-go. Every column is optional, multivalued fields are written
+// as json strings and dates as timestamps in milliseconds. Pages are compressed with the codec of the dump.
+
+// parquetRowGroupSize is the number of documents of a row group. The writer buffers a row group in
+// memory, the documents of a chunk are split into several row groups to bound it.
+const parquetRowGroupSize = 10000
+
+// parquetCodec returns the page compression codec of compression at level, 0 being the default level.
+// lz4 pages are raw lz4 blocks, not frames.
+func parquetCodec(compression string, level int) (compress.Codec, error) {
+	switch compression {
+	case CompressionNone:
+		return &uncompressed.Codec{}, nil
+	case CompressionGzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return &gzip.Codec{Level: level}, nil
+	case CompressionZstd:
+		if level == 0 {
+			level = 3
+		}
+		return &zstd.Codec{Level: kzstd.EncoderLevelFromZstd(level)}, nil
+	case CompressionLZ4:
+		return &lz4.Codec{Level: lz4Level(level)}, nil
+	}
+	return nil, fmt.Errorf("compression %s isn't supported by parquet", compression)
+}
+
+// parquetNode returns the parquet type of the column of field.
+func parquetNode(field model.DumpField) parquet.Node {
+	switch {
+	case field.MultiValued:
+		return parquet.JSON()
+	case field.Type == columnInt32:
+		return parquet.Leaf(parquet.Int32Type)
+	case field.Type == columnInt64:
+		return parquet.Leaf(parquet.Int64Type)
+	case field.Type == columnFloat:
+		return parquet.Leaf(parquet.FloatType)
+	case field.Type == columnDouble:
+		return parquet.Leaf(parquet.DoubleType)
+	case field.Type == columnBoolean:
+		return parquet.Leaf(parquet.BooleanType)
+	case field.Type == columnTimestamp:
+		return parquet.Timestamp(parquet.Millisecond)
+	}
+	return parquet.String()
+}
+
+// parquetGroup is the root of the parquet schema of a dump. Unlike parquet.Group, which sorts its
+// fields by name, it keeps the columns in the order of the dump schema.
+type parquetGroup []parquet.Field
+
+func (g parquetGroup) ID() int                     { return 0 }
+func (g parquetGroup) String() string              { return parquet.NewSchema("", g).String() }
+func (g parquetGroup) Type() parquet.Type          { return parquet.Group{}.Type() }
+func (g parquetGroup) Optional() bool              { return false }
+func (g parquetGroup) Repeated() bool              { return false }
+func (g parquetGroup) Required() bool              { return true }
+func (g parquetGroup) Leaf() bool                  { return false }
+func (g parquetGroup) Fields() []parquet.Field     { return g }
+func (g parquetGroup) Encoding() encoding.Encoding { return nil }
+func (g parquetGroup) Compression() compress.Codec { return nil }
+func (g parquetGroup) GoType() reflect.Type        { return reflect.TypeOf(map[string]interface{}{}) }
+
+type parquetField struct {
+	parquet.Node
+	name string
+}
+
+func (f *parquetField) Name() string { return f.name }
+
+func (f *parquetField) Value(base reflect.Value) reflect.Value {
+	return base.MapIndex(reflect.ValueOf(f.name))
+}
+
+type parquetEncoder struct {
+	w      *parquet.Writer
+	fields []model.DumpField
+	row    parquet.Row
+}
+
+func newParquetEncoder(w io.Writer, schema *model.DumpSchema, compression string, level int) (*parquetEncoder, error) {
+	codec, err := parquetCodec(compression, level)
+	if err != nil {
+		return nil, err
+	}
+	root := make(parquetGroup, 0, len(schema.Fields))
+	for _, field := range schema.Fields {
+		root = append(root, &parquetField{Node: parquet.Optional(parquetNode(field)), name: field.Name})
+	}
+
+	config := parquet.DefaultWriterConfig()
+	config.Schema = parquet.NewSchema("schema", root)
+	config.Compression = codec
+	config.CreatedBy = "solr-dump"
+	config.MaxRowsPerRowGroup = parquetRowGroupSize
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &parquetEncoder{w: parquet.NewWriter(w, config), fields: schema.Fields}, nil
+}
+
+func (e *parquetEncoder) encode(doc map[string]interface{}) error {
+	e.row = e.row[:0]
+	for i, field := range e.fields {
+		v, err := parquetValue(field, doc[field.Name])
+		if err != nil {
+			return fmt.Errorf("failed to write field %s: %v", field.Name, err)
+		}
+		// the columns are optional, only values that are set are defined
+		definition := 1
+		if v.IsNull() {
+			definition = 0
+		}
+		e.row = append(e.row, v.Level(0, definition, i))
+	}
+	_, err := e.w.WriteRows([]parquet.Row{e.row})
+	return err
+}
+
+// parquetValue converts a value of field to the value of its column, nil values are null.
+func parquetValue(field model.DumpField, value interface{}) (parquet.Value, error) {
+	if value == nil {
+		return parquet.NullValue(), nil
+	}
+	var v parquet.Value
+	switch {
+	case field.MultiValued:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return v, err
+		}
+		v = parquet.ByteArrayValue(data)
+	case field.Type == columnInt32:
+		n, err := toInt64(value)
+		if err != nil {
+			return v, err
+		}
+		if n < math.MinInt32 || n > math.MaxInt32 {
+			return v, fmt.Errorf("%d overflows int32", n)
+		}
+		v = parquet.Int32Value(int32(n))
+	case field.Type == columnInt64, field.Type == columnTimestamp:
+		convert := toInt64
+		if field.Type == columnTimestamp {
+			convert = toMillis
+		}
+		n, err := convert(value)
+		if err != nil {
+			return v, err
+		}
+		v = parquet.Int64Value(n)
+	case field.Type == columnFloat, field.Type == columnDouble:
+		f, err := toFloat64(value)
+		if err != nil {
+			return v, err
+		}
+		if field.Type == columnFloat {
+			v = parquet.FloatValue(float32(f))
+		} else {
+			v = parquet.DoubleValue(f)
+		}
+	case field.Type == columnBoolean:
+		b, ok := value.(bool)
+		if !ok {
+			return v, fmt.Errorf("%v isn't a boolean", value)
+		}
+		v = parquet.BooleanValue(b)
+	default:
+		s, ok := value.(string)
+		if !ok {
+			data, err := json.Marshal(value)
+			if err != nil {
+				return v, err
+			}
+			s = string(data)
+		}
+		v = parquet.ByteArrayValue([]byte(s))
+	}
+	return v, nil
+}
+
+// close flushes the buffered row group and writes the file metadata.
+func (e *parquetEncoder) close() error {
+	return e.w.Close()
+}
@@ -0,0 +1,290 @@
+package solr_dump
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/deprecated"
+	"github.com/parquet-go/parquet-go/format"
+	"github.com/pritamdas99/solr-dump/model"
+)
+
+var parquetTestSchema = &model.DumpSchema{
+	Collection: "c1",
+	UniqueKey:  "id",
+	Fields: []model.DumpField{
+		{Name: "id", Type: columnString},
+		{Name: "count", Type: columnInt32},
+		{Name: "size", Type: columnInt64},
+		{Name: "ratio", Type: columnFloat},
+		{Name: "score", Type: columnDouble},
+		{Name: "active", Type: columnBoolean},
+		{Name: "created", Type: columnTimestamp},
+		{Name: "tags", Type: columnString, MultiValued: true},
+		{Name: "never", Type: columnInt64},
+	},
+}
+
+var parquetEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// parquetTestDocs returns n documents as they are read from solr. Every field but the unique key is
+// missing from some of them, in runs of different lengths.
+func parquetTestDocs(n int) []map[string]interface{} {
+	var docs []map[string]interface{}
+	for i := 0; i < n; i++ {
+		doc := map[string]interface{}{"id": fmt.Sprintf("doc-%d", i)}
+		if i%3 != 0 {
+			doc["count"] = json.Number(fmt.Sprint(i - 10))
+		}
+		if i < n/2 {
+			doc["size"] = json.Number(fmt.Sprint(int64(i) << 40))
+		}
+		if i%2 == 0 {
+			doc["ratio"] = json.Number(fmt.Sprint(float32(i) / 4))
+			doc["score"] = json.Number(fmt.Sprint(float64(i) / 3))
+		}
+		if i%5 != 4 {
+			// more than 8 booleans, so that they span several bytes
+			doc["active"] = i%7 < 3
+		}
+		if i%4 != 1 {
+			doc["created"] = parquetEpoch.Add(time.Duration(i) * 1500 * time.Millisecond).Format(time.RFC3339Nano)
+		}
+		switch i % 3 {
+		case 0:
+			doc["tags"] = []interface{}{"a", fmt.Sprintf("tag %d", i)}
+		case 1:
+			doc["tags"] = []interface{}{}
+		}
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+func encodeParquet(t *testing.T, docs []map[string]interface{}, compression string, level int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	e, err := newParquetEncoder(&buf, parquetTestSchema, compression, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, doc := range docs {
+		if err := e.encode(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// wantParquetValue returns the value of a field the way it is expected to be read from the parquet file.
+func wantParquetValue(field model.DumpField, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	if field.MultiValued {
+		data, _ := json.Marshal(value)
+		return string(data)
+	}
+	switch field.Type {
+	case columnInt32:
+		n, _ := toInt64(value)
+		return int32(n)
+	case columnInt64:
+		n, _ := toInt64(value)
+		return n
+	case columnFloat:
+		f, _ := toFloat64(value)
+		return float32(f)
+	case columnDouble:
+		f, _ := toFloat64(value)
+		return f
+	case columnTimestamp:
+		n, _ := toMillis(value)
+		return n
+	}
+	return value
+}
+
+// readValue returns the value of v as the go type of its parquet type.
+func readValue(v parquet.Value) interface{} {
+	if v.IsNull() {
+		return nil
+	}
+	switch v.Kind() {
+	case parquet.Boolean:
+		return v.Boolean()
+	case parquet.Int32:
+		return v.Int32()
+	case parquet.Int64:
+		return v.Int64()
+	case parquet.Float:
+		return v.Float()
+	case parquet.Double:
+		return v.Double()
+	case parquet.ByteArray:
+		return string(v.ByteArray())
+	}
+	return fmt.Sprintf("unexpected kind %s", v.Kind())
+}
+
+func TestParquetEncoder(t *testing.T) {
+	codecs := map[string]format.CompressionCodec{
+		CompressionNone: format.Uncompressed,
+		CompressionGzip: format.Gzip,
+		CompressionZstd: format.Zstd,
+		CompressionLZ4:  format.Lz4Raw,
+	}
+	for compression, codec := range codecs {
+		for _, n := range []int{0, 1, 100, parquetRowGroupSize + 1} {
+			t.Run(fmt.Sprintf("%s/%d", compression, n), func(t *testing.T) {
+				docs := parquetTestDocs(n)
+				data := encodeParquet(t, docs, compression, 0)
+
+				f, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if f.NumRows() != int64(n) {
+					t.Errorf("file has %d rows, want %d", f.NumRows(), n)
+				}
+				meta := f.Metadata()
+				if meta.CreatedBy != "solr-dump" {
+					t.Errorf("file was created by %q", meta.CreatedBy)
+				}
+				checkParquetSchema(t, meta.Schema)
+				if want := (n + parquetRowGroupSize - 1) / parquetRowGroupSize; len(meta.RowGroups) != want {
+					t.Errorf("file has %d row groups, want %d", len(meta.RowGroups), want)
+				}
+				for _, rg := range meta.RowGroups {
+					for _, cc := range rg.Columns {
+						if cc.MetaData.Codec != codec {
+							t.Errorf("column %v is compressed with %s, want %s", cc.MetaData.PathInSchema, cc.MetaData.Codec, codec)
+						}
+					}
+				}
+
+				rows := readParquetRows(t, data, n)
+				columns := f.Schema().Fields()
+				for i, row := range rows {
+					for _, v := range row {
+						field := parquetTestSchema.Fields[v.Column()]
+						if columns[v.Column()].Name() != field.Name {
+							t.Fatalf("column %d is %s, want %s", v.Column(), columns[v.Column()].Name(), field.Name)
+						}
+						want := wantParquetValue(field, docs[i][field.Name])
+						if got := readValue(v); got != want {
+							t.Errorf("row %d: %s = %#v, want %#v", i, field.Name, got, want)
+						}
+						if wantLevel := map[bool]int{true: 0, false: 1}[want == nil]; v.DefinitionLevel() != wantLevel {
+							t.Errorf("row %d: %s has definition level %d, want %d", i, field.Name, v.DefinitionLevel(), wantLevel)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+// readParquetRows reads the rows of every row group of a parquet file, which must have n rows.
+func readParquetRows(t *testing.T, data []byte, n int) []parquet.Row {
+	t.Helper()
+	rows := make([]parquet.Row, n+1)
+	r := parquet.NewReader(bytes.NewReader(data))
+	read := 0
+	for read < len(rows) {
+		m, err := r.ReadRows(rows[read:])
+		read += m
+		if err != nil {
+			break
+		}
+	}
+	if read != n {
+		t.Fatalf("read %d rows, want %d", read, n)
+	}
+	return rows[:n]
+}
+
+func checkParquetSchema(t *testing.T, schema []format.SchemaElement) {
+	t.Helper()
+	if len(schema) != len(parquetTestSchema.Fields)+1 {
+		t.Fatalf("schema has %d elements, want the root and %d columns", len(schema), len(parquetTestSchema.Fields))
+	}
+	want := map[string]struct {
+		typ       format.Type
+		converted deprecated.ConvertedType
+	}{
+		"id":      {format.ByteArray, deprecated.UTF8},
+		"count":   {format.Int32, -1},
+		"size":    {format.Int64, -1},
+		"ratio":   {format.Float, -1},
+		"score":   {format.Double, -1},
+		"active":  {format.Boolean, -1},
+		"created": {format.Int64, deprecated.TimestampMillis},
+		"tags":    {format.ByteArray, deprecated.Json},
+		"never":   {format.Int64, -1},
+	}
+	for i, se := range schema[1:] {
+		w := want[se.Name]
+		if se.Name != parquetTestSchema.Fields[i].Name || se.Type == nil || *se.Type != w.typ {
+			t.Errorf("column %d is %s of type %v, want %s of type %s", i, se.Name, se.Type, parquetTestSchema.Fields[i].Name, w.typ)
+		}
+		if se.RepetitionType == nil || *se.RepetitionType != format.Optional {
+			t.Errorf("column %s isn't optional", se.Name)
+		}
+		converted := deprecated.ConvertedType(-1)
+		if se.ConvertedType != nil {
+			converted = *se.ConvertedType
+		}
+		if converted != w.converted {
+			t.Errorf("column %s has converted type %v, want %v", se.Name, converted, w.converted)
+		}
+	}
+}
+
+func TestParquetEncoderLevels(t *testing.T) {
+	docs := parquetTestDocs(1000)
+	for compression := range codecs {
+		for _, level := range []int{1, codecs[compression].maxLevel} {
+			t.Run(fmt.Sprintf("%s/%d", compression, level), func(t *testing.T) {
+				data := encodeParquet(t, docs, compression, level)
+				rows := readParquetRows(t, data, len(docs))
+				if got := string(rows[len(docs)-1][0].ByteArray()); got != docs[len(docs)-1]["id"] {
+					t.Errorf("last row has id %s", got)
+				}
+			})
+		}
+	}
+}
+
+func TestParquetEncoderErrors(t *testing.T) {
+	if _, err := newParquetEncoder(&bytes.Buffer{}, parquetTestSchema, "brotli", 0); err == nil {
+		t.Error("encoder accepted an unsupported compression")
+	}
+	tests := map[string]map[string]interface{}{
+		"int32 overflow":     {"count": json.Number("2147483648")},
+		"fraction":           {"size": json.Number("1.5")},
+		"not a number":       {"score": "high"},
+		"not a boolean":      {"active": "yes"},
+		"not a date":         {"created": "yesterday"},
+		"date of wrong type": {"created": json.Number("1")},
+	}
+	for name, doc := range tests {
+		t.Run(name, func(t *testing.T) {
+			e, err := newParquetEncoder(&bytes.Buffer{}, parquetTestSchema, CompressionNone, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := e.encode(doc); err == nil || !strings.Contains(err.Error(), "failed to write field") {
+				t.Errorf("got error %v, want the field that failed", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package solr_dump
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseProperties(t *testing.T) {
+	tests := map[string]struct {
+		data string
+		want map[string]string
+	}{
+		"solr backup": {
+			data: "#Backup properties file\n#Mon Jan 01 00:00:00 UTC 2024\n" +
+				"startTime=2024-01-01T00\\:00\\:00.123Z\nindexFileCount=12\nindexSizeMB=0.5\nsolrVersion=9.4.0\n",
+			want: map[string]string{
+				"startTime":      "2024-01-01T00:00:00.123Z",
+				"indexFileCount": "12",
+				"indexSizeMB":    "0.5",
+				"solrVersion":    "9.4.0",
+			},
+		},
+		"comments and blank lines": {
+			data: "! comment\n  # indented comment\n\n\t\na=1\n",
+			want: map[string]string{"a": "1"},
+		},
+		"separators": {
+			data: "a=1\nb:2\nc 3\nd = 4\ne : 5\nf\t\t6\ng\nh=\n",
+			want: map[string]string{"a": "1", "b": "2", "c": "3", "d": "4", "e": "5", "f": "6", "g": "", "h": ""},
+		},
+		"escapes": {
+			data: "key\\ with\\=separators=value\\twith\\nescapes\\\\\nc\\:d=e=f\n",
+			want: map[string]string{"key with=separators": "value\twith\nescapes\\", "c:d": "e=f"},
+		},
+		"continuation lines": {
+			data: "list=a,\\\n    b,\\\n\tc\nnext=1\n",
+			want: map[string]string{"list": "a,b,c", "next": "1"},
+		},
+		"escaped backslash at the end": {
+			data: "path=c:\\\\\nnext=1\n",
+			want: map[string]string{"path": "c:\\", "next": "1"},
+		},
+		"empty": {
+			data: "",
+			want: map[string]string{},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := parseProperties([]byte(test.data)); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
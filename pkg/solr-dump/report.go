@@ -0,0 +1,111 @@
+package solr_dump
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pritamdas99/solr-dump/model"
+	"k8s.io/klog/v2"
+)
+
+func newReport(action string, runId string) *model.Report {
+	return &model.Report{
+		RunId:       runId,
+		Action:      action,
+		StartTime:   time.Now().UTC(),
+		Collections: []*model.CollectionReport{},
+	}
+}
+
+// collectionReport returns the report of collection, adding it as pending if it isn't part of the run yet.
+// Once workers are running it must only be called with dumper.mu held.
+func (dumper *SolrDump) collectionReport(collection string) *model.CollectionReport {
+	for _, cr := range dumper.report.Collections {
+		if cr.Collection == collection {
+			return cr
+		}
+	}
+	cr := &model.CollectionReport{
+		Collection: collection,
+		Status:     model.CollectionPending,
+	}
+	dumper.report.Collections = append(dumper.report.Collections, cr)
+	return cr
+}
+
+func (dumper *SolrDump) markSubmitted(collection string, source string, backupName string, asyncId string) {
+	dumper.mu.Lock()
+	defer dumper.mu.Unlock()
+	cr := dumper.collectionReport(collection)
+	now := time.Now().UTC()
+	cr.Source = source
+	cr.BackupName = backupName
+	cr.AsyncId = asyncId
+	cr.Status = model.CollectionSubmitted
+	cr.StartTime = &now
+}
+
+func (dumper *SolrDump) markDone(collection string, status model.CollectionStatus, err error) {
+	dumper.mu.Lock()
+	defer dumper.mu.Unlock()
+	cr := dumper.collectionReport(collection)
+	now := time.Now().UTC()
+	cr.Status = status
+	cr.EndTime = &now
+	if err != nil {
+		cr.Error = err.Error()
+	}
+}
+
+// finishReport sets the overall status of the run. The run succeeded if every collection
+// completed, failed if none did and partially failed otherwise.
+func (dumper *SolrDump) finishReport(err error) error {
+	r := dumper.report
+	r.EndTime = time.Now().UTC()
+	if err != nil {
+		r.Error = err.Error()
+	}
+	defer dumper.saveState()
+
+	completed := 0
+	for _, cr := range r.Collections {
+		if cr.Status == model.CollectionCompleted {
+			completed++
+		}
+	}
+	switch {
+	case completed == 0:
+		r.Status = model.RunFailed
+	case completed == len(r.Collections) && err == nil:
+		r.Status = model.RunSucceeded
+	default:
+		r.Status = model.RunPartiallyFailed
+	}
+
+	if err != nil {
+		return err
+	}
+	if r.Status == model.RunFailed {
+		return fmt.Errorf("%s failed for every collection", r.Action)
+	}
+	if r.Status == model.RunPartiallyFailed {
+		return fmt.Errorf("%s failed for %d of %d collections", r.Action, len(r.Collections)-completed, len(r.Collections))
+	}
+	return nil
+}
+
+// logSummary logs how many collections ended in each state.
+func (dumper *SolrDump) logSummary() {
+	count := map[model.CollectionStatus]int{}
+	for _, cr := range dumper.report.Collections {
+		count[cr.Status]++
+	}
+	klog.Infof("%s run %s finished: %d completed, %d failed, %d not found, %d timed out",
+		dumper.report.Action, dumper.report.RunId,
+		count[model.CollectionCompleted], count[model.CollectionFailed], count[model.CollectionNotFound], count[model.CollectionTimedOut])
+	for _, cr := range dumper.report.Collections {
+		if cr.Status != model.CollectionCompleted {
+			klog.Warningf("%s of collection %s is %s: %s", dumper.report.Action, cr.Collection, cr.Status, cr.Error)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package solr_dump
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pritamdas99/solr-dump/model"
+	"k8s.io/klog/v2"
+)
+
+// RestoreTest restores every verified backup point into a scratch collection, compares it with the
+// document count and sample recorded in the manifest of its backup run and deletes the scratch
+// collection again. Backup points that failed the file checks are not restored.
+func (dumper *SolrDump) RestoreTest(ctx context.Context, vr *model.VerifyReport) error {
+	if dumper.bl == nil {
+		return fmt.Errorf("backup storage is required for a restore test")
+	}
+	runId := newRunId("verify")
+	dumper.report = newReport("verify", runId)
+	klog.Infof("starting restore test %s", runId)
+
+	manifests := map[string]*model.Manifest{}
+	tests := map[string]*model.CollectionVerification{}
+	expected := map[string]*model.CollectionManifest{}
+	for _, cv := range vr.Collections {
+		// logical dumps are imported rather than restored, they aren't tested
+		if cv.Status != model.VerifyValid || cv.Dump != nil {
+			continue
+		}
+		scratch := fmt.Sprintf("%s-restoretest-%d-%s", cv.Collection, cv.BackupId, runId[strings.LastIndex(runId, "-")+1:])
+		cv.RestoreTest = &model.RestoreTestResult{ScratchCollection: scratch}
+		cm, err := dumper.recordedCollection(ctx, manifests, cv)
+		if err != nil {
+			cv.RestoreTest.Error = err.Error()
+			cv.Status = model.VerifyInvalid
+			continue
+		}
+		cr := dumper.collectionReport(scratch)
+		cr.Source = cv.Collection
+		cr.BackupName = cv.Backup
+		backupId := cv.BackupId
+		cr.BackupId = &backupId
+		tests[scratch] = cv
+		expected[scratch] = cm
+	}
+
+	if len(tests) > 0 {
+		if err := dumper.run(ctx); err != nil {
+			klog.Error(err)
+		}
+	}
+	for _, cr := range dumper.report.Collections {
+		cv := tests[cr.Collection]
+		rt := cv.RestoreTest
+		if cr.Status == model.CollectionCompleted {
+			dumper.compareRestore(ctx, cr.Collection, expected[cr.Collection], rt)
+		} else {
+			rt.Error = fmt.Sprintf("restore is %s: %s", cr.Status, cr.Error)
+		}
+		if !rt.Passed {
+			cv.Status = model.VerifyInvalid
+		}
+		if cr.Status == model.CollectionPending {
+			continue
+		}
+		// a failed restore may still have created the collection, the run context may be done already
+		dctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		if err := dumper.deleteCollection(dctx, cr.Collection); err != nil {
+			klog.Warningf("failed to delete scratch collection %s, it may have to be deleted manually: %v", cr.Collection, err)
+		}
+		cancel()
+	}
+	updateVerifyStatus(vr)
+	return nil
+}
+
+// recordedCollection returns the manifest entry of the backup point of cv.
+func (dumper *SolrDump) recordedCollection(ctx context.Context, manifests map[string]*model.Manifest, cv *model.CollectionVerification) (*model.CollectionManifest, error) {
+	if cv.RunId == "" {
+		return nil, fmt.Errorf("backup point %d isn't recorded in a manifest, there is nothing to compare the restore with", cv.BackupId)
+	}
+	m, ok := manifests[cv.RunId]
+	if !ok {
+		var err error
+		m, err = ReadManifest(ctx, dumper.bl, cv.RunId)
+		if err != nil {
+			return nil, err
+		}
+		manifests[cv.RunId] = m
+	}
+	for i := range m.Collections {
+		cm := &m.Collections[i]
+		if cm.Name == cv.Collection && cm.BackupName == cv.Backup && cm.BackupId != nil && *cm.BackupId == cv.BackupId {
+			if cm.NumDocs == nil && len(cm.Sample) == 0 {
+				return nil, fmt.Errorf("run %s recorded neither a document count nor a sample", cv.RunId)
+			}
+			return cm, nil
+		}
+	}
+	return nil, fmt.Errorf("backup point %d isn't recorded in the manifest of run %s", cv.BackupId, cv.RunId)
+}
+
+// compareRestore compares the scratch collection with the document count and sample of cm.
+func (dumper *SolrDump) compareRestore(ctx context.Context, scratch string, cm *model.CollectionManifest, rt *model.RestoreTestResult) {
+	rt.ExpectedDocs = cm.NumDocs
+	rt.SampleSize = len(cm.Sample)
+	n, err := dumper.numDocs(ctx, scratch)
+	if err != nil {
+		rt.Error = fmt.Sprintf("failed to count restored documents: %v", err)
+		return
+	}
+	rt.RestoredDocs = &n
+
+	if len(cm.Sample) > 0 {
+		ids := make([]string, 0, len(cm.Sample))
+		for _, sample := range cm.Sample {
+			ids = append(ids, quoteTerm(sample.ID))
+		}
+		q := fmt.Sprintf("%s:(%s)", cm.UniqueKey, strings.Join(ids, " OR "))
+		docs, err := dumper.selectDocuments(ctx, scratch, q, len(cm.Sample))
+		if err != nil {
+			rt.Error = fmt.Sprintf("failed to read the sampled documents: %v", err)
+			return
+		}
+		restored := map[string]string{}
+		for _, doc := range docs {
+			hash, err := docHash(doc)
+			if err != nil {
+				rt.Error = err.Error()
+				return
+			}
+			restored[fmt.Sprint(doc[cm.UniqueKey])] = hash
+		}
+		for _, sample := range cm.Sample {
+			hash, ok := restored[sample.ID]
+			if !ok {
+				rt.SampleMismatches = append(rt.SampleMismatches, sample.ID+": missing")
+			} else if hash != sample.Hash {
+				rt.SampleMismatches = append(rt.SampleMismatches, sample.ID+": differs")
+			}
+		}
+	}
+
+	rt.Passed = (cm.NumDocs == nil || *cm.NumDocs == n) && len(rt.SampleMismatches) == 0
+	if rt.Passed {
+		klog.Infof("restore test of %s passed", scratch)
+	} else {
+		klog.Warningf("restore test of %s failed: restored %d of %v documents, %d of %d sampled documents differ",
+			scratch, n, valueOrUnknown(cm.NumDocs), len(rt.SampleMismatches), len(cm.Sample))
+	}
+}
+
+// quoteTerm quotes value for a lucene query.
+func quoteTerm(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+}
+
+func valueOrUnknown(n *int64) interface{} {
+	if n == nil {
+		return "unknown"
+	}
+	return *n
+}
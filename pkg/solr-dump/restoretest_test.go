@@ -0,0 +1,223 @@
+package solr_dump
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pritamdas99/solr-dump/model"
+)
+
+// restoredDocs are the documents of the scratch collection served by scratchSolr.
+var restoredDocs = []map[string]interface{}{
+	{"id": "doc-1", "title": "first", "_version_": float64(11)},
+	{"id": "doc-2", "title": "second", "_version_": float64(12)},
+	{"id": `doc "3" \ OR id:doc-1`, "title": "third", "_version_": float64(13)},
+}
+
+// scratchSolr serves the select handler of collection scratch. Counting requests have rows=0, the
+// sampled documents are selected by a query of quoted ids, id:("a" OR "b").
+func scratchSolr(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/solr/scratch/select" {
+			t.Errorf("unexpected request %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		docs := []map[string]interface{}{}
+		if r.URL.Query().Get("rows") != "0" {
+			ids, err := parseQuotedIds(r.URL.Query().Get("q"))
+			if err != nil {
+				t.Errorf("invalid query %q: %v", r.URL.Query().Get("q"), err)
+			}
+			for _, doc := range restoredDocs {
+				for _, id := range ids {
+					if doc["id"] == id {
+						docs = append(docs, doc)
+					}
+				}
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"responseHeader": map[string]interface{}{"status": 0},
+			"response":       map[string]interface{}{"numFound": len(restoredDocs), "start": 0, "docs": docs},
+		})
+	})
+}
+
+// parseQuotedIds returns the terms of a query id:("a" OR "b"), unescaping them like the query parser.
+func parseQuotedIds(q string) ([]string, error) {
+	if !strings.HasPrefix(q, "id:(") || !strings.HasSuffix(q, ")") {
+		return nil, strconv.ErrSyntax
+	}
+	q = q[len("id:(") : len(q)-1]
+	var ids []string
+	for i := 0; i < len(q); {
+		if len(ids) > 0 {
+			if !strings.HasPrefix(q[i:], " OR ") {
+				return nil, strconv.ErrSyntax
+			}
+			i += len(" OR ")
+		}
+		if i >= len(q) || q[i] != '"' {
+			return nil, strconv.ErrSyntax
+		}
+		var id strings.Builder
+		for i++; i < len(q) && q[i] != '"'; i++ {
+			if q[i] == '\\' && i+1 < len(q) {
+				i++
+			}
+			id.WriteByte(q[i])
+		}
+		if i >= len(q) {
+			return nil, strconv.ErrSyntax
+		}
+		i++
+		ids = append(ids, id.String())
+	}
+	return ids, nil
+}
+
+func sampleOf(t *testing.T, doc map[string]interface{}) model.DocSample {
+	t.Helper()
+	hash, err := docHash(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return model.DocSample{ID: doc["id"].(string), Hash: hash}
+}
+
+func int64Ptr(n int64) *int64 {
+	return &n
+}
+
+func TestCompareRestore(t *testing.T) {
+	// the documents as they were sampled at backup time, with the _version_ they had then
+	backedUp := func(i int) map[string]interface{} {
+		doc := map[string]interface{}{}
+		for name, value := range restoredDocs[i] {
+			doc[name] = value
+		}
+		doc["_version_"] = float64(i)
+		return doc
+	}
+	tests := map[string]struct {
+		numDocs    *int64
+		sample     func(t *testing.T) []model.DocSample
+		passed     bool
+		mismatches []string
+	}{
+		"restored": {
+			numDocs: int64Ptr(3),
+			sample: func(t *testing.T) []model.DocSample {
+				return []model.DocSample{sampleOf(t, backedUp(0)), sampleOf(t, backedUp(1))}
+			},
+			passed: true,
+		},
+		"count mismatch": {
+			numDocs: int64Ptr(4),
+			sample: func(t *testing.T) []model.DocSample {
+				return []model.DocSample{sampleOf(t, backedUp(0))}
+			},
+		},
+		"count only": {
+			numDocs: int64Ptr(3),
+			sample:  func(t *testing.T) []model.DocSample { return nil },
+			passed:  true,
+		},
+		"sample only": {
+			sample: func(t *testing.T) []model.DocSample {
+				return []model.DocSample{sampleOf(t, backedUp(1))}
+			},
+			passed: true,
+		},
+		"missing sample": {
+			numDocs: int64Ptr(3),
+			sample: func(t *testing.T) []model.DocSample {
+				return []model.DocSample{sampleOf(t, backedUp(0)), {ID: "doc-9", Hash: "0"}}
+			},
+			mismatches: []string{"doc-9: missing"},
+		},
+		"changed sample": {
+			numDocs: int64Ptr(3),
+			sample: func(t *testing.T) []model.DocSample {
+				doc := backedUp(1)
+				doc["title"] = "changed"
+				return []model.DocSample{sampleOf(t, backedUp(0)), sampleOf(t, doc)}
+			},
+			mismatches: []string{"doc-2: differs"},
+		},
+		// the id must be quoted, unquoted it would match doc-1 instead
+		"id with query syntax": {
+			numDocs: int64Ptr(3),
+			sample: func(t *testing.T) []model.DocSample {
+				return []model.DocSample{sampleOf(t, backedUp(2))}
+			},
+			passed: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dumper := newTestDumper(t, scratchSolr(t))
+			cm := &model.CollectionManifest{Name: "c1", NumDocs: test.numDocs, UniqueKey: "id", Sample: test.sample(t)}
+			rt := &model.RestoreTestResult{ScratchCollection: "scratch"}
+			dumper.compareRestore(context.Background(), "scratch", cm, rt)
+
+			if rt.Error != "" {
+				t.Fatalf("restore test failed: %s", rt.Error)
+			}
+			if rt.Passed != test.passed {
+				t.Errorf("passed = %v, want %v", rt.Passed, test.passed)
+			}
+			if !reflect.DeepEqual(rt.SampleMismatches, test.mismatches) {
+				t.Errorf("sample mismatches = %v, want %v", rt.SampleMismatches, test.mismatches)
+			}
+			if rt.RestoredDocs == nil || *rt.RestoredDocs != 3 || rt.SampleSize != len(cm.Sample) {
+				t.Errorf("restored %v documents with a sample of %d, want 3 and %d", valueOrUnknown(rt.RestoredDocs), rt.SampleSize, len(cm.Sample))
+			}
+		})
+	}
+}
+
+func TestRecordedCollection(t *testing.T) {
+	bl := newTestBlob(t)
+	putManifest(t, bl, &model.Manifest{
+		RunId: "run1",
+		Collections: []model.CollectionManifest{
+			{Name: "c1", BackupName: "c1-backup", BackupId: intPtr(0), NumDocs: int64Ptr(3)},
+			{Name: "c2", BackupName: "c2-backup", BackupId: intPtr(0)},
+		},
+	})
+	dumper := &SolrDump{bl: bl}
+	tests := map[string]struct {
+		cv  model.CollectionVerification
+		err string
+	}{
+		"recorded":           {cv: model.CollectionVerification{Collection: "c1", Backup: "c1-backup", BackupId: 0, RunId: "run1"}},
+		"no run":             {cv: model.CollectionVerification{Collection: "c1", Backup: "c1-backup", BackupId: 0}, err: "isn't recorded in a manifest"},
+		"other backup point": {cv: model.CollectionVerification{Collection: "c1", Backup: "c1-backup", BackupId: 1, RunId: "run1"}, err: "isn't recorded in the manifest of run run1"},
+		"no count or sample": {cv: model.CollectionVerification{Collection: "c2", Backup: "c2-backup", BackupId: 0, RunId: "run1"}, err: "neither a document count nor a sample"},
+		"missing manifest":   {cv: model.CollectionVerification{Collection: "c1", Backup: "c1-backup", BackupId: 0, RunId: "run2"}, err: "run2"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cm, err := dumper.recordedCollection(context.Background(), map[string]*model.Manifest{}, &test.cv)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("got error %v, want one mentioning %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cm.Name != "c1" || cm.NumDocs == nil || *cm.NumDocs != 3 {
+				t.Errorf("got %+v, want the entry of c1", cm)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package solr_dump
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/pritamdas99/solr-dump/model"
+	"k8s.io/klog/v2"
+)
+
+// RetentionPolicy selects the backup points of a collection to keep. A point is kept if any of the
+// keep rules selects it, or if no keep rule is set. Points older than MaxAge are removed regardless.
+// The latest backup point of a collection and points without a known time are always kept.
+type RetentionPolicy struct {
+	// KeepLast keeps the newest KeepLast backup points.
+	KeepLast int
+	// KeepDaily, KeepWeekly and KeepMonthly keep the newest backup point of each of the
+	// last that many days, ISO weeks and months that have a backup point.
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+	// MaxAge removes the backup points taken longer than MaxAge ago. Zero means no limit.
+	MaxAge time.Duration
+}
+
+func (p RetentionPolicy) IsZero() bool {
+	return !p.hasKeepRules() && p.MaxAge == 0
+}
+
+func (p RetentionPolicy) hasKeepRules() bool {
+	return p.KeepLast > 0 || p.KeepDaily > 0 || p.KeepWeekly > 0 || p.KeepMonthly > 0
+}
+
+// expired returns the backup points removed by the policy along with the reason.
+func (p RetentionPolicy) expired(points []model.BackupPoint, now time.Time) map[int]string {
+	removed := map[int]string{}
+	if len(points) == 0 {
+		return removed
+	}
+	sorted := make([]model.BackupPoint, len(points))
+	copy(sorted, points)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ID > sorted[j].ID
+	})
+
+	keep := map[int]bool{}
+	for i := 0; i < p.KeepLast && i < len(sorted); i++ {
+		keep[sorted[i].ID] = true
+	}
+	keepPeriodic := func(n int, period func(time.Time) string) {
+		seen := map[string]bool{}
+		for _, point := range sorted {
+			taken := pointTime(point)
+			if taken == nil || len(seen) >= n {
+				continue
+			}
+			if key := period(taken.UTC()); !seen[key] {
+				seen[key] = true
+				keep[point.ID] = true
+			}
+		}
+	}
+	keepPeriodic(p.KeepDaily, func(t time.Time) string {
+		return t.Format("2006-01-02")
+	})
+	keepPeriodic(p.KeepWeekly, func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	})
+	keepPeriodic(p.KeepMonthly, func(t time.Time) string {
+		return t.Format("2006-01")
+	})
+
+	for _, point := range sorted[1:] {
+		taken := pointTime(point)
+		if taken == nil {
+			continue
+		}
+		if p.MaxAge > 0 && now.Sub(*taken) > p.MaxAge {
+			removed[point.ID] = fmt.Sprintf("older than %s", p.MaxAge)
+		} else if p.hasKeepRules() && !keep[point.ID] {
+			removed[point.ID] = "not selected by any keep rule"
+		}
+	}
+	return removed
+}
+
+func pointTime(point model.BackupPoint) *time.Time {
+	if point.StartTime != nil {
+		return point.StartTime
+	}
+	return point.EndTime
+}
+
+// Prune applies the retention policy to every backup of a collection matched by the collection filter.
+func (dumper *SolrDump) Prune(ctx context.Context) (*model.PruneReport, error) {
+	return dumper.prune(ctx, func(backupName string, collection string) bool {
+		return dumper.filter.Match(collection)
+	})
+}
+
+// PlanPrune reports the backup points of the collections matched by filter that policy expires, and the
+// backup runs whose metadata would be deleted along with them, without deleting anything. It only reads
+// the backup storage and doesn't need a connection to solr.
+func PlanPrune(ctx context.Context, bl model.Blob, filter *CollectionFilter, policy RetentionPolicy) (*model.PruneReport, error) {
+	return pruneBackups(ctx, bl, policy, func(backupName string, collection string) bool {
+		return filter.Match(collection)
+	}, nil)
+}
+
+// pruneAfterBackup applies the retention policy to the backups completed by the current run.
+func (dumper *SolrDump) pruneAfterBackup(ctx context.Context) {
+	completed := map[string]bool{}
+	for _, cr := range dumper.report.Collections {
+		if cr.Status == model.CollectionCompleted {
+			completed[path.Join(cr.BackupName, cr.Collection)] = true
+		}
+	}
+	if len(completed) == 0 {
+		return
+	}
+	pr, err := dumper.prune(ctx, func(backupName string, collection string) bool {
+		return completed[path.Join(backupName, collection)]
+	})
+	if err != nil {
+		klog.Errorf("failed to apply the retention policy: %v", err)
+		return
+	}
+	for _, pp := range pr.Points {
+		if pp.Error != "" {
+			klog.Errorf("failed to prune backup point %d of %s: %s", pp.ID, path.Join(pp.Backup, pp.Collection), pp.Error)
+		}
+	}
+}
+
+// prune removes the backup points expired by the retention policy from the selected backups through
+// solr, so that the index files they no longer share with other points are purged as well. The run
+// metadata of backup runs whose backup points are all gone is deleted from the backup storage.
+func (dumper *SolrDump) prune(ctx context.Context, selected func(backupName string, collection string) bool) (*model.PruneReport, error) {
+	if dumper.bl == nil {
+		return nil, fmt.Errorf("backup storage is required to prune backups")
+	}
+	if dumper.dryRun {
+		return pruneBackups(ctx, dumper.bl, dumper.retention, selected, nil)
+	}
+	return pruneBackups(ctx, dumper.bl, dumper.retention, selected, dumper.deleteBackupPoint)
+}
+
+// pruneBackups applies policy to the selected backups of bl. Expired backup points are deleted with
+// deletePoint, a nil deletePoint only reports what would be deleted.
+func pruneBackups(ctx context.Context, bl model.Blob, policy RetentionPolicy, selected func(backupName string, collection string) bool, deletePoint func(ctx context.Context, backupName string, backupId int) error) (*model.PruneReport, error) {
+	if policy.IsZero() {
+		return nil, fmt.Errorf("no retention rule is set")
+	}
+	backups, err := ListBackups(ctx, bl)
+	if err != nil {
+		return nil, err
+	}
+
+	dryRun := deletePoint == nil
+	pr := &model.PruneReport{DryRun: dryRun, Points: []model.PrunedPoint{}, Runs: []string{}}
+	now := time.Now()
+	remaining := map[string]bool{}
+	for _, bi := range backups {
+		for _, cb := range bi.Collections {
+			if !selected(bi.Name, cb.Name) {
+				for _, point := range cb.Points {
+					remaining[pointKey(bi.Name, cb.Name, point.ID)] = true
+				}
+				continue
+			}
+			removed := policy.expired(cb.Points, now)
+			for _, point := range cb.Points {
+				reason, ok := removed[point.ID]
+				if !ok {
+					remaining[pointKey(bi.Name, cb.Name, point.ID)] = true
+					continue
+				}
+				pp := model.PrunedPoint{
+					Backup:     bi.Name,
+					Collection: cb.Name,
+					ID:         point.ID,
+					Taken:      pointTime(point),
+					RunId:      point.RunId,
+					Reason:     reason,
+				}
+				if dryRun {
+					klog.Infof("would delete backup point %d of %s: %s", point.ID, path.Join(bi.Name, cb.Name), reason)
+				} else if err := deletePoint(ctx, bi.Name, point.ID); err != nil {
+					pp.Error = err.Error()
+					remaining[pointKey(bi.Name, cb.Name, point.ID)] = true
+				} else {
+					klog.Infof("deleted backup point %d of %s: %s", point.ID, path.Join(bi.Name, cb.Name), reason)
+					pp.Deleted = true
+				}
+				pr.Points = append(pr.Points, pp)
+			}
+		}
+	}
+
+	runs, err := obsoleteRuns(ctx, bl, remaining)
+	if err != nil {
+		return pr, err
+	}
+	for _, runId := range runs {
+		if dryRun {
+			klog.Infof("would delete metadata of run %s", runId)
+			pr.Runs = append(pr.Runs, runId)
+			continue
+		}
+		if err := deleteRun(ctx, bl, runId); err != nil {
+			klog.Errorf("failed to delete metadata of run %s: %v", runId, err)
+			continue
+		}
+		klog.Infof("deleted metadata of run %s", runId)
+		pr.Runs = append(pr.Runs, runId)
+	}
+	return pr, nil
+}
+
+func pointKey(backupName string, collection string, id int) string {
+	return fmt.Sprintf("%s/%s/%d", backupName, collection, id)
+}
+
+// obsoleteRuns returns the backup runs whose manifest references backup points, none of which remain.
+func obsoleteRuns(ctx context.Context, bl model.Blob, remaining map[string]bool) ([]string, error) {
+	objects, err := bl.List(ctx, path.Join(model.MetadataDir, "runs"))
+	if err != nil {
+		return nil, err
+	}
+	var runs []string
+	for _, obj := range objects {
+		runId, ok := isManifestPath(obj)
+		if !ok {
+			continue
+		}
+		m, err := ReadManifest(ctx, bl, runId)
+		if err != nil {
+			klog.Warning(err)
+			continue
+		}
+		referenced, left := 0, 0
+		for _, cm := range m.Collections {
+			if cm.BackupId == nil {
+				continue
+			}
+			referenced++
+			if remaining[pointKey(cm.BackupName, cm.Name, *cm.BackupId)] {
+				left++
+			}
+		}
+		if referenced > 0 && left == 0 {
+			runs = append(runs, runId)
+		}
+	}
+	return runs, nil
+}
+
+// deleteRun removes everything stored under the metadata directory of run runId.
+func deleteRun(ctx context.Context, bl model.Blob, runId string) error {
+	objects, err := bl.List(ctx, runDir(runId))
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		if err := bl.Delete(ctx, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package solr_dump
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/pritamdas99/solr-dump/blob"
+	"github.com/pritamdas99/solr-dump/model"
+)
+
+func TestRetentionPolicyExpired(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	at := func(id int, ago time.Duration) model.BackupPoint {
+		return model.BackupPoint{ID: id, StartTime: timePtr(now.Add(-ago))}
+	}
+	day := 24 * time.Hour
+	tests := map[string]struct {
+		policy RetentionPolicy
+		points []model.BackupPoint
+		want   []int
+	}{
+		"keep last": {
+			policy: RetentionPolicy{KeepLast: 2},
+			points: []model.BackupPoint{at(0, 4*day), at(1, 3*day), at(2, 2*day), at(3, day), at(4, 0)},
+			want:   []int{0, 1, 2},
+		},
+		"keep more than there are": {
+			policy: RetentionPolicy{KeepLast: 10},
+			points: []model.BackupPoint{at(0, 2*day), at(1, day)},
+		},
+		"keep daily": {
+			policy: RetentionPolicy{KeepDaily: 2},
+			// two points on each of the last two days, the newest of each day is kept
+			points: []model.BackupPoint{at(0, 3*day), at(1, day+2*time.Hour), at(2, day), at(3, 2*time.Hour), at(4, 0)},
+			want:   []int{0, 1, 3},
+		},
+		"keep weekly": {
+			policy: RetentionPolicy{KeepWeekly: 2},
+			// 2024-03-15 is a friday
+			points: []model.BackupPoint{at(0, 14*day), at(1, 8*day), at(2, 7*day), at(3, day), at(4, 0)},
+			want:   []int{0, 1, 3},
+		},
+		"keep monthly": {
+			policy: RetentionPolicy{KeepMonthly: 2},
+			// the newest points of march and february
+			points: []model.BackupPoint{at(0, 60*day), at(1, 30*day), at(2, 20*day), at(3, 10*day), at(4, 0)},
+			want:   []int{0, 1, 3},
+		},
+		"keep rules are combined": {
+			policy: RetentionPolicy{KeepLast: 2, KeepMonthly: 3},
+			points: []model.BackupPoint{at(0, 60*day), at(1, 30*day), at(2, 20*day), at(3, 10*day), at(4, 0)},
+			want:   []int{1},
+		},
+		"max age": {
+			policy: RetentionPolicy{MaxAge: 2 * day},
+			points: []model.BackupPoint{at(0, 3*day), at(1, 2*day+time.Second), at(2, 2*day), at(3, 0)},
+			want:   []int{0, 1},
+		},
+		"max age overrides keep rules": {
+			policy: RetentionPolicy{KeepLast: 10, MaxAge: 2 * day},
+			points: []model.BackupPoint{at(0, 3*day), at(1, day), at(2, 0)},
+			want:   []int{0},
+		},
+		"latest is always kept": {
+			policy: RetentionPolicy{MaxAge: day},
+			points: []model.BackupPoint{at(0, 30*day), at(1, 20*day)},
+			want:   []int{0},
+		},
+		"unknown time is kept": {
+			policy: RetentionPolicy{KeepLast: 1, MaxAge: day},
+			points: []model.BackupPoint{{ID: 0}, at(1, 30*day), {ID: 2, EndTime: timePtr(now.Add(-30 * day))}, at(3, 0)},
+			want:   []int{1, 2},
+		},
+		"ids decide the order": {
+			policy: RetentionPolicy{KeepLast: 1},
+			points: []model.BackupPoint{at(2, 0), at(0, 0), at(1, 0)},
+			want:   []int{0, 1},
+		},
+		"no point": {
+			policy: RetentionPolicy{KeepLast: 1},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var got []int
+			for id := range test.policy.expired(test.points, now) {
+				got = append(got, id)
+			}
+			sort.Ints(got)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expired %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// newPruneBlob returns a backup storage with four backup points of c1, taken on consecutive days by
+// runs run0 to run3, and one backup point of c2 that run0 took as well.
+func newPruneBlob(t *testing.T) model.Blob {
+	t.Helper()
+	bl := newTestBlob(t)
+	day := time.Now().Add(-10 * 24 * time.Hour)
+	putBackupPoint(t, bl, "c2-backup", "c2", 0, day)
+	for id := 0; id < 4; id++ {
+		putBackupPoint(t, bl, "c1-backup", "c1", id, day.Add(time.Duration(id)*24*time.Hour))
+		m := &model.Manifest{
+			RunId:       []string{"run0", "run1", "run2", "run3"}[id],
+			Collections: []model.CollectionManifest{{Name: "c1", BackupName: "c1-backup", BackupId: intPtr(id)}},
+		}
+		if id == 0 {
+			m.Collections = append(m.Collections, model.CollectionManifest{Name: "c2", BackupName: "c2-backup", BackupId: intPtr(0)})
+		}
+		putManifest(t, bl, m)
+	}
+	putObject(t, bl, runDir("run1")+"/state.json", []byte("{}"))
+	// a logical dump run references no backup point, it is never obsolete
+	putManifest(t, bl, &model.Manifest{RunId: "dump", Collections: []model.CollectionManifest{{Name: "c1"}}})
+	return bl
+}
+
+func TestPlanPrune(t *testing.T) {
+	bl := newPruneBlob(t)
+	filter, err := NewCollectionFilter([]string{"c1"}, nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, err := PlanPrune(context.Background(), bl, filter, RetentionPolicy{KeepLast: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pr.DryRun {
+		t.Error("prune report of a plan is not a dry run")
+	}
+	var ids []int
+	for _, pp := range pr.Points {
+		if pp.Backup != "c1-backup" || pp.Collection != "c1" || pp.Deleted || pp.Reason == "" || pp.Taken == nil {
+			t.Errorf("unexpected pruned point %+v", pp)
+		}
+		ids = append(ids, pp.ID)
+	}
+	if want := []int{0, 1}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got expired points %v, want %v", ids, want)
+	}
+	// run0 took the backup point of c2 as well, which isn't pruned
+	if want := []string{"run1"}; !reflect.DeepEqual(pr.Runs, want) {
+		t.Errorf("got obsolete runs %v, want %v", pr.Runs, want)
+	}
+	if _, err := bl.Stat(context.Background(), manifestPath("run1")); err != nil {
+		t.Errorf("plan deleted the manifest of run1: %v", err)
+	}
+
+	if _, err := PlanPrune(context.Background(), bl, filter, RetentionPolicy{}); err == nil {
+		t.Error("planned a prune without any retention rule")
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	ctx := context.Background()
+	bl := newPruneBlob(t)
+	var deleted []int
+	deletePoint := func(ctx context.Context, backupName string, backupId int) error {
+		if backupId == 1 {
+			return errors.New("solr is down")
+		}
+		deleted = append(deleted, backupId)
+		return nil
+	}
+	everything := func(string, string) bool { return true }
+
+	pr, err := pruneBackups(ctx, bl, RetentionPolicy{KeepLast: 1}, everything, deletePoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.DryRun {
+		t.Error("prune report is a dry run")
+	}
+	if want := []int{0, 2}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("deleted backup points %v, want %v", deleted, want)
+	}
+	for _, pp := range pr.Points {
+		if failed := pp.ID == 1; pp.Deleted == failed || (pp.Error != "") != failed {
+			t.Errorf("unexpected pruned point %+v", pp)
+		}
+	}
+	// run1's backup point remains as it failed to be deleted
+	if want := []string{"run2"}; !reflect.DeepEqual(pr.Runs, want) {
+		t.Errorf("deleted runs %v, want %v", pr.Runs, want)
+	}
+	for _, run := range []string{"run0", "run1", "run3", "dump"} {
+		if _, err := bl.Stat(ctx, manifestPath(run)); err != nil {
+			t.Errorf("manifest of %s was deleted: %v", run, err)
+		}
+	}
+	objects, err := bl.List(ctx, runDir("run2"))
+	if err != nil || len(objects) != 0 {
+		t.Errorf("got %v, %v, want the metadata of run2 deleted", objects, err)
+	}
+}
+
+func TestObsoleteRuns(t *testing.T) {
+	ctx := context.Background()
+	bl := newPruneBlob(t)
+	remaining := map[string]bool{
+		pointKey("c1-backup", "c1", 3): true,
+	}
+	runs, err := obsoleteRuns(ctx, bl, remaining)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(runs)
+	if want := []string{"run0", "run1", "run2"}; !reflect.DeepEqual(runs, want) {
+		t.Errorf("got obsolete runs %v, want %v", runs, want)
+	}
+
+	if err := deleteRun(ctx, bl, "run1"); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{manifestPath("run1"), manifestPath("run1") + checksumExt, runDir("run1") + "/state.json"} {
+		if _, err := bl.Stat(ctx, p); !blob.IsNotFound(err) {
+			t.Errorf("stat of %s returned %v, want it deleted", p, err)
+		}
+	}
+	if _, err := bl.Stat(ctx, manifestPath("run0")); err != nil {
+		t.Errorf("deleting run1 deleted the manifest of run0: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package solr_dump
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pritamdas99/solr-dump/model"
+)
+
+// stateStore persists the state of a run, so that an interrupted run can be resumed.
+type stateStore interface {
+	Load(ctx context.Context, runId string) (*model.Report, error)
+	Save(ctx context.Context, state *model.Report) error
+}
+
+// localStateStore keeps the state of run <runId> in <dir>/<runId>.json.
+type localStateStore struct {
+	dir string
+}
+
+func (s *localStateStore) Load(_ context.Context, runId string) (*model.Report, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, runId+".json"))
+	if err != nil {
+		return nil, err
+	}
+	return decodeState(data)
+}
+
+func (s *localStateStore) Save(_ context.Context, state *model.Report) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	filename := filepath.Join(s.dir, state.RunId+".json")
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// blobStateStore keeps the state of run <runId> in .solrdump/runs/<runId>/state.json of the backup storage,
+// along with its sha256 in state.json.sha256.
+type blobStateStore struct {
+	bl          model.Blob
+	compression CompressionOptions
+}
+
+func runDir(runId string) string {
+	return fmt.Sprintf("%s/runs/%s", model.MetadataDir, runId)
+}
+
+func (s *blobStateStore) Load(ctx context.Context, runId string) (*model.Report, error) {
+	data, err := getWithChecksum(ctx, s.bl, runDir(runId)+"/state.json")
+	if err != nil {
+		return nil, err
+	}
+	if data, err = decompressBytes(data); err != nil {
+		return nil, err
+	}
+	return decodeState(data)
+}
+
+func (s *blobStateStore) Save(ctx context.Context, state *model.Report) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if s.compression.Metadata {
+		if data, err = compressBytes(data, s.compression.codec(), s.compression.Level); err != nil {
+			return err
+		}
+	}
+	return putWithChecksum(ctx, s.bl, runDir(state.RunId)+"/state.json", data)
+}
+
+func decodeState(data []byte) (*model.Report, error) {
+	state := &model.Report{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to decode run state: %v", err)
+	}
+	return state, nil
+}
+
+// newRunId returns a unique id for a run, e.g. backup-20240501t101500z-1a2b3c.
+func newRunId(action string) string {
+	b := make([]byte, 3)
+	_, _ = rand.Read(b)
+	ts := strings.ToLower(time.Now().UTC().Format("20060102T150405Z"))
+	return fmt.Sprintf("%s-%s-%s", action, ts, hex.EncodeToString(b))
+}
+
+// asyncId returns the id of the solr async request for collection in this run.
+func (dumper *SolrDump) asyncId(collection string) string {
+	return fmt.Sprintf("%s-%s", collection, dumper.report.RunId)
+}
@@ -0,0 +1,67 @@
+package solr_dump
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pritamdas99/solr-dump/model"
+)
+
+// Keys of the storage credentials secret, named like the keys of KubeStash storage secrets.
+const (
+	SecretAWSAccessKeyId       = "AWS_ACCESS_KEY_ID"
+	SecretAWSSecretAccessKey   = "AWS_SECRET_ACCESS_KEY"
+	SecretAWSSessionToken      = "AWS_SESSION_TOKEN"
+	SecretGoogleServiceAccount = "GOOGLE_SERVICE_ACCOUNT_JSON_KEY"
+	SecretAzureAccountName     = "AZURE_ACCOUNT_NAME"
+	SecretAzureAccountKey      = "AZURE_ACCOUNT_KEY"
+	SecretAzureSASToken        = "AZURE_SAS_TOKEN"
+)
+
+// ResolveStorageSecret reads the secret of bs, if any, from the cluster selected by conn and fills the
+// credentials of the provider that aren't set explicitly with its data.
+func ResolveStorageSecret(ctx context.Context, conn ConnectionOptions, bs *model.BackupStorage) error {
+	ref := bs.Storage.Secret
+	if ref == nil {
+		return nil
+	}
+	switch bs.Storage.Provider {
+	case model.ProviderS3, model.ProviderGCS, model.ProviderAZURE:
+	default:
+		return fmt.Errorf("provider %s doesn't take credentials from a secret", bs.Storage.Provider)
+	}
+	secret, err := getSecret(ctx, conn, ref.Namespace, ref.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get storage secret %s/%s: %v", ref.Namespace, ref.Name, err)
+	}
+	fill := func(value *string, key string) {
+		if *value == "" {
+			*value = string(secret.Data[key])
+		}
+	}
+
+	switch bs.Storage.Provider {
+	case model.ProviderS3:
+		if s3 := bs.Storage.S3; s3 != nil && s3.AccessKeyId == "" {
+			fill(&s3.AccessKeyId, SecretAWSAccessKeyId)
+			fill(&s3.SecretAccessKey, SecretAWSSecretAccessKey)
+			fill(&s3.SessionToken, SecretAWSSessionToken)
+		}
+	case model.ProviderGCS:
+		if gcs := bs.Storage.Gcs; gcs != nil && gcs.CredentialsFile == "" {
+			fill(&gcs.ServiceAccountKey, SecretGoogleServiceAccount)
+		}
+	case model.ProviderAZURE:
+		if az := bs.Storage.Azure; az != nil {
+			fill(&az.Account, SecretAzureAccountName)
+			// an account key in the secret wins over a sas token
+			if az.AccountKey == "" && az.SASToken == "" {
+				fill(&az.AccountKey, SecretAzureAccountKey)
+				if az.AccountKey == "" {
+					fill(&az.SASToken, SecretAzureSASToken)
+				}
+			}
+		}
+	}
+	return nil
+}
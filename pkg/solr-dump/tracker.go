@@ -0,0 +1,179 @@
+package solr_dump
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pritamdas99/solr-dump/model"
+	"k8s.io/klog/v2"
+)
+
+// TrackerOptions configures how the async requests submitted to solr are polled.
+type TrackerOptions struct {
+	// PollInterval is the delay before the first status check of a collection. It grows by
+	// BackoffFactor after every check that finds the request still running, up to MaxPollInterval.
+	PollInterval    time.Duration
+	MaxPollInterval time.Duration
+	BackoffFactor   float64
+	// CollectionTimeout is the maximum time a single collection may take, measured from
+	// its submission. Zero means no limit. The overall limit is set by the run timeout.
+	CollectionTimeout time.Duration
+}
+
+func DefaultTrackerOptions() TrackerOptions {
+	return TrackerOptions{
+		PollInterval:    5 * time.Second,
+		MaxPollInterval: 2 * time.Minute,
+		BackoffFactor:   2,
+	}
+}
+
+// tracker polls the status of submitted async requests until they reach a final state.
+type tracker struct {
+	dumper *SolrDump
+	opts   TrackerOptions
+}
+
+type trackedCollection struct {
+	cr       *model.CollectionReport
+	interval time.Duration
+	nextPoll time.Time
+	deadline time.Time
+}
+
+func newTracker(dumper *SolrDump, opts TrackerOptions) *tracker {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultTrackerOptions().PollInterval
+	}
+	if opts.MaxPollInterval < opts.PollInterval {
+		opts.MaxPollInterval = opts.PollInterval
+	}
+	if opts.BackoffFactor < 1 {
+		opts.BackoffFactor = 1
+	}
+	return &tracker{
+		dumper: dumper,
+		opts:   opts,
+	}
+}
+
+// wait polls the given submitted collections until every one of them completed, failed,
+// was not found or timed out. If ctx is done first, the remaining ones are marked as timed out.
+func (t *tracker) wait(ctx context.Context, crs []*model.CollectionReport) {
+	var pending []*trackedCollection
+	now := time.Now()
+	for _, cr := range crs {
+		if cr.Status != model.CollectionSubmitted {
+			continue
+		}
+		tc := &trackedCollection{
+			cr:       cr,
+			interval: t.opts.PollInterval,
+			nextPoll: now.Add(t.opts.PollInterval),
+		}
+		if t.opts.CollectionTimeout > 0 {
+			start := now
+			if cr.StartTime != nil {
+				start = *cr.StartTime
+			}
+			tc.deadline = start.Add(t.opts.CollectionTimeout)
+		}
+		pending = append(pending, tc)
+	}
+
+	for len(pending) > 0 {
+		next := pending[0]
+		for _, tc := range pending[1:] {
+			if tc.nextPoll.Before(next.nextPoll) {
+				next = tc
+			}
+		}
+
+		timer := time.NewTimer(time.Until(next.nextPoll))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			for _, tc := range pending {
+				t.dumper.markDone(tc.cr.Collection, model.CollectionTimedOut, fmt.Errorf("async request %s is still running, the run timed out: %v", tc.cr.AsyncId, ctx.Err()))
+			}
+			t.dumper.saveState()
+			return
+		case <-timer.C:
+		}
+
+		if t.poll(ctx, next) {
+			pending = removeTracked(pending, next)
+			t.dumper.saveState()
+			continue
+		}
+		if !next.deadline.IsZero() && time.Now().After(next.deadline) {
+			t.dumper.markDone(next.cr.Collection, model.CollectionTimedOut, fmt.Errorf("async request %s didn't finish within %s", next.cr.AsyncId, t.opts.CollectionTimeout))
+			pending = removeTracked(pending, next)
+			t.dumper.saveState()
+			continue
+		}
+		next.interval = t.backoff(next.interval)
+		next.nextPoll = time.Now().Add(next.interval)
+	}
+}
+
+// backoff returns the delay before the next status check of a collection last checked after interval.
+func (t *tracker) backoff(interval time.Duration) time.Duration {
+	interval = time.Duration(float64(interval) * t.opts.BackoffFactor)
+	if interval > t.opts.MaxPollInterval {
+		return t.opts.MaxPollInterval
+	}
+	return interval
+}
+
+// poll checks the status of a collection once and reports whether it reached a final state.
+func (t *tracker) poll(ctx context.Context, tc *trackedCollection) bool {
+	dumper := t.dumper
+	asyncId := tc.cr.AsyncId
+	responseBody, err := dumper.requestStatus(ctx, asyncId)
+	if err != nil {
+		klog.Errorf("failed to check status of asyncId %s: %v", asyncId, err)
+		return false
+	}
+	state, err := dumper.slClient.GetAsyncStatus(responseBody)
+	if err != nil {
+		klog.Errorf("failed to read state of asyncId %s: %v", asyncId, err)
+		return false
+	}
+
+	switch state {
+	case "completed":
+		klog.Infof("API call for asyncId %s completed", asyncId)
+		if dumper.action == "backup" {
+			dumper.recordBackupId(ctx, tc.cr, responseBody)
+		}
+		dumper.markDone(tc.cr.Collection, model.CollectionCompleted, nil)
+	case "failed":
+		klog.Infof("API call for asyncId %s failed", asyncId)
+		dumper.markDone(tc.cr.Collection, model.CollectionFailed, asyncError(responseBody))
+	case "notfound":
+		klog.Infof("API call for asyncId %s not found", asyncId)
+		dumper.markDone(tc.cr.Collection, model.CollectionNotFound, fmt.Errorf("async request %s not found", asyncId))
+		return true
+	default:
+		klog.V(3).Infof("API call for asyncId %s is %s", asyncId, state)
+		return false
+	}
+	// the final state is saved before the status is flushed, afterwards solr reports the request
+	// as not found and a resume would submit it again
+	dumper.saveState()
+	if err := dumper.flushStatus(asyncId); err != nil {
+		klog.Errorf("failed to flush status of asyncId %s: %v", asyncId, err)
+	}
+	return true
+}
+
+func removeTracked(pending []*trackedCollection, tc *trackedCollection) []*trackedCollection {
+	for i := range pending {
+		if pending[i] == tc {
+			return append(pending[:i], pending[i+1:]...)
+		}
+	}
+	return pending
+}
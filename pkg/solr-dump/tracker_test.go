@@ -0,0 +1,214 @@
+package solr_dump
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pritamdas99/solr-dump/model"
+)
+
+func TestNewTracker(t *testing.T) {
+	tests := map[string]struct {
+		opts TrackerOptions
+		want TrackerOptions
+	}{
+		"defaults": {
+			opts: DefaultTrackerOptions(),
+			want: DefaultTrackerOptions(),
+		},
+		"no poll interval": {
+			opts: TrackerOptions{MaxPollInterval: time.Minute, BackoffFactor: 2},
+			want: TrackerOptions{PollInterval: 5 * time.Second, MaxPollInterval: time.Minute, BackoffFactor: 2},
+		},
+		"max below poll interval": {
+			opts: TrackerOptions{PollInterval: time.Minute, MaxPollInterval: time.Second, BackoffFactor: 2},
+			want: TrackerOptions{PollInterval: time.Minute, MaxPollInterval: time.Minute, BackoffFactor: 2},
+		},
+		"shrinking backoff": {
+			opts: TrackerOptions{PollInterval: time.Second, MaxPollInterval: time.Minute, BackoffFactor: 0.5},
+			want: TrackerOptions{PollInterval: time.Second, MaxPollInterval: time.Minute, BackoffFactor: 1},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := newTracker(nil, test.opts).opts; got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTrackerBackoff(t *testing.T) {
+	tr := newTracker(nil, TrackerOptions{PollInterval: 5 * time.Second, MaxPollInterval: time.Minute, BackoffFactor: 2})
+	var got []time.Duration
+	for interval := tr.opts.PollInterval; len(got) < 6; {
+		interval = tr.backoff(interval)
+		got = append(got, interval)
+	}
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute, time.Minute}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got intervals %v, want %v", got, want)
+		}
+	}
+
+	constant := newTracker(nil, TrackerOptions{PollInterval: time.Second, BackoffFactor: 1})
+	if got := constant.backoff(time.Second); got != time.Second {
+		t.Errorf("got interval %s with a backoff factor of 1, want 1s", got)
+	}
+}
+
+// fakeStatusSolr answers the status requests of async requests with the states listed for them, one per
+// request. The last state is repeated. Flushing the status of a request makes it not found.
+type fakeStatusSolr struct {
+	mu      sync.Mutex
+	states  map[string][]string
+	msg     string
+	polls   map[string]int
+	flushed map[string]bool
+	// onFlush is called before the status of a request is flushed
+	onFlush func(asyncId string)
+}
+
+func (s *fakeStatusSolr) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	asyncId := strings.TrimPrefix(r.URL.Path, "/api/cluster/command-status/")
+	body := map[string]interface{}{
+		"responseHeader": map[string]interface{}{"status": 0},
+	}
+	switch r.Method {
+	case http.MethodGet:
+		s.polls[asyncId]++
+		state := "notfound"
+		if states := s.states[asyncId]; len(states) > 0 && !s.flushed[asyncId] {
+			state = states[min(s.polls[asyncId], len(states))-1]
+		}
+		body["status"] = map[string]interface{}{"state": state, "msg": s.msg}
+	case http.MethodDelete:
+		if s.onFlush != nil {
+			s.onFlush(asyncId)
+		}
+		s.flushed[asyncId] = true
+	}
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// recordingState records the status of every collection each time the state is saved.
+type recordingState struct {
+	saved []map[string]model.CollectionStatus
+}
+
+func (s *recordingState) Load(context.Context, string) (*model.Report, error) {
+	return nil, nil
+}
+
+func (s *recordingState) Save(_ context.Context, state *model.Report) error {
+	statuses := map[string]model.CollectionStatus{}
+	for _, cr := range state.Collections {
+		statuses[cr.Collection] = cr.Status
+	}
+	s.saved = append(s.saved, statuses)
+	return nil
+}
+
+func newTrackerTest(t *testing.T, solr *fakeStatusSolr, asyncIds ...string) (*SolrDump, []*model.CollectionReport) {
+	t.Helper()
+	solr.polls = map[string]int{}
+	solr.flushed = map[string]bool{}
+	dumper := newTestDumper(t, solr)
+	now := time.Now()
+	for _, asyncId := range asyncIds {
+		dumper.report.Collections = append(dumper.report.Collections, &model.CollectionReport{
+			Collection: asyncId,
+			AsyncId:    asyncId,
+			Status:     model.CollectionSubmitted,
+			StartTime:  &now,
+		})
+	}
+	return dumper, dumper.report.Collections
+}
+
+var fastPolls = TrackerOptions{PollInterval: time.Millisecond, MaxPollInterval: 4 * time.Millisecond, BackoffFactor: 2}
+
+func TestTrackerWait(t *testing.T) {
+	solr := &fakeStatusSolr{
+		msg: "disk full",
+		states: map[string][]string{
+			"c1": {"submitted", "running", "running", "completed"},
+			"c2": {"running", "failed"},
+			"c3": {"notfound"},
+		},
+	}
+	dumper, crs := newTrackerTest(t, solr, "c1", "c2", "c3")
+	state := &recordingState{}
+	dumper.state = state
+	// the final state is saved before solr forgets the request
+	solr.onFlush = func(asyncId string) {
+		if status := state.saved[len(state.saved)-1][asyncId]; status == model.CollectionSubmitted {
+			t.Errorf("status of %s was flushed before its final state was saved", asyncId)
+		}
+	}
+
+	newTracker(dumper, fastPolls).wait(context.Background(), crs)
+
+	want := map[string]model.CollectionStatus{
+		"c1": model.CollectionCompleted,
+		"c2": model.CollectionFailed,
+		"c3": model.CollectionNotFound,
+	}
+	for _, cr := range crs {
+		if cr.Status != want[cr.Collection] || cr.EndTime == nil {
+			t.Errorf("collection %s is %s, want %s", cr.Collection, cr.Status, want[cr.Collection])
+		}
+	}
+	if crs[1].Error != "disk full" {
+		t.Errorf("got error %q for the failed request, want the message of solr", crs[1].Error)
+	}
+	if solr.polls["c1"] != 4 || solr.polls["c2"] != 2 || solr.polls["c3"] != 1 {
+		t.Errorf("got polls %v, want each request polled until it finished", solr.polls)
+	}
+	if !solr.flushed["c1"] || !solr.flushed["c2"] || solr.flushed["c3"] {
+		t.Errorf("got flushed %v, want the status of finished requests flushed", solr.flushed)
+	}
+}
+
+func TestTrackerCollectionTimeout(t *testing.T) {
+	solr := &fakeStatusSolr{states: map[string][]string{"c1": {"running"}}}
+	dumper, crs := newTrackerTest(t, solr, "c1")
+	opts := fastPolls
+	opts.CollectionTimeout = 20 * time.Millisecond
+
+	newTracker(dumper, opts).wait(context.Background(), crs)
+
+	if crs[0].Status != model.CollectionTimedOut || !strings.Contains(crs[0].Error, "didn't finish within") {
+		t.Errorf("collection is %s (%s), want it timed out", crs[0].Status, crs[0].Error)
+	}
+	if solr.flushed["c1"] {
+		t.Error("status of a request that is still running was flushed")
+	}
+}
+
+func TestTrackerContextDone(t *testing.T) {
+	solr := &fakeStatusSolr{states: map[string][]string{"c1": {"running"}, "c2": {"running"}}}
+	dumper, crs := newTrackerTest(t, solr, "c1", "c2")
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	newTracker(dumper, TrackerOptions{PollInterval: time.Millisecond, MaxPollInterval: time.Hour, BackoffFactor: 1000}).wait(ctx, crs)
+
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("wait returned after %s, want it to return once the context is done", elapsed)
+	}
+	for _, cr := range crs {
+		if cr.Status != model.CollectionTimedOut || !strings.Contains(cr.Error, "the run timed out") {
+			t.Errorf("collection %s is %s (%s), want it timed out", cr.Collection, cr.Status, cr.Error)
+		}
+	}
+}
@@ -0,0 +1,416 @@
+package solr_dump
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pritamdas99/solr-dump/blob"
+	"github.com/pritamdas99/solr-dump/model"
+	"k8s.io/klog/v2"
+)
+
+const (
+	shardMetadataDir = "shard_backup_metadata"
+	indexDir         = "index"
+	// zkBackupPrefix starts the directories of the zookeeper data of backup points, zk_backup_N
+	zkBackupPrefix = "zk_backup_"
+
+	// every lucene index file ends with a 16 byte footer: magic, algorithm id and the crc32
+	// checksum of everything before the checksum itself, stored as a big endian int64
+	luceneFooterLength = 16
+	luceneFooterMagic  = 0xc02893e8
+)
+
+var shardMetadataRegex = regexp.MustCompile(`^md_(.+)_(\d+)\.json$`)
+
+// VerifyOptions selects the backup points to verify.
+type VerifyOptions struct {
+	Filter *CollectionFilter
+	// FromRun verifies the backup points recorded in the manifest of this backup run.
+	FromRun string
+	// BackupId verifies this backup point of every collection. AllPoints verifies every
+	// backup point. Otherwise the latest backup point of each collection is verified.
+	BackupId  *int
+	AllPoints bool
+	// SizeOnly skips reading the index files to compare their checksums. The chunks of logical dumps are
+	// always read, their recorded sizes are those before encryption.
+	SizeOnly bool
+}
+
+// shardFile is an entry of the shard backup metadata, md_<shard>_<backupId>.json.
+type shardFile struct {
+	FileName string `json:"fileName"`
+	Checksum int64  `json:"checksum"`
+	Size     int64  `json:"size"`
+}
+
+// VerifyBackups checks that every index file referenced by the selected backup points
+// exists in the backup storage with the expected size and checksum. The chunks of the selected
+// logical dumps are compared with the sizes and sha256 recorded in their manifests.
+func VerifyBackups(ctx context.Context, bl model.Blob, opts VerifyOptions) (*model.VerifyReport, error) {
+	var targets []*model.CollectionVerification
+	dumps := map[*model.CollectionVerification]*model.DumpManifest{}
+	addDump := func(m *model.Manifest, cm model.CollectionManifest) {
+		cv := &model.CollectionVerification{
+			Backup:     cm.BackupName,
+			Collection: cm.Name,
+			RunId:      m.RunId,
+			Dump:       &model.DumpVerification{Path: cm.Dump.Path},
+		}
+		targets = append(targets, cv)
+		dumps[cv] = cm.Dump
+	}
+	if opts.FromRun != "" {
+		m, err := ReadManifest(ctx, bl, opts.FromRun)
+		if err != nil {
+			return nil, err
+		}
+		for _, cm := range m.Collections {
+			if cm.Dump != nil && opts.Filter.Match(cm.Name) {
+				addDump(m, cm)
+				continue
+			}
+			if cm.BackupId == nil || !opts.Filter.Match(cm.Name) {
+				continue
+			}
+			targets = append(targets, &model.CollectionVerification{
+				Backup:     cm.BackupName,
+				Collection: cm.Name,
+				BackupId:   *cm.BackupId,
+				RunId:      m.RunId,
+			})
+		}
+	} else {
+		backups, err := ListBackups(ctx, bl)
+		if err != nil {
+			return nil, err
+		}
+		for _, bi := range backups {
+			for _, cb := range bi.Collections {
+				if !opts.Filter.Match(cb.Name) {
+					continue
+				}
+				points := cb.Points
+				if !opts.AllPoints {
+					point, err := resolveBackupPoint(cb, opts.BackupId, nil)
+					if err != nil {
+						targets = append(targets, &model.CollectionVerification{
+							Backup:     bi.Name,
+							Collection: cb.Name,
+							Status:     model.VerifyError,
+							Error:      err.Error(),
+						})
+						continue
+					}
+					points = []model.BackupPoint{*point}
+				}
+				for _, point := range points {
+					targets = append(targets, &model.CollectionVerification{
+						Backup:     bi.Name,
+						Collection: cb.Name,
+						BackupId:   point.ID,
+						RunId:      point.RunId,
+					})
+				}
+			}
+		}
+
+		// logical dumps have no backup ids, the newest completed dump of each collection is verified
+		// unless every dump is
+		if opts.BackupId == nil {
+			manifests, err := logicalManifests(ctx, bl)
+			if err != nil {
+				return nil, err
+			}
+			seen := map[string]bool{}
+			for _, m := range manifests {
+				for _, cm := range m.Collections {
+					key := path.Join(cm.BackupName, cm.Name)
+					if cm.Dump == nil || cm.Status != model.CollectionCompleted || !opts.Filter.Match(cm.Name) || (seen[key] && !opts.AllPoints) {
+						continue
+					}
+					seen[key] = true
+					addDump(m, cm)
+				}
+			}
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no backup point matched the collection filters")
+	}
+
+	vr := &model.VerifyReport{Collections: targets}
+	for _, cv := range targets {
+		if dump, ok := dumps[cv]; ok {
+			verifyLogicalDump(ctx, bl, cv, dump)
+			klog.Infof("dump %s is %s", dump.Path, cv.Status)
+			continue
+		}
+		if cv.Status == "" {
+			verifyBackupPoint(ctx, bl, cv, opts.SizeOnly)
+		}
+		klog.Infof("backup point %d of %s is %s", cv.BackupId, path.Join(cv.Backup, cv.Collection), cv.Status)
+	}
+	updateVerifyStatus(vr)
+	return vr, nil
+}
+
+// updateVerifyStatus sets the overall status to the worst status of the verified backup points.
+func updateVerifyStatus(vr *model.VerifyReport) {
+	vr.Status = model.VerifyValid
+	for _, cv := range vr.Collections {
+		if cv.Status == model.VerifyError || (cv.Status == model.VerifyInvalid && vr.Status == model.VerifyValid) {
+			vr.Status = cv.Status
+		}
+	}
+}
+
+// verifyBackupPoint verifies backup point cv.BackupId of <cv.Backup>/<cv.Collection>/.
+func verifyBackupPoint(ctx context.Context, bl model.Blob, cv *model.CollectionVerification, sizeOnly bool) {
+	dir := path.Join(cv.Backup, cv.Collection)
+	data, err := bl.Get(ctx, path.Join(dir, fmt.Sprintf("backup_%d.properties", cv.BackupId)))
+	if err != nil {
+		cv.Status = model.VerifyError
+		cv.Error = fmt.Sprintf("failed to read backup properties: %v", err)
+		return
+	}
+	shards, err := shardMetadataFiles(ctx, bl, dir, cv.BackupId, parseProperties(data))
+	if err != nil {
+		cv.Status = model.VerifyError
+		cv.Error = err.Error()
+		return
+	}
+	if len(shards) == 0 {
+		cv.Status = model.VerifyInvalid
+		cv.Error = "no shard metadata found"
+		return
+	}
+
+	// the sizes of the stored index files are listed once instead of stating every file
+	objects, err := bl.ListInfo(ctx, path.Join(dir, indexDir))
+	if err != nil {
+		cv.Status = model.VerifyError
+		cv.Error = fmt.Sprintf("failed to list index files: %v", err)
+		return
+	}
+	sizes := map[string]int64{}
+	for _, obj := range objects {
+		sizes[path.Base(obj.Path)] = obj.Size
+	}
+
+	cv.Status = model.VerifyValid
+	for _, sv := range shards {
+		verifyShard(ctx, bl, dir, &sv, sizes, sizeOnly)
+		if sv.Status != model.VerifyValid {
+			cv.Status = model.VerifyInvalid
+		}
+		cv.Shards = append(cv.Shards, sv)
+	}
+}
+
+// shardMetadataFiles returns the shard metadata files of a backup point. They are referenced by the
+// <shard>.md entries of the backup properties, older backups are matched by their file names instead.
+func shardMetadataFiles(ctx context.Context, bl model.Blob, dir string, backupId int, props map[string]string) ([]model.ShardVerification, error) {
+	var shards []model.ShardVerification
+	for key, value := range props {
+		if !strings.HasSuffix(key, ".md") || value == "" {
+			continue
+		}
+		if !strings.HasSuffix(value, ".json") {
+			value += ".json"
+		}
+		shards = append(shards, model.ShardVerification{
+			Shard:        strings.TrimSuffix(key, ".md"),
+			MetadataFile: value,
+		})
+	}
+	if len(shards) == 0 {
+		objects, err := bl.List(ctx, path.Join(dir, shardMetadataDir))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list shard metadata: %v", err)
+		}
+		for _, obj := range objects {
+			match := shardMetadataRegex.FindStringSubmatch(path.Base(obj))
+			if match == nil || match[2] != strconv.Itoa(backupId) {
+				continue
+			}
+			shards = append(shards, model.ShardVerification{
+				Shard:        match[1],
+				MetadataFile: path.Base(obj),
+			})
+		}
+	}
+	sort.Slice(shards, func(i, j int) bool {
+		return shards[i].Shard < shards[j].Shard
+	})
+	return shards, nil
+}
+
+func verifyShard(ctx context.Context, bl model.Blob, dir string, sv *model.ShardVerification, sizes map[string]int64, sizeOnly bool) {
+	data, err := bl.Get(ctx, path.Join(dir, shardMetadataDir, sv.MetadataFile))
+	if err != nil {
+		sv.Status = model.VerifyInvalid
+		if blob.IsNotFound(err) {
+			sv.Error = "shard metadata is missing"
+		} else {
+			sv.Error = fmt.Sprintf("failed to read shard metadata: %v", err)
+		}
+		return
+	}
+	files := map[string]shardFile{}
+	if err := json.Unmarshal(data, &files); err != nil {
+		sv.Status = model.VerifyInvalid
+		sv.Error = fmt.Sprintf("failed to decode shard metadata: %v", err)
+		return
+	}
+
+	indexFiles := make([]string, 0, len(files))
+	for indexFile := range files {
+		indexFiles = append(indexFiles, indexFile)
+	}
+	sort.Strings(indexFiles)
+
+	sv.Status = model.VerifyValid
+	for _, indexFile := range indexFiles {
+		file := files[indexFile]
+		sv.Files++
+		sv.Size += file.Size
+		fv := model.FileVerification{File: file.FileName, IndexFile: indexFile}
+		size, ok := sizes[indexFile]
+		switch {
+		case !ok:
+			fv.Problem = model.FileMissing
+		case size != file.Size:
+			fv.Problem = model.FileSizeMismatch
+			fv.Detail = fmt.Sprintf("expected %d bytes, found %d", file.Size, size)
+		case !sizeOnly:
+			fv.Problem, fv.Detail = verifyChecksum(ctx, bl, path.Join(dir, indexDir, indexFile), file.Checksum)
+		}
+		if fv.Problem != "" {
+			sv.Status = model.VerifyInvalid
+			sv.Problems = append(sv.Problems, fv)
+		}
+	}
+}
+
+// verifyChecksum reads an index file and compares the crc32 of its content with the checksum stored in
+// its lucene footer and with the checksum recorded in the shard metadata.
+func verifyChecksum(ctx context.Context, bl model.Blob, filepath string, expected int64) (model.FileProblem, string) {
+	r, err := bl.NewReader(ctx, filepath)
+	if err != nil {
+		return model.FileUnreadable, err.Error()
+	}
+	defer r.Close()
+
+	fw := &footerWriter{crc: crc32.NewIEEE()}
+	if _, err := io.Copy(fw, r); err != nil {
+		return model.FileUnreadable, err.Error()
+	}
+	if len(fw.footer) < luceneFooterLength {
+		return model.FileChecksumMismatch, "file is too short for a lucene footer"
+	}
+	if magic := binary.BigEndian.Uint32(fw.footer[:4]); magic != luceneFooterMagic {
+		return model.FileChecksumMismatch, fmt.Sprintf("invalid footer magic %x", magic)
+	}
+	// the crc covers the footer up to the checksum
+	_, _ = fw.crc.Write(fw.footer[:8])
+	computed := int64(fw.crc.Sum32())
+	stored := int64(binary.BigEndian.Uint64(fw.footer[8:]))
+	if computed != stored {
+		return model.FileChecksumMismatch, fmt.Sprintf("content checksum %d doesn't match footer checksum %d", computed, stored)
+	}
+	if stored != expected {
+		return model.FileChecksumMismatch, fmt.Sprintf("footer checksum %d doesn't match recorded checksum %d", stored, expected)
+	}
+	return "", ""
+}
+
+// verifyLogicalDump verifies the chunks of the logical dump of cv.
+func verifyLogicalDump(ctx context.Context, bl model.Blob, cv *model.CollectionVerification, dump *model.DumpManifest) {
+	dv := cv.Dump
+	dv.Files = len(dump.Chunks)
+	for _, chunk := range dump.Chunks {
+		dv.Size += chunk.Size
+	}
+	dv.Problems = verifyDump(ctx, bl, dump)
+	dv.Status = model.VerifyValid
+	if len(dv.Problems) > 0 {
+		dv.Status = model.VerifyInvalid
+	}
+	cv.Status = dv.Status
+}
+
+// verifyDump reads the chunks and the schema file of a logical dump and compares them with the sizes and
+// sha256 recorded in the manifest. It returns the problems found.
+func verifyDump(ctx context.Context, bl model.Blob, dump *model.DumpManifest) []model.FileVerification {
+	var problems []model.FileVerification
+	if dump.Schema != "" {
+		if problem, detail := verifyObject(ctx, bl, path.Join(dump.Path, dump.Schema), -1, dump.SchemaSHA256); problem != "" {
+			problems = append(problems, model.FileVerification{File: dump.Schema, Problem: problem, Detail: detail})
+		}
+	}
+	for _, chunk := range dump.Chunks {
+		if problem, detail := verifyObject(ctx, bl, path.Join(dump.Path, chunk.Name), chunk.Size, chunk.SHA256); problem != "" {
+			problems = append(problems, model.FileVerification{File: chunk.Name, Problem: problem, Detail: detail})
+		}
+	}
+	return problems
+}
+
+// footerWriter feeds everything but the last luceneFooterLength bytes written to crc.
+type footerWriter struct {
+	crc    hash.Hash32
+	footer []byte
+}
+
+func (w *footerWriter) Write(p []byte) (int, error) {
+	w.footer = append(w.footer, p...)
+	if cut := len(w.footer) - luceneFooterLength; cut > 0 {
+		_, _ = w.crc.Write(w.footer[:cut])
+		w.footer = append(w.footer[:0], w.footer[cut:]...)
+	}
+	return len(p), nil
+}
+
+// CheckBackups asks solr to list the backup points of every verified backup. A backup point
+// that solr doesn't list is marked invalid.
+func (dumper *SolrDump) CheckBackups(ctx context.Context, vr *model.VerifyReport) {
+	listed := map[string]map[int]bool{}
+	for _, cv := range vr.Collections {
+		// solr doesn't know about logical dumps
+		if cv.Status == model.VerifyError || cv.Dump != nil {
+			continue
+		}
+		ids, ok := listed[cv.Backup]
+		if !ok {
+			points, err := dumper.listBackupPoints(ctx, cv.Backup)
+			if err != nil {
+				klog.Errorf("failed to list backup %s through solr: %v", cv.Backup, err)
+				cv.SolrCheck = fmt.Sprintf("error: %v", err)
+				continue
+			}
+			ids = map[int]bool{}
+			for _, id := range points {
+				ids[id] = true
+			}
+			listed[cv.Backup] = ids
+		}
+		if ids[cv.BackupId] {
+			cv.SolrCheck = "listed"
+		} else {
+			cv.SolrCheck = "not listed"
+			cv.Status = model.VerifyInvalid
+		}
+	}
+	updateVerifyStatus(vr)
+}
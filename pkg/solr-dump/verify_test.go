@@ -0,0 +1,199 @@
+package solr_dump
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pritamdas99/solr-dump/model"
+)
+
+// luceneFile returns content followed by a lucene footer holding the crc32 of everything before the checksum.
+func luceneFile(content string) []byte {
+	data := []byte(content)
+	data = binary.BigEndian.AppendUint32(data, luceneFooterMagic)
+	data = binary.BigEndian.AppendUint32(data, 0)
+	return binary.BigEndian.AppendUint64(data, uint64(crc32.ChecksumIEEE(data)))
+}
+
+// footerChecksum returns the checksum stored in the footer of a lucene file, 0 if it is too short.
+func footerChecksum(data []byte) int64 {
+	if len(data) < luceneFooterLength {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(data[len(data)-8:]))
+}
+
+// putIndexFile stores data as index file name of <backupName>/<collection>/ and returns its shard metadata entry.
+func putIndexFile(t *testing.T, bl model.Blob, dir string, name string, data []byte) shardFile {
+	t.Helper()
+	putObject(t, bl, fmt.Sprintf("%s/%s/%s", dir, indexDir, name), data)
+	return shardFile{FileName: "_" + name + ".cfs", Checksum: footerChecksum(data), Size: int64(len(data))}
+}
+
+func putShardMetadata(t *testing.T, bl model.Blob, dir string, name string, files map[string]shardFile) {
+	t.Helper()
+	data, err := json.Marshal(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	putObject(t, bl, fmt.Sprintf("%s/%s/%s", dir, shardMetadataDir, name), data)
+}
+
+func putBackupProperties(t *testing.T, bl model.Blob, dir string, id int, props ...string) {
+	t.Helper()
+	data := "#Backup properties file\nsolrVersion=9.4.0\n" + strings.Join(props, "\n") + "\n"
+	putObject(t, bl, fmt.Sprintf("%s/backup_%d.properties", dir, id), []byte(data))
+}
+
+// putVerifyBackup stores backup b1 of collection c1 with three backup points:
+//   - 0 references the metadata of shard1 and shard2 in its properties, shard1 has a file with
+//     every kind of problem
+//   - 1 has no <shard>.md entries, its metadata is found by the names md_<shard>_1.json
+//   - 2 has no shard metadata at all
+func putVerifyBackup(t *testing.T, bl model.Blob) {
+	const dir = "b1/c1"
+	good := putIndexFile(t, bl, dir, "good", luceneFile("good content"))
+
+	badFooter := luceneFile("bad footer")
+	badFooter[len(badFooter)-luceneFooterLength] ^= 0xff
+	corrupt := luceneFile("corrupt content")
+	checksum := footerChecksum(corrupt)
+	corrupt[0] ^= 0xff
+	resized := putIndexFile(t, bl, dir, "resized", luceneFile("resized"))
+	resized.Size += 10
+	recorded := putIndexFile(t, bl, dir, "recorded", luceneFile("recorded"))
+	recorded.Checksum++
+	corruptFile := putIndexFile(t, bl, dir, "corrupt", corrupt)
+	corruptFile.Checksum = checksum
+
+	putShardMetadata(t, bl, dir, "md_shard1_0.json", map[string]shardFile{
+		"good":      good,
+		"badfooter": putIndexFile(t, bl, dir, "badfooter", badFooter),
+		"corrupt":   corruptFile,
+		"truncated": putIndexFile(t, bl, dir, "truncated", []byte("short")),
+		"resized":   resized,
+		"recorded":  recorded,
+		"missing":   {FileName: "_missing.cfs", Checksum: 1, Size: 100},
+	})
+	putShardMetadata(t, bl, dir, "md_shard2_0.json", map[string]shardFile{
+		"good2": putIndexFile(t, bl, dir, "good2", luceneFile("good content of shard2")),
+	})
+	putBackupProperties(t, bl, dir, 0, "shard1.md=md_shard1_0", "shard2.md=md_shard2_0.json")
+
+	putShardMetadata(t, bl, dir, "md_shard1_1.json", map[string]shardFile{"good": good})
+	putShardMetadata(t, bl, dir, "md_shard2_1.json", map[string]shardFile{"good": good})
+	putBackupProperties(t, bl, dir, 1)
+
+	putBackupProperties(t, bl, dir, 2)
+}
+
+func TestVerifyBackups(t *testing.T) {
+	tests := map[string]struct {
+		sizeOnly bool
+		// problems are the problems of the index files of shard1 of backup point 0
+		problems map[string]model.FileProblem
+	}{
+		"checksums": {
+			problems: map[string]model.FileProblem{
+				"badfooter": model.FileChecksumMismatch,
+				"corrupt":   model.FileChecksumMismatch,
+				"truncated": model.FileChecksumMismatch,
+				"resized":   model.FileSizeMismatch,
+				"recorded":  model.FileChecksumMismatch,
+				"missing":   model.FileMissing,
+			},
+		},
+		"size only": {
+			sizeOnly: true,
+			problems: map[string]model.FileProblem{
+				"resized": model.FileSizeMismatch,
+				"missing": model.FileMissing,
+			},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			bl := newTestBlob(t)
+			putVerifyBackup(t, bl)
+			filter, err := NewCollectionFilter(nil, nil, "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			vr, err := VerifyBackups(context.Background(), bl, VerifyOptions{Filter: filter, AllPoints: true, SizeOnly: test.sizeOnly})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if vr.Status != model.VerifyInvalid || len(vr.Collections) != 3 {
+				t.Fatalf("report is %s with %d backup points, want Invalid with 3", vr.Status, len(vr.Collections))
+			}
+			points := map[int]*model.CollectionVerification{}
+			for _, cv := range vr.Collections {
+				points[cv.BackupId] = cv
+			}
+
+			cv := points[0]
+			if cv.Status != model.VerifyInvalid || len(cv.Shards) != 2 {
+				t.Fatalf("backup point 0 is %s with %d shards, want Invalid with 2", cv.Status, len(cv.Shards))
+			}
+			shard1, shard2 := cv.Shards[0], cv.Shards[1]
+			if shard1.Shard != "shard1" || shard1.MetadataFile != "md_shard1_0.json" || shard1.Status != model.VerifyInvalid || shard1.Files != 7 {
+				t.Errorf("shard1 = %+v, want md_shard1_0.json Invalid with 7 files", shard1)
+			}
+			got := map[string]model.FileProblem{}
+			for _, fv := range shard1.Problems {
+				got[fv.IndexFile] = fv.Problem
+			}
+			if !reflect.DeepEqual(got, test.problems) {
+				t.Errorf("problems = %v, want %v", got, test.problems)
+			}
+			if shard2.Shard != "shard2" || shard2.MetadataFile != "md_shard2_0.json" || shard2.Status != model.VerifyValid || len(shard2.Problems) != 0 {
+				t.Errorf("shard2 = %+v, want md_shard2_0.json Valid", shard2)
+			}
+
+			cv = points[1]
+			if cv.Status != model.VerifyValid || len(cv.Shards) != 2 {
+				t.Fatalf("backup point 1 is %s with %d shards, want Valid with 2", cv.Status, len(cv.Shards))
+			}
+			for i, want := range []string{"md_shard1_1.json", "md_shard2_1.json"} {
+				if cv.Shards[i].MetadataFile != want {
+					t.Errorf("shard %s of backup point 1 has metadata %s, want %s", cv.Shards[i].Shard, cv.Shards[i].MetadataFile, want)
+				}
+			}
+
+			if cv := points[2]; cv.Status != model.VerifyInvalid || cv.Error != "no shard metadata found" {
+				t.Errorf("backup point 2 is %s (%s), want Invalid without shard metadata", cv.Status, cv.Error)
+			}
+		})
+	}
+}
+
+func TestVerifyBackupsMissingMetadata(t *testing.T) {
+	bl := newTestBlob(t)
+	good := putIndexFile(t, bl, "b1/c1", "good", luceneFile("good content"))
+	putShardMetadata(t, bl, "b1/c1", "md_shard1_0.json", map[string]shardFile{"good": good})
+	putBackupProperties(t, bl, "b1/c1", 0, "shard1.md=md_shard1_0.json", "shard2.md=md_shard2_0.json")
+	filter, err := NewCollectionFilter(nil, nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vr, err := VerifyBackups(context.Background(), bl, VerifyOptions{Filter: filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cv := vr.Collections[0]
+	if cv.Status != model.VerifyInvalid || len(cv.Shards) != 2 {
+		t.Fatalf("backup point is %s with %d shards, want Invalid with 2", cv.Status, len(cv.Shards))
+	}
+	if cv.Shards[0].Status != model.VerifyValid {
+		t.Errorf("shard1 is %s, want Valid", cv.Shards[0].Status)
+	}
+	if cv.Shards[1].Status != model.VerifyInvalid || cv.Shards[1].Error != "shard metadata is missing" {
+		t.Errorf("shard2 is %s (%s), want Invalid with missing metadata", cv.Shards[1].Status, cv.Shards[1].Error)
+	}
+}